@@ -15,7 +15,6 @@
 package main
 
 import (
-	"io/ioutil"
 	"log"
 	"os"
 
@@ -33,27 +32,17 @@ type Options struct {
 	Tags     []string `long:"tag" default:"" description:"tag applied to query --tag=tagA --tag=tagB"`
 }
 
-func getCode(opts *Options) (string, error) {
-	if opts.Code != "" {
-		return opts.Code, nil
-	}
-	bytes, err := ioutil.ReadFile(opts.File)
-	if err != nil {
-		return "", err
-	}
-	return string(bytes), nil
-}
-
 func run(opts *Options) error {
 	client, err := rai.NewClientFromConfig(opts.Profile)
 	if err != nil {
 		return err
 	}
-	source, err := getCode(opts)
-	if err != nil {
-		return err
+	var rsp *rai.TransactionResponse
+	if opts.Code != "" {
+		rsp, err = client.Execute(opts.Database, opts.Engine, opts.Code, nil, opts.Readonly, opts.Tags...)
+	} else {
+		rsp, err = client.ExecuteFile(opts.Database, opts.Engine, opts.File, nil, opts.Readonly, opts.Tags...)
 	}
-	rsp, err := client.Execute(opts.Database, opts.Engine, source, nil, opts.Readonly, opts.Tags...)
 	if err != nil {
 		return err
 	}
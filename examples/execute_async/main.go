@@ -15,7 +15,6 @@
 package main
 
 import (
-	"io/ioutil"
 	"log"
 	"os"
 
@@ -32,27 +31,17 @@ type Options struct {
 	Profile  string `long:"profile" default:"default" description:"config profile"`
 }
 
-func getCode(opts *Options) (string, error) {
-	if opts.Code != "" {
-		return opts.Code, nil
-	}
-	bytes, err := ioutil.ReadFile(opts.File)
-	if err != nil {
-		return "", err
-	}
-	return string(bytes), nil
-}
-
 func run(opts *Options) error {
 	client, err := rai.NewClientFromConfig(opts.Profile)
 	if err != nil {
 		return err
 	}
-	source, err := getCode(opts)
-	if err != nil {
-		return err
+	var rsp *rai.TransactionResponse
+	if opts.Code != "" {
+		rsp, err = client.ExecuteAsync(opts.Database, opts.Engine, opts.Code, nil, opts.Readonly)
+	} else {
+		rsp, err = client.ExecuteFileAsync(opts.Database, opts.Engine, opts.File, nil, opts.Readonly)
 	}
-	rsp, err := client.ExecuteAsync(opts.Database, opts.Engine, source, nil, opts.Readonly)
 	if err != nil {
 		return err
 	}
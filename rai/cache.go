@@ -0,0 +1,131 @@
+// Copyright 2022 RelationalAI, Inc.
+
+package rai
+
+// Support for caching the results of read-only queries on the client, so that
+// queries that are repeated frequently, eg to refresh a dashboard, are not
+// executed each time.
+
+// Cached results are keyed on the database and a hash of the query source.
+// The cache has no knowledge of the state of the database, so a cached result
+// may be stale by up to its ttl if the database is changed in the meantime.
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// ResultCache stores transaction responses for `ExecuteCached`. It can be
+// implemented to share cached results between clients, eg using Redis. Keys
+// include the client's host and region, but not its account, so a cache must
+// never be shared between clients of different accounts.
+type ResultCache interface {
+	// Returns the response stored with the given key, if any, and whether it
+	// was found. Responses whose ttl has expired must not be returned.
+	Get(key string) (*TransactionResponse, bool)
+
+	// Store the given response with the given key for the given ttl.
+	Set(key string, rsp *TransactionResponse, ttl time.Duration)
+}
+
+type memoryCacheEntry struct {
+	rsp     *TransactionResponse
+	expires time.Time
+}
+
+// MemoryResultCache is a ResultCache that stores responses in memory. It is
+// safe for concurrent use, and is the default cache used by the client.
+type MemoryResultCache struct {
+	mu      sync.Mutex
+	entries map[string]memoryCacheEntry
+}
+
+func NewMemoryResultCache() *MemoryResultCache {
+	return &MemoryResultCache{entries: map[string]memoryCacheEntry{}}
+}
+
+func (c *MemoryResultCache) Get(key string) (*TransactionResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(entry.expires) {
+		delete(c.entries, key)
+		return nil, false
+	}
+	return entry.rsp, true
+}
+
+func (c *MemoryResultCache) Set(key string, rsp *TransactionResponse, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	for k, entry := range c.entries {
+		if now.After(entry.expires) {
+			delete(c.entries, k) // evict expired entries as we go
+		}
+	}
+	c.entries[key] = memoryCacheEntry{rsp, now.Add(ttl)}
+}
+
+// Returns the cache key for the given query on the given host and region.
+func resultCacheKey(host, region, database, source string) string {
+	sum := sha256.Sum256([]byte(source))
+	return host + "/" + region + "/" + database + "/" + hex.EncodeToString(sum[:])
+}
+
+// Returns the client's result cache, creating a memory cache for clients that
+// were not created by NewClient.
+func (c *Client) cache() ResultCache {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.resultCache == nil {
+		c.resultCache = NewMemoryResultCache()
+	}
+	return c.resultCache
+}
+
+// Execute the given read-only query, returning the cached response of an
+// identical query on the same database if it was executed within the given
+// ttl. Only completed transactions are cached, so a query that aborted is
+// executed again on the next call. Each caller gets its own copy of the
+// response, so that copies can be used concurrently, but their partitions
+// and metadata are shared between callers and should not be modified.
+func (c *Client) ExecuteCached(
+	database, engine, source string, ttl time.Duration,
+) (*TransactionResponse, error) {
+	return c.ExecuteCachedContext(c.Context(), database, engine, source, ttl)
+}
+
+func (c *Client) ExecuteCachedContext(
+	ctx context.Context, database, engine, source string, ttl time.Duration,
+) (*TransactionResponse, error) {
+	cache := c.cache()
+	key := resultCacheKey(c.Host, c.Region, database, source)
+	if rsp, ok := cache.Get(key); ok {
+		return copyResponse(rsp), nil
+	}
+	rsp, err := c.ExecuteContext(ctx, database, engine, source, nil, true)
+	if err != nil {
+		return nil, err
+	}
+	if ttl > 0 && rsp.Transaction.State == Completed {
+		cache.Set(key, rsp, ttl)
+		return copyResponse(rsp), nil
+	}
+	return rsp, nil
+}
+
+// Returns a shallow copy of the given cached response. Relations are decoded
+// lazily, see TransactionResponse.Relations, so each copy decodes its own,
+// and the cached response is only ever read.
+func copyResponse(rsp *TransactionResponse) *TransactionResponse {
+	result := *rsp
+	result.relations = nil
+	return &result
+}
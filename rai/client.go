@@ -15,20 +15,31 @@
 package rai
 
 import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/fs"
 	"io/ioutil"
 	"mime"
 	"mime/multipart"
 	"net/http"
 	"net/url"
+	"os"
+	"path"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/apache/arrow/go/v7/arrow"
 	"github.com/apache/arrow/go/v7/arrow/ipc"
 	"github.com/google/uuid"
 	"github.com/pkg/errors"
@@ -45,6 +56,10 @@ type ClientOptions struct {
 	HTTPClient         *http.Client
 	AccessTokenHandler AccessTokenHandler
 	PreRequestHook     PreRequestHook
+	ResultCache        ResultCache // cache used by ExecuteCached, default in memory
+	MaxRequestBytes    int64       // limit on request body size, default no limit
+	Debug              bool        // trace requests and responses
+	DebugWriter        io.Writer   // destination of debug output, default stderr
 }
 
 func NewClientOptions(cfg *Config) *ClientOptions {
@@ -52,14 +67,20 @@ func NewClientOptions(cfg *Config) *ClientOptions {
 }
 
 type Client struct {
-	ctx                context.Context
-	Region             string
+	mu                 sync.Mutex      // guards ctx, closed and resultCache
+	ctx                context.Context // see Context
+	closed             chan struct{}   // closed by Close, created on first use
+	Region             string          // default region of transactions and engines
 	Scheme             string
 	Host               string
 	Port               string
 	HttpClient         *http.Client
 	accessTokenHandler AccessTokenHandler
 	preRequestHook     PreRequestHook
+	resultCache        ResultCache
+	maxRequestBytes    int64
+	regionSet          bool      // Region was given by the client's options
+	debug              io.Writer // nil unless debugging is enabled
 }
 
 const DefaultHost = "azure.relationalai.com"
@@ -67,6 +88,9 @@ const DefaultPort = "443"
 const DefaultRegion = "us-east"
 const DefaultScheme = "https"
 
+// Returns a new client with the given options. The options are not
+// validated, use NewClientFromOptions to have invalid options reported when
+// the client is created rather than by the service.
 func NewClient(ctx context.Context, opts *ClientOptions) *Client {
 	if opts == nil {
 		opts = &ClientOptions{}
@@ -90,24 +114,67 @@ func NewClient(ctx context.Context, opts *ClientOptions) *Client {
 	if opts.HTTPClient == nil {
 		opts.HTTPClient = &http.Client{}
 	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
 	client := &Client{
-		ctx:            ctx,
-		Region:         region,
-		Scheme:         scheme,
-		Host:           host,
-		Port:           port,
-		preRequestHook: opts.PreRequestHook,
-		HttpClient:     opts.HTTPClient}
-	if opts.AccessTokenHandler != nil {
+		ctx:             clientContext{ctx},
+		Region:          region,
+		Scheme:          scheme,
+		Host:            host,
+		Port:            port,
+		preRequestHook:  opts.PreRequestHook,
+		resultCache:     opts.ResultCache,
+		maxRequestBytes: opts.MaxRequestBytes,
+		regionSet:       opts.Region != "",
+		HttpClient:      opts.HTTPClient}
+	if client.resultCache == nil {
+		client.resultCache = NewMemoryResultCache()
+	}
+	if opts.Debug {
+		client.debug = opts.DebugWriter
+		if client.debug == nil {
+			client.debug = os.Stderr
+		}
+	}
+	switch {
+	case opts.AccessTokenHandler != nil:
 		client.accessTokenHandler = opts.AccessTokenHandler
-	} else if opts.Credentials == nil {
-		client.accessTokenHandler = NewNopAccessTokenHandler()
-	} else {
+	case opts.Credentials != nil:
 		client.accessTokenHandler = NewClientCredentialsHandler(client, opts.Credentials)
+	case opts.AccessToken != "":
+		client.accessTokenHandler = NewStaticTokenHandler(opts.AccessToken, time.Time{})
+	case opts.AccessTokenFile != "":
+		client.accessTokenHandler = NewTokenFileHandler(opts.AccessTokenFile)
+	default:
+		client.accessTokenHandler = NewNopAccessTokenHandler()
 	}
 	return client
 }
 
+// Returns an error if the given options cannot be used to create a client,
+// eg an error matching ErrInvalidRegion if the region is not well-formed. An
+// empty region is valid, the client uses DefaultRegion.
+func (opts *ClientOptions) Validate() error {
+	if opts.Region != "" {
+		if err := ValidateRegion(opts.Region); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns a new client with the given options, as NewClient does, or an
+// error if the options are not valid, see ClientOptions.Validate.
+func NewClientFromOptions(ctx context.Context, opts *ClientOptions) (*Client, error) {
+	if opts != nil {
+		if err := opts.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	return NewClient(ctx, opts), nil
+}
+
 // Returns a new client using the background context and config settings from
 // the named profile.
 func NewClientFromConfig(profile string) (*Client, error) {
@@ -117,7 +184,7 @@ func NewClientFromConfig(profile string) (*Client, error) {
 	}
 
 	opts := ClientOptions{Config: cfg}
-	return NewClient(context.Background(), &opts), nil
+	return NewClientFromOptions(context.Background(), &opts)
 }
 
 // Returns a new client using the background context and config settings from
@@ -126,12 +193,96 @@ func NewDefaultClient() (*Client, error) {
 	return NewClientFromConfig(DefaultConfigProfile)
 }
 
+// Returns the client's context, which is used by the operations that are not
+// given a context. The background context is used if none was set.
 func (c *Client) Context() context.Context {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.ctx == nil {
+		return clientContext{context.Background()}
+	}
 	return c.ctx
 }
 
+// Replace the client's context. Requests already running keep the context
+// they were started with.
 func (c *Client) SetContext(ctx context.Context) {
-	c.ctx = ctx
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ctx = clientContext{ctx}
+}
+
+// clientContext marks the client's own context, which is used by the
+// operations that are not given a context, so that it can be told apart
+// from a context given by the caller.
+type clientContext struct {
+	context.Context
+}
+
+// Release the resources held by the client. Close cancels any outstanding
+// requests, stops background token refresh and closes idle connections. The
+// client is unusable after Close, all subsequent requests fail with
+// context.Canceled.
+func (c *Client) Close() error {
+	closed := c.closedChan()
+	c.mu.Lock()
+	select {
+	case <-closed: // already closed
+	default:
+		close(closed)
+	}
+	c.mu.Unlock()
+	if h, ok := c.accessTokenHandler.(*ClientCredentialsHandler); ok {
+		h.Stop()
+	}
+	if c.HttpClient != nil {
+		c.HttpClient.CloseIdleConnections()
+	}
+	return nil
+}
+
+// Returns the channel that is closed when the client is closed.
+func (c *Client) closedChan() chan struct{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed == nil {
+		c.closed = make(chan struct{})
+	}
+	return c.closed
+}
+
+// Returns a context derived from the given one that is also cancelled when
+// the client is closed. The returned cancel function must be called to
+// release its resources.
+func (c *Client) closeContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	closed := c.closedChan()
+	select {
+	case <-closed:
+		cancel()
+		return ctx, cancel
+	default:
+	}
+	go func() {
+		select {
+		case <-closed:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// A response body that releases the request's context when closed.
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
 }
 
 func (c *Client) SetAccessTokenHandler(handler AccessTokenHandler) {
@@ -151,24 +302,28 @@ func (c *Client) Url(path string) string {
 	return fmt.Sprintf("%s://%s:%s%s", c.Scheme, c.Host, c.Port, path)
 }
 
-/* #nosec */
-const getAccessTokenBody = `{
-	"client_id": "%s",
-	"client_secret": "%s",
-	"audience": "%s",
-	"grant_type": "client_credentials"
-}`
-
 // Returns the current access token
 func (c *Client) AccessToken() (string, error) {
 	return c.accessTokenHandler.GetAccessToken()
 }
 
-// Fetch a new access token using the given client credentials.
+// Fetch a new access token using the given client credentials. If the
+// credentials do not specify an audience, the client's host is used.
 func (c *Client) GetAccessToken(creds *ClientCredentials) (*AccessToken, error) {
 	audience := creds.Audience
-	body := fmt.Sprintf(getAccessTokenBody, creds.ClientID, creds.ClientSecret, audience)
-	req, err := http.NewRequest(http.MethodPost, creds.ClientCredentialsUrl, strings.NewReader(body))
+	if audience == "" {
+		audience = fmt.Sprintf("https://%s", c.Host)
+	}
+	body, err := json.Marshal(&getAccessTokenRequest{
+		ClientID:     creds.ClientID,
+		ClientSecret: creds.ClientSecret,
+		Audience:     audience,
+		Scope:        creds.Scope,
+		GrantType:    "client_credentials"})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, creds.ClientCredentialsUrl, bytes.NewReader(body))
 	if err != nil {
 		return nil, err
 	}
@@ -185,6 +340,42 @@ func (c *Client) GetAccessToken(creds *ClientCredentials) (*AccessToken, error)
 	return token, nil
 }
 
+// Renew the given access token using its refresh token, without sending the
+// client secret. The new token keeps the given refresh token unless the
+// server issues a new one.
+func (c *Client) RefreshAccessToken(
+	tokenUrl, clientID string, token *AccessToken,
+) (*AccessToken, error) {
+	if token.RefreshToken == "" {
+		return nil, errors.New("access token has no refresh token")
+	}
+	body, err := json.Marshal(&refreshAccessTokenRequest{
+		ClientID:     clientID,
+		RefreshToken: token.RefreshToken,
+		GrantType:    "refresh_token"})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, tokenUrl, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	c.ensureHeaders(req, nil)
+	rsp, err := c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer rsp.Body.Close()
+	result := &AccessToken{}
+	if err = result.Load(rsp.Body); err != nil {
+		return nil, err
+	}
+	if result.RefreshToken == "" {
+		result.RefreshToken = token.RefreshToken
+	}
+	return result, nil
+}
+
 // Authenticate the given request using the configured credentials.
 func (c *Client) authenticate(req *http.Request) error {
 	token, err := c.AccessToken()
@@ -203,6 +394,9 @@ func (c *Client) ensureHeaders(req *http.Request, headers map[string]string) {
 	if v := req.Header.Get("content-type"); v == "" {
 		req.Header.Set("Content-Type", "application/json")
 	}
+	if v := req.Header.Get("accept-encoding"); v == "" {
+		req.Header.Set("Accept-Encoding", "gzip, deflate")
+	}
 	if v := req.Header.Get("user-agent"); v == "" {
 		req.Header.Set("User-Agent", userAgent)
 	}
@@ -217,7 +411,13 @@ func (c *Client) ensureHeaders(req *http.Request, headers map[string]string) {
 }
 
 func (c *Client) newRequest(method, path string, args url.Values, body io.Reader) (*http.Request, error) {
-	req, err := http.NewRequest(method, c.ensureUrl(path), body)
+	return c.newRequestContext(c.Context(), method, path, args, body)
+}
+
+func (c *Client) newRequestContext(
+	ctx context.Context, method, path string, args url.Values, body io.Reader,
+) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.ensureUrl(path), body)
 	if err != nil {
 		return nil, err
 	}
@@ -227,24 +427,59 @@ func (c *Client) newRequest(method, path string, args url.Values, body io.Reader
 	return req, nil
 }
 
+// The `...Context` variants of the client's operations, eg ListEnginesContext
+// or ExecuteContext, make their requests with the given context rather than
+// the client's context, so that deadlines and cancellation can be applied per
+// operation without affecting other requests made with the same client.
+
 func (c *Client) Delete(path string, args url.Values, data, result interface{}) error {
-	return c.request(http.MethodDelete, path, nil, args, data, result)
+	return c.DeleteContext(c.Context(), path, args, data, result)
+}
+
+func (c *Client) DeleteContext(
+	ctx context.Context, path string, args url.Values, data, result interface{},
+) error {
+	return c.requestContext(ctx, http.MethodDelete, path, nil, args, data, result)
 }
 
 func (c *Client) Get(path string, headers map[string]string, args url.Values, result interface{}) error {
-	return c.request(http.MethodGet, path, headers, args, nil, result)
+	return c.GetContext(c.Context(), path, headers, args, result)
+}
+
+func (c *Client) GetContext(
+	ctx context.Context, path string, headers map[string]string, args url.Values, result interface{},
+) error {
+	return c.requestContext(ctx, http.MethodGet, path, headers, args, nil, result)
 }
 
 func (c *Client) Patch(path string, args url.Values, data, result interface{}) error {
-	return c.request(http.MethodPatch, path, nil, args, data, result)
+	return c.PatchContext(c.Context(), path, args, data, result)
+}
+
+func (c *Client) PatchContext(
+	ctx context.Context, path string, args url.Values, data, result interface{},
+) error {
+	return c.requestContext(ctx, http.MethodPatch, path, nil, args, data, result)
 }
 
 func (c *Client) Post(path string, args url.Values, data, result interface{}) error {
-	return c.request(http.MethodPost, path, nil, args, data, result)
+	return c.PostContext(c.Context(), path, args, data, result)
+}
+
+func (c *Client) PostContext(
+	ctx context.Context, path string, args url.Values, data, result interface{},
+) error {
+	return c.requestContext(ctx, http.MethodPost, path, nil, args, data, result)
 }
 
 func (c *Client) Put(path string, args url.Values, data, result interface{}) error {
-	return c.request(http.MethodPut, path, nil, args, data, result)
+	return c.PutContext(c.Context(), path, args, data, result)
+}
+
+func (c *Client) PutContext(
+	ctx context.Context, path string, args url.Values, data, result interface{},
+) error {
+	return c.requestContext(ctx, http.MethodPut, path, nil, args, data, result)
 }
 
 // Marshal the given item as a JSON string and return an io.Reader.
@@ -281,12 +516,23 @@ func unmarshal(rsp *http.Response, result interface{}) error {
 // Construct request, execute and unmarshal response.
 func (c *Client) request(
 	method, path string, headers map[string]string, args url.Values, data, result interface{},
+) error {
+	return c.requestContext(c.Context(), method, path, headers, args, data, result)
+}
+
+// Construct request bound to the given context, execute and unmarshal response.
+func (c *Client) requestContext(
+	ctx context.Context,
+	method, path string, headers map[string]string, args url.Values, data, result interface{},
 ) error {
 	body, err := marshal(data)
 	if err != nil {
 		return err
 	}
-	req, err := c.newRequest(method, path, args, body)
+	if err := c.checkRequestSize(body); err != nil {
+		return err
+	}
+	req, err := c.newRequestContext(ctx, method, path, args, body)
 	if err != nil {
 		return err
 	}
@@ -294,10 +540,13 @@ func (c *Client) request(
 	if err := c.authenticate(req); err != nil {
 		return err
 	}
-	rsp, err := c.Do(req)
+	rsp, err := c.do(ctx, req)
 	if err != nil {
 		return err
 	}
+	if r, ok := result.(etagSetter); ok {
+		r.setETag(rsp.Header.Get("ETag"))
+	}
 	switch out := result.(type) {
 	case **http.Response:
 		*out = rsp // caller will handle response
@@ -307,6 +556,32 @@ func (c *Client) request(
 	return unmarshal(rsp, result)
 }
 
+// Implemented by response types that record the ETag of the resource.
+type etagSetter interface {
+	setETag(string)
+}
+
+func (r *getOAuthClientResponse) setETag(etag string) {
+	r.Client.ETag = etag
+}
+
+func (r *getUserResponse) setETag(etag string) {
+	r.User.ETag = etag
+}
+
+func (i *Integration) setETag(etag string) {
+	i.ETag = etag
+}
+
+// Returns the headers for a conditional request on the given ETag, or nil if
+// the request is unconditional.
+func ifMatch(etag string) map[string]string {
+	if etag == "" {
+		return nil
+	}
+	return map[string]string{"If-Match": etag}
+}
+
 type HTTPError struct {
 	StatusCode int
 	Headers    http.Header
@@ -322,12 +597,120 @@ func (e HTTPError) Error() string {
 	return fmt.Sprintf("%d %s %s", e.StatusCode, statusText, xRequestId)
 }
 
+// Answers if the target is a bare status error, eg ErrNotFound, with the same
+// status code as the receiver, so that errors.Is(err, ErrNotFound) holds for
+// any 404 response.
+func (e HTTPError) Is(target error) bool {
+	t, ok := target.(HTTPError)
+	if !ok {
+		return false
+	}
+	return t.StatusCode == e.StatusCode && t.Headers == nil && t.Body == ""
+}
+
 func newHTTPError(status int, headers http.Header, body string) error {
 	return HTTPError{StatusCode: status, Headers: headers, Body: body}
 }
 
 var ErrNotFound = newHTTPError(http.StatusNotFound, nil, "")
 
+// Returned by conditional updates when the resource's ETag no longer matches,
+// ie the resource was modified since it was read.
+var ErrConflict = newHTTPError(http.StatusPreconditionFailed, nil, "")
+
+var (
+	ErrEngineNotFound   = errors.New("engine not found")
+	ErrDatabaseNotFound = errors.New("database not found")
+)
+
+// NotFoundError is returned when the resource a request depends on does not
+// exist. It matches both the resource specific error, eg ErrEngineNotFound,
+// and ErrNotFound when using errors.Is.
+type NotFoundError struct {
+	HTTPError
+	Resource error
+}
+
+func (e NotFoundError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Resource.Error(), e.HTTPError.Error())
+}
+
+func (e NotFoundError) Is(target error) bool {
+	return target == e.Resource
+}
+
+func (e NotFoundError) Unwrap() error {
+	return e.HTTPError
+}
+
+// Returned when a request body is larger than the service, or the client's
+// MaxRequestBytes option, allows. Large CSV data can be loaded in smaller
+// requests using LoadCSVBatched.
+var ErrRequestTooLarge = errors.New("request too large")
+
+// RequestTooLargeError is returned when the service rejects a request because
+// its body is too large. It matches ErrRequestTooLarge when using errors.Is.
+type RequestTooLargeError struct {
+	HTTPError
+}
+
+func (e RequestTooLargeError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrRequestTooLarge.Error(), e.HTTPError.Error())
+}
+
+func (e RequestTooLargeError) Is(target error) bool {
+	return target == ErrRequestTooLarge
+}
+
+func (e RequestTooLargeError) Unwrap() error {
+	return e.HTTPError
+}
+
+// Returns an error matching ErrRequestTooLarge if the given request body is
+// larger than the client's MaxRequestBytes, so that oversized requests fail
+// before they are sent.
+func (c *Client) checkRequestSize(body io.Reader) error {
+	r, ok := body.(*strings.Reader)
+	if !ok || c.maxRequestBytes <= 0 {
+		return nil
+	}
+	if size := r.Size(); size > c.maxRequestBytes {
+		return errors.Wrapf(ErrRequestTooLarge,
+			"body is %d bytes, limit is %d bytes", size, c.maxRequestBytes)
+	}
+	return nil
+}
+
+// Returns the message from the given error response body, which is either a
+// JSON object with a message field or plain text.
+func errorMessage(body string) string {
+	var rsp struct {
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal([]byte(body), &rsp); err == nil && rsp.Message != "" {
+		return rsp.Message
+	}
+	return body
+}
+
+// Returns the resource specific error for the given 404 response body, or nil
+// if the missing resource can't be identified.
+func notFoundResource(body string) error {
+	msg := strings.ToLower(errorMessage(body))
+	engine := strings.Index(msg, "engine")
+	if i := strings.Index(msg, "compute"); i >= 0 && (engine < 0 || i < engine) {
+		engine = i
+	}
+	database := strings.Index(msg, "database")
+	switch {
+	case engine >= 0 && (database < 0 || engine < database):
+		return ErrEngineNotFound
+	case database >= 0:
+		return ErrDatabaseNotFound
+	}
+	return nil
+}
+
 // Returns an HTTPError corresponding to the given response.
 func httpError(rsp *http.Response) error {
 	// assert rsp.Status < 200 || rsp.Status > 299
@@ -335,7 +718,16 @@ func httpError(rsp *http.Response) error {
 	if err != nil {
 		data = []byte{}
 	}
-	return newHTTPError(rsp.StatusCode, rsp.Header, string(data))
+	e := HTTPError{StatusCode: rsp.StatusCode, Headers: rsp.Header, Body: string(data)}
+	switch rsp.StatusCode {
+	case http.StatusNotFound:
+		if resource := notFoundResource(e.Body); resource != nil {
+			return NotFoundError{e, resource}
+		}
+	case http.StatusRequestEntityTooLarge:
+		return RequestTooLargeError{e}
+	}
+	return e
 }
 
 // Ansers if the given response has a status code representing an error.
@@ -343,16 +735,83 @@ func isErrorStatus(rsp *http.Response) bool {
 	return rsp.StatusCode < 200 || rsp.StatusCode > 299
 }
 
+// A response body that is decompressed as it is read.
+type decompressReader struct {
+	io.Reader
+	body io.ReadCloser // compressed body
+}
+
+func (r decompressReader) Close() error {
+	if c, ok := r.Reader.(io.Closer); ok {
+		c.Close()
+	}
+	return r.body.Close()
+}
+
+// Replace the body of the given response with its decompressed content if
+// the response has a gzip or deflate content encoding. The transport only
+// decompresses responses transparently when it added the Accept-Encoding
+// header itself, so responses to requests that set it are decoded here.
+func decompressResponse(rsp *http.Response) error {
+	var r io.Reader
+	var err error
+	switch strings.ToLower(rsp.Header.Get("Content-Encoding")) {
+	case "gzip":
+		r, err = gzip.NewReader(rsp.Body)
+	case "deflate":
+		r, err = zlib.NewReader(rsp.Body)
+	default:
+		return nil
+	}
+	if err == io.EOF {
+		r, err = strings.NewReader(""), nil // empty body
+	}
+	if err != nil {
+		rsp.Body.Close()
+		return errors.Wrap(err, "failed to decompress response")
+	}
+	rsp.Body = decompressReader{r, rsp.Body}
+	rsp.Header.Del("Content-Encoding")
+	rsp.Header.Del("Content-Length")
+	rsp.ContentLength = -1
+	rsp.Uncompressed = true
+	return nil
+}
+
 // Execute the given request and return the response or error.
 func (c *Client) Do(req *http.Request) (*http.Response, error) {
-	req = req.WithContext(c.ctx)
+	return c.do(c.Context(), req)
+}
+
+// Execute the given request bound to the given context, rather than the
+// client's context, and return the response or error.
+func (c *Client) DoContext(ctx context.Context, req *http.Request) (*http.Response, error) {
+	return c.do(ctx, req)
+}
+
+// Execute the given request bound to the given context.
+func (c *Client) do(ctx context.Context, req *http.Request) (*http.Response, error) {
+	ctx, cancel := c.closeContext(ctx)
+	req = req.WithContext(ctx)
 	if c.preRequestHook != nil {
 		req = c.preRequestHook(req)
 	}
+	if c.debug != nil {
+		showRequest(c.debug, req)
+	}
 	rsp, err := c.HttpClient.Do(req)
 	if err != nil {
+		cancel()
+		return nil, err
+	}
+	if c.debug != nil {
+		showResponse(c.debug, rsp)
+	}
+	if err := decompressResponse(rsp); err != nil {
+		cancel()
 		return nil, err
 	}
+	rsp.Body = cancelBody{rsp.Body, cancel}
 	if isErrorStatus(rsp) {
 		defer rsp.Body.Close()
 		return nil, httpError(rsp)
@@ -360,6 +819,39 @@ func (c *Client) Do(req *http.Request) (*http.Response, error) {
 	return rsp, nil
 }
 
+// Enable tracing of requests and responses to the given writer, or disable
+// tracing if the writer is nil. This should not be called while requests are
+// in flight.
+func (c *Client) SetDebug(w io.Writer) {
+	c.debug = w
+}
+
+// Write the given headers, in sorted order, with credentials redacted.
+func showHeaders(w io.Writer, prefix string, h http.Header) {
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		v := strings.Join(h[k], ", ")
+		if http.CanonicalHeaderKey(k) == "Authorization" {
+			v = "<redacted>"
+		}
+		fmt.Fprintf(w, "%s%s: %s\n", prefix, k, v)
+	}
+}
+
+func showRequest(w io.Writer, req *http.Request) {
+	fmt.Fprintf(w, "> %s %s\n", req.Method, req.URL.String())
+	showHeaders(w, "> ", req.Header)
+}
+
+func showResponse(w io.Writer, rsp *http.Response) {
+	fmt.Fprintf(w, "< %s\n", rsp.Status)
+	showHeaders(w, "< ", rsp.Header)
+}
+
 //
 // RAI APIs
 //
@@ -457,9 +949,15 @@ func queryArgs(filters ...interface{}) (url.Values, error) {
 //
 
 func (c *Client) CloneDatabase(database, source string) (*Database, error) {
+	return c.CloneDatabaseContext(c.Context(), database, source)
+}
+
+func (c *Client) CloneDatabaseContext(
+	ctx context.Context, database, source string,
+) (*Database, error) {
 	var result createDatabaseResponse
 	data := &createDatabaseRequest{Name: database, Source: source}
-	err := c.Put(PathDatabase, nil, data, &result)
+	err := c.PutContext(ctx, PathDatabase, nil, data, &result)
 	if err != nil {
 		return nil, err
 	}
@@ -467,9 +965,13 @@ func (c *Client) CloneDatabase(database, source string) (*Database, error) {
 }
 
 func (c *Client) CreateDatabase(database string) (*Database, error) {
+	return c.CreateDatabaseContext(c.Context(), database)
+}
+
+func (c *Client) CreateDatabaseContext(ctx context.Context, database string) (*Database, error) {
 	var result createDatabaseResponse
 	data := &createDatabaseRequest{Name: database}
-	err := c.Put(PathDatabase, nil, data, &result)
+	err := c.PutContext(ctx, PathDatabase, nil, data, &result)
 	if err != nil {
 		return nil, err
 	}
@@ -477,34 +979,98 @@ func (c *Client) CreateDatabase(database string) (*Database, error) {
 }
 
 func (c *Client) DeleteDatabase(database string) error {
+	return c.DeleteDatabaseContext(c.Context(), database)
+}
+
+func (c *Client) DeleteDatabaseContext(ctx context.Context, database string) error {
 	var result deleteDatabaseResponse
 	data := &deleteDatabaseRequest{Name: database}
-	return c.Delete(PathDatabase, nil, data, &result)
+	return c.DeleteContext(ctx, PathDatabase, nil, data, &result)
+}
+
+// Deletes the given databases, returning the result of each deletion by
+// database name, where databases that do not exist are deleted successfully.
+// A failure to delete one database does not prevent the deletion of the
+// others.
+func (c *Client) DeleteDatabases(databases []string) map[string]error {
+	return c.DeleteDatabasesContext(c.Context(), databases)
+}
+
+func (c *Client) DeleteDatabasesContext(ctx context.Context, databases []string) map[string]error {
+	return c.DeleteDatabasesParallelContext(ctx, 1, databases)
+}
+
+// Deletes the given databases, as `DeleteDatabases` does, making up to
+// `concurrency` requests at a time.
+func (c *Client) DeleteDatabasesParallel(concurrency int, databases []string) map[string]error {
+	return c.DeleteDatabasesParallelContext(c.Context(), concurrency, databases)
+}
+
+func (c *Client) DeleteDatabasesParallelContext(
+	ctx context.Context, concurrency int, databases []string,
+) map[string]error {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	results := make([]error, len(databases))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency && w < len(databases); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				err := c.DeleteDatabaseContext(ctx, databases[i])
+				if errors.Is(err, ErrNotFound) {
+					err = nil
+				}
+				results[i] = err
+			}
+		}()
+	}
+	for i := range databases {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	result := make(map[string]error, len(databases))
+	for i, database := range databases {
+		result[database] = results[i]
+	}
+	return result
 }
 
 func (c *Client) GetDatabase(database string) (*Database, error) {
+	return c.GetDatabaseContext(c.Context(), database)
+}
+
+func (c *Client) GetDatabaseContext(ctx context.Context, database string) (*Database, error) {
 	args, err := queryArgs("name", database)
 	if err != nil {
 		return nil, err
 	}
 	var result getDatabaseResponse
-	err = c.Get(PathDatabase, nil, args, &result)
+	err = c.GetContext(ctx, PathDatabase, nil, args, &result)
 	if err != nil {
 		return nil, err
 	}
 	if len(result.Databases) == 0 {
-		return nil, ErrNotFound
+		return nil, NotFoundError{ErrNotFound.(HTTPError), ErrDatabaseNotFound}
 	}
 	return &result.Databases[0], nil
 }
 
 func (c *Client) ListDatabases(filters ...interface{}) ([]Database, error) {
+	return c.ListDatabasesContext(c.Context(), filters...)
+}
+
+func (c *Client) ListDatabasesContext(ctx context.Context, filters ...interface{}) ([]Database, error) {
 	args, err := queryArgs(filters...)
 	if err != nil {
 		return nil, err
 	}
 	var result listDatabasesResponse
-	err = c.Get(PathDatabase, nil, args, &result)
+	err = c.GetContext(ctx, PathDatabase, nil, args, &result)
 	if err != nil {
 		return nil, err
 	}
@@ -520,105 +1086,392 @@ func isTerminalState(state, targetState string) bool {
 	return state == targetState || strings.Contains(state, "FAILED")
 }
 
-// Request the creation of an engine, and wait for the opeartion to complete.
-// This can block the caller for up to a minute.
-func (c *Client) CreateEngine(engine, size string) (*Engine, error) {
-	rsp, err := c.CreateEngineAsync(engine, size)
-	if err != nil {
-		return nil, err
-	}
-	for !isTerminalState(rsp.State, "PROVISIONED") {
-		time.Sleep(5 * time.Second)
-		if rsp, err = c.GetEngine(engine); err != nil {
-			return nil, err
-		}
-	}
-	return rsp, nil
+// Pause for the given duration, returning early with the context's error if
+// the context is done first.
+// Sleeps as sleepContext does, and also returns early if the client is
+// closed.
+func (c *Client) sleep(ctx context.Context, d time.Duration) error {
+	ctx, cancel := c.closeContext(ctx)
+	defer cancel()
+	return sleepContext(ctx, d)
 }
 
-// Request the creation of an engine, and immediately return. The process
-// of provisioning a new engine can take up to a minute.
-func (c *Client) CreateEngineAsync(engine, size string) (*Engine, error) {
-	var result createEngineResponse
-	data := &createEngineRequest{Region: c.Region, Name: engine, Size: size}
-	err := c.Put(PathEngine, nil, data, &result)
-	if err != nil {
-		return nil, err
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
 	}
-	return &result.Engine, nil
 }
 
-// Request the deletion of an engine and wait for the operation to complete.
-func (c *Client) DeleteEngine(engine string) error {
-	rsp, err := c.DeleteEngineAsync(engine)
-	if err != nil {
-		return err
-	}
-	for !isTerminalState(rsp.State, "DELETED") {
-		time.Sleep(3 * time.Second)
-		if rsp, err = c.GetEngine(engine); err != nil {
-			if e, ok := err.(HTTPError); ok {
-				if e.StatusCode == ErrNotFound.(HTTPError).StatusCode {
-					return nil // successfully deleted
-				}
-			}
-			return err
-		}
-	}
-	return nil
+// Optional settings for engine creation. Tags are key/value labels attached
+// to the engine, eg for attributing usage to a team or project.
+type CreateEngineOptions struct {
+	Tags   map[string]string
+	Region string // overrides the client's region, if not empty
 }
 
-func (c *Client) DeleteEngineAsync(engine string) (*Engine, error) {
-	var result deleteEngineResponse
-	data := &deleteEngineRequest{Name: engine}
-	err := c.Delete(PathEngine, nil, data, &result)
+// Request the creation of an engine, and wait for the opeartion to complete.
+// This can block the caller for up to a minute. CreateEngine is equivalent to
+// CreateEngineAsync followed by WaitForEngine, which can be called
+// separately to wait with other options, or replaced by custom waiting.
+func (c *Client) CreateEngine(engine, size string, opts ...CreateEngineOptions) (*Engine, error) {
+	return c.CreateEngineContext(c.Context(), engine, size, opts...)
+}
+
+// Request the creation of an engine, and wait for the operation to complete
+// or for the given context to be done, whichever comes first. Use a context
+// with a deadline to bound the wait.
+func (c *Client) CreateEngineContext(
+	ctx context.Context, engine, size string, opts ...CreateEngineOptions,
+) (*Engine, error) {
+	rsp, err := c.CreateEngineAsyncContext(ctx, engine, size, opts...)
 	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
 		return nil, err
 	}
-	return c.GetEngine(engine) // normalize return type
+	return c.waitForEngineProvisioned(ctx, engine, rsp, 5*time.Second)
 }
 
-func (c *Client) GetEngine(engine string) (*Engine, error) {
-	args, err := queryArgs("name", engine, "deleted_on", "")
-	if err != nil {
-		return nil, err
-	}
-	var result getEngineResponse
-	err = c.Get(PathEngine, nil, args, &result)
+// Wait for the given engine to be provisioned, eg after CreateEngineAsync.
+// If provisioning fails, the engine is returned along with an
+// EngineProvisionError.
+func (c *Client) WaitForEngine(engine string, opts *EngineWaitOptions) (*Engine, error) {
+	return c.WaitForEngineContext(c.Context(), engine, opts)
+}
+
+// Wait for the given engine to be provisioned, or for the context to be
+// done, whichever comes first.
+func (c *Client) WaitForEngineContext(
+	ctx context.Context, engine string, opts *EngineWaitOptions,
+) (*Engine, error) {
+	ctx, interval, cancel := engineWaitContext(ctx, opts)
+	defer cancel()
+	rsp, err := c.GetEngineContext(ctx, engine)
 	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
 		return nil, err
 	}
-	if len(result.Engines) == 0 {
-		return nil, ErrNotFound
-	}
-	return &result.Engines[0], nil
+	return c.waitForEngineProvisioned(ctx, engine, rsp, interval)
 }
 
-func (c *Client) ListEngines(filters ...interface{}) ([]Engine, error) {
-	args, err := queryArgs(filters...)
+// Poll the given engine until it is provisioned, returning an
+// EngineProvisionError if provisioning fails.
+func (c *Client) waitForEngineProvisioned(
+	ctx context.Context, engine string, rsp *Engine, interval time.Duration,
+) (*Engine, error) {
+	rsp, err := c.waitForEngine(ctx, engine, rsp, "PROVISIONED", interval)
 	if err != nil {
 		return nil, err
 	}
-	var result listEnginesResponse
-	err = c.Get(PathEngine, nil, args, &result)
-	if err != nil {
-		return nil, err
+	if rsp.State != "PROVISIONED" {
+		return rsp, EngineProvisionError{Engine: rsp}
 	}
-	return result.Engines, nil
+	return rsp, nil
 }
 
-func (c *Client) StartEngine(engineName string) error {
-	var result interface{}
-	data := &SuspendEngineRequest{Suspend: false}
+var ErrEngineProvisionFailed = errors.New("engine provisioning failed")
+
+// EngineProvisionError is returned, along with the engine, when engine
+// creation ends in a failed state. The engine's `StateReason` carries the
+// service's explanation of the failure, if any. It matches both
+// ErrEngineProvisionFailed and ErrEngineFailed when using errors.Is.
+type EngineProvisionError struct {
+	Engine *Engine
+}
+
+func (e EngineProvisionError) Error() string {
+	msg := fmt.Sprintf("engine '%s' is in state %s", e.Engine.Name, e.Engine.State)
+	if e.Engine.StateReason != "" {
+		msg += ": " + e.Engine.StateReason
+	}
+	return msg
+}
+
+func (e EngineProvisionError) Is(target error) bool {
+	return target == ErrEngineProvisionFailed || target == ErrEngineFailed
+}
+
+// Poll the given engine until it reaches the target state or fails.
+func (c *Client) waitForEngine(
+	ctx context.Context, engine string, rsp *Engine, targetState string, interval time.Duration,
+) (*Engine, error) {
+	var err error
+	for !isTerminalState(rsp.State, targetState) {
+		if err := c.sleep(ctx, interval); err != nil {
+			return nil, err
+		}
+		if rsp, err = c.GetEngineContext(ctx, engine); err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return nil, err
+		}
+	}
+	return rsp, nil
+}
+
+var ErrEngineFailed = errors.New("engine failed")
+
+// Optional settings for waiting on an engine state.
+type EngineWaitOptions struct {
+	Interval time.Duration // time between polls, default 5s
+	Timeout  time.Duration // maximum time to wait, zero means no limit
+}
+
+// Returns the context and poll interval for waiting on an engine with the
+// given options, and the function that releases the context.
+func engineWaitContext(
+	ctx context.Context, opts *EngineWaitOptions,
+) (context.Context, time.Duration, context.CancelFunc) {
+	interval := 5 * time.Second
+	cancel := context.CancelFunc(func() {})
+	if opts != nil {
+		if opts.Interval > 0 {
+			interval = opts.Interval
+		}
+		if opts.Timeout > 0 {
+			ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		}
+	}
+	return ctx, interval, cancel
+}
+
+// Wait for the given engine to reach the target state, eg "SUSPENDED" after
+// suspending the engine. If the engine enters a failed state instead, the
+// engine is returned along with an error matching ErrEngineFailed.
+func (c *Client) WaitForEngineState(
+	engine, targetState string, opts *EngineWaitOptions,
+) (*Engine, error) {
+	return c.WaitForEngineStateContext(c.Context(), engine, targetState, opts)
+}
+
+// Wait for the given engine to reach the target state, or for the context to
+// be done, whichever comes first.
+func (c *Client) WaitForEngineStateContext(
+	ctx context.Context, engine, targetState string, opts *EngineWaitOptions,
+) (*Engine, error) {
+	ctx, interval, cancel := engineWaitContext(ctx, opts)
+	defer cancel()
+	rsp, err := c.GetEngineContext(ctx, engine)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+	if rsp, err = c.waitForEngine(ctx, engine, rsp, targetState, interval); err != nil {
+		return nil, err
+	}
+	if rsp.State != targetState {
+		if rsp.StateReason != "" {
+			return rsp, errors.Wrapf(
+				ErrEngineFailed, "engine '%s' is in state %s: %s", engine, rsp.State, rsp.StateReason)
+		}
+		return rsp, errors.Wrapf(ErrEngineFailed, "engine '%s' is in state %s", engine, rsp.State)
+	}
+	return rsp, nil
+}
+
+// Request the creation of an engine, and immediately return. The process
+// of provisioning a new engine can take up to a minute.
+func (c *Client) CreateEngineAsync(engine, size string, opts ...CreateEngineOptions) (*Engine, error) {
+	return c.CreateEngineAsyncContext(c.Context(), engine, size, opts...)
+}
+
+func (c *Client) CreateEngineAsyncContext(
+	ctx context.Context, engine, size string, opts ...CreateEngineOptions,
+) (*Engine, error) {
+	var result createEngineResponse
+	data := &createEngineRequest{Region: c.Region, Name: engine, Size: size}
+	for _, opt := range opts {
+		if opt.Region != "" {
+			data.Region = opt.Region
+		}
+		for k, v := range opt.Tags {
+			if data.Tags == nil {
+				data.Tags = map[string]string{}
+			}
+			data.Tags[k] = v
+		}
+	}
+	err := c.requestContext(ctx, http.MethodPut, PathEngine, nil, nil, data, &result)
+	if err != nil {
+		return nil, err
+	}
+	return &result.Engine, nil
+}
+
+// Request the deletion of an engine and wait for the operation to complete.
+func (c *Client) DeleteEngine(engine string) error {
+	return c.DeleteEngineContext(c.Context(), engine)
+}
+
+// Request the deletion of an engine and wait for the operation to complete or
+// for the given context to be done, whichever comes first.
+func (c *Client) DeleteEngineContext(ctx context.Context, engine string) error {
+	rsp, err := c.DeleteEngineAsyncContext(ctx, engine)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return err
+	}
+	for !isTerminalState(rsp.State, "DELETED") {
+		if err := c.sleep(ctx, 3*time.Second); err != nil {
+			return err
+		}
+		if rsp, err = c.GetEngineContext(ctx, engine); err != nil {
+			if errors.Is(err, ErrNotFound) {
+				return nil // successfully deleted
+			}
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Client) DeleteEngineAsync(engine string) (*Engine, error) {
+	return c.DeleteEngineAsyncContext(c.Context(), engine)
+}
+
+func (c *Client) DeleteEngineAsyncContext(ctx context.Context, engine string) (*Engine, error) {
+	var result deleteEngineResponse
+	data := &deleteEngineRequest{Name: engine}
+	err := c.requestContext(ctx, http.MethodDelete, PathEngine, nil, nil, data, &result)
+	if err != nil {
+		return nil, err
+	}
+	return c.GetEngineContext(ctx, engine) // normalize return type
+}
+
+func (c *Client) GetEngine(engine string) (*Engine, error) {
+	return c.GetEngineContext(c.Context(), engine)
+}
+
+func (c *Client) GetEngineContext(ctx context.Context, engine string) (*Engine, error) {
+	args, err := queryArgs("name", engine, "deleted_on", "")
+	if err != nil {
+		return nil, err
+	}
+	var result getEngineResponse
+	err = c.requestContext(ctx, http.MethodGet, PathEngine, nil, args, nil, &result)
+	if err != nil {
+		return nil, err
+	}
+	if len(result.Engines) == 0 {
+		return nil, NotFoundError{ErrNotFound.(HTTPError), ErrEngineNotFound}
+	}
+	return &result.Engines[0], nil
+}
+
+func (c *Client) ListEngines(filters ...interface{}) ([]Engine, error) {
+	return c.ListEnginesContext(c.Context(), filters...)
+}
+
+func (c *Client) ListEnginesContext(ctx context.Context, filters ...interface{}) ([]Engine, error) {
+	args, err := queryArgs(filters...)
+	if err != nil {
+		return nil, err
+	}
+	var result listEnginesResponse
+	err = c.GetContext(ctx, PathEngine, nil, args, &result)
+	if err != nil {
+		return nil, err
+	}
+	return result.Engines, nil
+}
+
+// Returns the engines that run the given version, selected from the engines
+// matching the optional filters. Version is matched on the client, since the
+// service does not filter engines by version.
+func (c *Client) ListEnginesWithVersion(version string, filters ...interface{}) ([]Engine, error) {
+	return c.ListEnginesWithVersionContext(c.Context(), version, filters...)
+}
+
+func (c *Client) ListEnginesWithVersionContext(
+	ctx context.Context, version string, filters ...interface{},
+) ([]Engine, error) {
+	engines, err := c.ListEnginesContext(ctx, filters...)
+	if err != nil {
+		return nil, err
+	}
+	result := []Engine{}
+	for _, engine := range engines {
+		if engine.Version == version {
+			result = append(result, engine)
+		}
+	}
+	return result, nil
+}
+
+func (c *Client) StartEngine(engineName string) error {
+	return c.StartEngineContext(c.Context(), engineName)
+}
+
+func (c *Client) StartEngineContext(ctx context.Context, engineName string) error {
+	var result interface{}
+	data := &SuspendEngineRequest{Suspend: false}
 	uri := makePath(PathEngine, engineName)
-	return c.Patch(uri, nil, data, &result)
+	return c.PatchContext(ctx, uri, nil, data, &result)
 }
 
 func (c *Client) StopEngine(engineName string) error {
+	return c.StopEngineContext(c.Context(), engineName)
+}
+
+func (c *Client) StopEngineContext(ctx context.Context, engineName string) error {
 	var result interface{}
 	data := &SuspendEngineRequest{Suspend: true}
 	uri := makePath(PathEngine, engineName)
-	return c.Patch(uri, nil, data, &result)
+	return c.PatchContext(ctx, uri, nil, data, &result)
+}
+
+// Returns the first of the given wait options, if any.
+func waitOptions(opts []EngineWaitOptions) *EngineWaitOptions {
+	if len(opts) == 0 {
+		return nil
+	}
+	return &opts[0]
+}
+
+// Suspend the given engine and wait for it to reach the SUSPENDED state.
+func (c *Client) SuspendEngine(engine string, opts ...EngineWaitOptions) error {
+	return c.SuspendEngineContext(c.Context(), engine, opts...)
+}
+
+func (c *Client) SuspendEngineContext(
+	ctx context.Context, engine string, opts ...EngineWaitOptions,
+) error {
+	if err := c.StopEngineContext(ctx, engine); err != nil {
+		return err
+	}
+	_, err := c.WaitForEngineStateContext(ctx, engine, "SUSPENDED", waitOptions(opts))
+	return err
+}
+
+// Resume the given suspended engine and wait for it to be PROVISIONED.
+func (c *Client) ResumeEngine(engine string, opts ...EngineWaitOptions) (*Engine, error) {
+	return c.ResumeEngineContext(c.Context(), engine, opts...)
+}
+
+func (c *Client) ResumeEngineContext(
+	ctx context.Context, engine string, opts ...EngineWaitOptions,
+) (*Engine, error) {
+	if err := c.StartEngineContext(ctx, engine); err != nil {
+		return nil, err
+	}
+	return c.WaitForEngineStateContext(ctx, engine, "PROVISIONED", waitOptions(opts))
 }
 
 //
@@ -627,10 +1480,16 @@ func (c *Client) StopEngine(engineName string) error {
 
 func (c *Client) CreateOAuthClient(
 	name string, perms []string,
+) (*OAuthClientExtra, error) {
+	return c.CreateOAuthClientContext(c.Context(), name, perms)
+}
+
+func (c *Client) CreateOAuthClientContext(
+	ctx context.Context, name string, perms []string,
 ) (*OAuthClientExtra, error) {
 	var result createOAuthClientResponse
 	data := createOAuthClientRequest{Name: name, Permissions: perms}
-	err := c.Post(PathOAuthClients, nil, data, &result)
+	err := c.PostContext(ctx, PathOAuthClients, nil, data, &result)
 	if err != nil {
 		return nil, err
 	}
@@ -638,8 +1497,14 @@ func (c *Client) CreateOAuthClient(
 }
 
 func (c *Client) DeleteOAuthClient(id string) (*DeleteOAuthClientResponse, error) {
+	return c.DeleteOAuthClientContext(c.Context(), id)
+}
+
+func (c *Client) DeleteOAuthClientContext(
+	ctx context.Context, id string,
+) (*DeleteOAuthClientResponse, error) {
 	var result DeleteOAuthClientResponse
-	err := c.Delete(makePath(PathOAuthClients, id), nil, nil, &result)
+	err := c.DeleteContext(ctx, makePath(PathOAuthClients, id), nil, nil, &result)
 	if err != nil {
 		return nil, err
 	}
@@ -648,7 +1513,11 @@ func (c *Client) DeleteOAuthClient(id string) (*DeleteOAuthClientResponse, error
 
 // Returns the OAuth client with the given name or ErrNotFound if it does not exist.
 func (c *Client) FindOAuthClient(name string) (*OAuthClient, error) {
-	clients, err := c.ListOAuthClients()
+	return c.FindOAuthClientContext(c.Context(), name)
+}
+
+func (c *Client) FindOAuthClientContext(ctx context.Context, name string) (*OAuthClient, error) {
+	clients, err := c.ListOAuthClientsContext(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -661,8 +1530,12 @@ func (c *Client) FindOAuthClient(name string) (*OAuthClient, error) {
 }
 
 func (c *Client) GetOAuthClient(id string) (*OAuthClientExtra, error) {
+	return c.GetOAuthClientContext(c.Context(), id)
+}
+
+func (c *Client) GetOAuthClientContext(ctx context.Context, id string) (*OAuthClientExtra, error) {
 	var result getOAuthClientResponse
-	err := c.Get(makePath(PathOAuthClients, id), nil, nil, &result)
+	err := c.GetContext(ctx, makePath(PathOAuthClients, id), nil, nil, &result)
 	if err != nil {
 		return nil, err
 	}
@@ -670,8 +1543,12 @@ func (c *Client) GetOAuthClient(id string) (*OAuthClientExtra, error) {
 }
 
 func (c *Client) ListOAuthClients() ([]OAuthClient, error) {
+	return c.ListOAuthClientsContext(c.Context())
+}
+
+func (c *Client) ListOAuthClientsContext(ctx context.Context) ([]OAuthClient, error) {
 	var result listOAuthClientsResponse
-	err := c.Get(PathOAuthClients, nil, nil, &result)
+	err := c.GetContext(ctx, PathOAuthClients, nil, nil, &result)
 	if err != nil {
 		return nil, err
 	}
@@ -682,14 +1559,45 @@ func (c *Client) ListOAuthClients() ([]OAuthClient, error) {
 // Models
 //
 
+// Returns the hex encoded SHA-256 digest of the given model source, which can
+// be compared with the Hash of an installed model to decide whether the
+// source needs to be loaded again.
+func ModelHash(source string) string {
+	sum := sha256.Sum256([]byte(source))
+	return hex.EncodeToString(sum[:])
+}
+
+// Decode the model and compute its hash and size from its source, since the
+// service returns only the model's name and value.
+func (m *Model) UnmarshalJSON(data []byte) error {
+	type model Model // without the UnmarshalJSON method
+	if err := json.Unmarshal(data, (*model)(m)); err != nil {
+		return err
+	}
+	m.Hash, m.Size = ModelHash(m.Value), len(m.Value)
+	return nil
+}
+
 func (c *Client) DeleteModel(
 	database, engine, name string,
 ) (*TransactionResult, error) {
-	return c.DeleteModels(database, engine, []string{name})
+	return c.DeleteModelContext(c.Context(), database, engine, name)
+}
+
+func (c *Client) DeleteModelContext(
+	ctx context.Context, database, engine, name string,
+) (*TransactionResult, error) {
+	return c.DeleteModelsContext(ctx, database, engine, []string{name})
 }
 
 func (c *Client) DeleteModels(
 	database, engine string, models []string,
+) (*TransactionResult, error) {
+	return c.DeleteModelsContext(c.Context(), database, engine, models)
+}
+
+func (c *Client) DeleteModelsContext(
+	ctx context.Context, database, engine string, models []string,
 ) (*TransactionResult, error) {
 	var result TransactionResult
 	tx := TransactionV1{
@@ -699,18 +1607,64 @@ func (c *Client) DeleteModels(
 		Mode:     "OPEN",
 		Readonly: false}
 	data := tx.Payload(makeDeleteModelsAction(models))
-	err := c.Post(PathTransaction, tx.QueryArgs(), data, &result)
+	err := c.PostContext(ctx, PathTransaction, tx.QueryArgs(), data, &result)
 	if err != nil {
 		return nil, err
 	}
 	return &result, err
 }
 
+// Deletes the given models, reporting which existed and were deleted and
+// which were not found. Models that do not exist are not included in the
+// delete request, so the operation can be safely repeated.
+func (c *Client) DeleteModelsWithResult(
+	database, engine string, models []string,
+) (*DeleteModelsResult, error) {
+	return c.DeleteModelsWithResultContext(c.Context(), database, engine, models)
+}
+
+func (c *Client) DeleteModelsWithResultContext(
+	ctx context.Context, database, engine string, models []string,
+) (*DeleteModelsResult, error) {
+	names, err := c.ListModelNamesContext(ctx, database, engine)
+	if err != nil {
+		return nil, err
+	}
+	exists := map[string]bool{}
+	for _, name := range names {
+		exists[name] = true
+	}
+	result := &DeleteModelsResult{Deleted: []string{}, NotFound: []string{}}
+	for _, model := range models {
+		if exists[model] {
+			result.Deleted = append(result.Deleted, model)
+		} else {
+			result.NotFound = append(result.NotFound, model)
+		}
+	}
+	if len(result.Deleted) == 0 {
+		return result, nil
+	}
+	rsp, err := c.DeleteModelsContext(ctx, database, engine, result.Deleted)
+	if err != nil {
+		return nil, err
+	}
+	result.Result = rsp
+	if rsp.Aborted {
+		return result, errors.New("delete models transaction aborted")
+	}
+	return result, nil
+}
+
 func (c *Client) GetModel(database, engine, model string) (*Model, error) {
+	return c.GetModelContext(c.Context(), database, engine, model)
+}
+
+func (c *Client) GetModelContext(ctx context.Context, database, engine, model string) (*Model, error) {
 	var result listModelsResponse
 	tx := NewTransaction(c.Region, database, engine, "OPEN")
 	data := tx.Payload(makeListModelsAction())
-	err := c.Post(PathTransaction, tx.QueryArgs(), data, &result)
+	err := c.PostContext(ctx, PathTransaction, tx.QueryArgs(), data, &result)
 	if err != nil {
 		return nil, err
 	}
@@ -726,11 +1680,46 @@ func (c *Client) GetModel(database, engine, model string) (*Model, error) {
 func (c *Client) LoadModel(
 	database, engine, name string, r io.Reader,
 ) (*TransactionResult, error) {
-	return c.LoadModels(database, engine, map[string]io.Reader{name: r})
+	return c.LoadModelContext(c.Context(), database, engine, name, r)
+}
+
+func (c *Client) LoadModelContext(
+	ctx context.Context, database, engine, name string, r io.Reader,
+) (*TransactionResult, error) {
+	return c.LoadModelsContext(ctx, database, engine, map[string]io.Reader{name: r})
 }
 
+// Loads the given models, in order of model name.
 func (c *Client) LoadModels(
 	database, engine string, models map[string]io.Reader,
+) (*TransactionResult, error) {
+	return c.LoadModelsContext(c.Context(), database, engine, models)
+}
+
+func (c *Client) LoadModelsContext(
+	ctx context.Context, database, engine string, models map[string]io.Reader,
+) (*TransactionResult, error) {
+	names := make([]string, 0, len(models))
+	for name := range models {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	sources := make([]NamedModel, len(names))
+	for i, name := range names {
+		sources[i] = NamedModel{name, models[name]}
+	}
+	return c.LoadModelsOrderedContext(ctx, database, engine, sources)
+}
+
+// Loads the given models in a single transaction, in the given order.
+func (c *Client) LoadModelsOrdered(
+	database, engine string, models []NamedModel,
+) (*TransactionResult, error) {
+	return c.LoadModelsOrderedContext(c.Context(), database, engine, models)
+}
+
+func (c *Client) LoadModelsOrderedContext(
+	ctx context.Context, database, engine string, models []NamedModel,
 ) (*TransactionResult, error) {
 	var result TransactionResult
 	tx := TransactionV1{
@@ -740,28 +1729,113 @@ func (c *Client) LoadModels(
 		Mode:     "OPEN",
 		Readonly: false}
 	actions := []DbAction{}
-	for name, r := range models {
-		model, err := ioutil.ReadAll(r)
+	for _, m := range models {
+		model, err := ioutil.ReadAll(m.Reader)
 		if err != nil {
 			return nil, err
 		}
-		action := makeLoadModelAction(name, string(model))
+		action := makeLoadModelAction(m.Name, string(model))
 		actions = append(actions, action)
 	}
 	data := tx.Payload(actions...)
-	err := c.Post(PathTransaction, tx.QueryArgs(), data, &result)
+	err := c.PostContext(ctx, PathTransaction, tx.QueryArgs(), data, &result)
 	if err != nil {
 		return nil, err
 	}
 	return &result, nil
 }
 
+// Submits a transaction that loads the given models, in order of model name,
+// returning the response without waiting for the transaction to complete.
+// Model sources are passed as query inputs, so they are not parsed as part of
+// the query. The transaction can be waited on using `WaitForTransaction`,
+// and its problems, which report the models that failed to compile, read
+// using `GetTransactionProblemsStream` once it completes.
+func (c *Client) LoadModelsAsync(
+	database, engine string, models map[string]io.Reader,
+) (*TransactionResponse, error) {
+	return c.LoadModelsAsyncContext(c.Context(), database, engine, models)
+}
+
+func (c *Client) LoadModelsAsyncContext(
+	ctx context.Context, database, engine string, models map[string]io.Reader,
+) (*TransactionResponse, error) {
+	names := make([]string, 0, len(models))
+	for name := range models {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	inputs := make(map[string]string, len(names))
+	for i, name := range names {
+		source, err := ioutil.ReadAll(models[name])
+		if err != nil {
+			return nil, err
+		}
+		input := fmt.Sprintf("_model_input_%d", i)
+		inputs[input] = string(source)
+		key := relStringLiteral(name)
+		fmt.Fprintf(&b, "def delete:rel:catalog:model[%s] = rel:catalog:model[%s]\n", key, key)
+		fmt.Fprintf(&b, "def insert:rel:catalog:model[%s] = %s\n", key, input)
+	}
+	return c.ExecuteAsyncContext(ctx, database, engine, b.String(), inputs, false)
+}
+
+// Returns the given models ordered so that each model follows the models it
+// depends on, where `deps` maps a model name to the names of its
+// dependencies. Models are otherwise kept in their given order, and
+// dependencies on models that are not in the list are ignored. Returns an
+// error if the dependencies are cyclic.
+func SortModels(models []NamedModel, deps map[string][]string) ([]NamedModel, error) {
+	index := map[string]int{}
+	for i, m := range models {
+		index[m.Name] = i
+	}
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make([]int, len(models))
+	result := make([]NamedModel, 0, len(models))
+	var visit func(i int) error
+	visit = func(i int) error {
+		switch state[i] {
+		case visiting:
+			return errors.Errorf("model '%s' has a cyclic dependency", models[i].Name)
+		case visited:
+			return nil
+		}
+		state[i] = visiting
+		for _, dep := range deps[models[i].Name] {
+			if j, ok := index[dep]; ok {
+				if err := visit(j); err != nil {
+					return err
+				}
+			}
+		}
+		state[i] = visited
+		result = append(result, models[i])
+		return nil
+	}
+	for i := range models {
+		if err := visit(i); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
 // Returns a list of model names for the given database.
 func (c *Client) ListModelNames(database, engine string) ([]string, error) {
+	return c.ListModelNamesContext(c.Context(), database, engine)
+}
+
+func (c *Client) ListModelNamesContext(ctx context.Context, database, engine string) ([]string, error) {
 	var models listModelsResponse
 	tx := NewTransaction(c.Region, database, engine, "OPEN")
 	data := tx.Payload(makeListModelsAction())
-	err := c.Post(PathTransaction, tx.QueryArgs(), data, &models)
+	err := c.PostContext(ctx, PathTransaction, tx.QueryArgs(), data, &models)
 	if err != nil {
 		return nil, err
 	}
@@ -774,12 +1848,61 @@ func (c *Client) ListModelNames(database, engine string) ([]string, error) {
 	return result, nil
 }
 
+// Returns the names of models in the given database that match the given
+// glob pattern, using the syntax of `path.Match`, eg "app/foo/*" matches the
+// models in "app/foo", but not in its sub-directories. Models are listed in
+// full and filtered on the client.
+func (c *Client) ListModelNamesMatching(database, engine, pattern string) ([]string, error) {
+	return c.ListModelNamesMatchingContext(c.Context(), database, engine, pattern)
+}
+
+func (c *Client) ListModelNamesMatchingContext(
+	ctx context.Context, database, engine, pattern string,
+) ([]string, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, errors.Wrapf(err, "pattern '%s'", pattern)
+	}
+	names, err := c.ListModelNamesContext(ctx, database, engine)
+	if err != nil {
+		return nil, err
+	}
+	result := []string{}
+	for _, name := range names {
+		if ok, _ := path.Match(pattern, name); ok {
+			result = append(result, name)
+		}
+	}
+	return result, nil
+}
+
+// Answers if a model with the given name exists in the given database.
+func (c *Client) ModelExists(database, engine, name string) (bool, error) {
+	return c.ModelExistsContext(c.Context(), database, engine, name)
+}
+
+func (c *Client) ModelExistsContext(ctx context.Context, database, engine, name string) (bool, error) {
+	names, err := c.ListModelNamesContext(ctx, database, engine)
+	if err != nil {
+		return false, err
+	}
+	for _, n := range names {
+		if n == name {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
 // Returns the names of models installed in the given database.
 func (c *Client) ListModels(database, engine string) ([]Model, error) {
+	return c.ListModelsContext(c.Context(), database, engine)
+}
+
+func (c *Client) ListModelsContext(ctx context.Context, database, engine string) ([]Model, error) {
 	var models listModelsResponse
 	tx := NewTransaction(c.Region, database, engine, "OPEN")
 	data := tx.Payload(makeListModelsAction())
-	err := c.Post(PathTransaction, tx.QueryArgs(), data, &models)
+	err := c.PostContext(ctx, PathTransaction, tx.QueryArgs(), data, &models)
 	if err != nil {
 		return nil, err
 	}
@@ -861,6 +1984,28 @@ func reltype(value interface{}) (string, error) {
 	switch v := value.(type) {
 	case string:
 		return "RAI_VariableSizeStrings.VariableSizeString", nil
+	case bool:
+		return "Bool", nil
+	case int, int64:
+		return "Int64", nil
+	case int32:
+		return "Int32", nil
+	case int16:
+		return "Int16", nil
+	case int8:
+		return "Int8", nil
+	case uint, uint64:
+		return "UInt64", nil
+	case uint32:
+		return "UInt32", nil
+	case uint16:
+		return "UInt16", nil
+	case uint8:
+		return "UInt8", nil
+	case float64:
+		return "Float64", nil
+	case float32:
+		return "Float32", nil
 	default:
 		return "", errors.Errorf("bad query input type: '%T'", v)
 	}
@@ -892,61 +2037,411 @@ func makeListEDBAction() DbAction {
 	return DbAction{"type": "ListEdbAction"}
 }
 
-func makeQueryAction(source string, inputs map[string]string) (DbAction, error) {
-	actionInputs := []map[string]interface{}{}
-	for k, v := range inputs {
-		actionInput, err := makeQueryActionInput(k, v)
-		if err != nil {
-			return nil, err
-		}
-		actionInputs = append(actionInputs, actionInput)
+func makeQueryAction(
+	source string, inputs map[string]string, opts *ExecuteOptions,
+) (DbAction, error) {
+	actionInputs, err := makeQueryActionInputs(inputs, opts)
+	if err != nil {
+		return nil, err
 	}
-	result := map[string]interface{}{
+	persist, err := persistNames(opts)
+	if err != nil {
+		return nil, err
+	}
+	outputs := []string{}
+	if opts != nil && opts.Outputs != nil {
+		outputs = opts.Outputs
+	}
+	result := map[string]interface{}{
 		"type":    "QueryAction",
 		"source":  makeQuerySource("query", source),
-		"persist": []string{},
+		"persist": persist,
 		"inputs":  actionInputs,
-		"outputs": []string{}}
+		"outputs": outputs}
 	return result, nil
 }
 
-func makeQueryActionInput(name, value string) (map[string]interface{}, error) {
+// Returns the names of the relations to persist given by the options, which
+// must be valid relation names.
+func persistNames(opts *ExecuteOptions) ([]string, error) {
+	if opts == nil || opts.Persist == nil {
+		return []string{}, nil
+	}
+	for _, name := range opts.Persist {
+		if err := checkRelationName(name); err != nil {
+			return nil, err
+		}
+	}
+	return opts.Persist, nil
+}
+
+func makeQueryActionInput(name string, value any) (map[string]interface{}, error) {
 	typename, err := reltype(value)
 	if err != nil {
 		return nil, err
 	}
 	result := map[string]interface{}{
 		"type":    "Relation",
-		"columns": [][]string{{value}},
+		"columns": [][]any{{value}},
 		"rel_key": makeRelKey(name, typename)}
 	return result, nil
 }
 
+// Returns the encoded query inputs for the given string inputs and the
+// typed inputs of the given options, in order of input name. This encoding
+// is shared by the v1 and async transaction APIs.
+func makeQueryActionInputs(
+	inputs map[string]string, opts *ExecuteOptions,
+) ([]map[string]interface{}, error) {
+	values := map[string]any{}
+	for k, v := range inputs {
+		values[k] = v
+	}
+	if opts != nil {
+		for k, v := range opts.Inputs {
+			values[k] = v
+		}
+	}
+	names := make([]string, 0, len(values))
+	for k := range values {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	result := make([]map[string]interface{}, 0, len(names))
+	for _, name := range names {
+		input, err := makeQueryActionInput(name, values[name])
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, input)
+	}
+	return result, nil
+}
+
+// Optional settings for transaction execution.
+type ExecuteOptions struct {
+	Persist     []string // names of derived relations to persist in the database
+	Outputs     []string // names of the output relations to return
+	FailOnError bool     // return a TransactionProblemsError on error problems
+	Region      string   // overrides the client's region, if not empty
+
+	// Typed query inputs, in addition to any string inputs. Values may be
+	// strings, bools, or any Go integer or float type.
+	Inputs map[string]any
+
+	// Maximum time a transaction may remain in the same non-terminal state
+	// before a TransactionStuckError is returned, zero means no limit.
+	StuckTimeout time.Duration
+
+	// Abort reasons, eg "engine lost", for which the transaction is
+	// re-submitted, up to MaxResubmits times.
+	ResubmitOn   []string
+	MaxResubmits int
+
+	// Endpoint used to execute the transaction, the v1 endpoint runs the
+	// transaction synchronously.
+	ResultsAPI ResultsAPI
+
+	// Roll back the transaction once it has run, see `ExecuteAbort`. Only
+	// the v1 endpoint supports aborting transactions, so it is used
+	// regardless of ResultsAPI.
+	Abort bool
+
+	// Polling of the transaction while waiting for it to complete, nil
+	// polls at an interval that grows with the transaction's run time.
+	Poll *PollOptions
+}
+
+func NewExecuteOptions() *ExecuteOptions {
+	return &ExecuteOptions{}
+}
+
+func (opts *ExecuteOptions) WithPersist(names ...string) *ExecuteOptions {
+	opts.Persist = names
+	return opts
+}
+
+func (opts *ExecuteOptions) WithOutputs(names ...string) *ExecuteOptions {
+	opts.Outputs = names
+	return opts
+}
+
+func (opts *ExecuteOptions) WithFailOnError(fail bool) *ExecuteOptions {
+	opts.FailOnError = fail
+	return opts
+}
+
+func (opts *ExecuteOptions) WithInput(name string, value any) *ExecuteOptions {
+	if opts.Inputs == nil {
+		opts.Inputs = map[string]any{}
+	}
+	opts.Inputs[name] = value
+	return opts
+}
+
+func (opts *ExecuteOptions) WithRegion(region string) *ExecuteOptions {
+	opts.Region = region
+	return opts
+}
+
+func (opts *ExecuteOptions) WithResultsAPI(api ResultsAPI) *ExecuteOptions {
+	opts.ResultsAPI = api
+	return opts
+}
+
+func (opts *ExecuteOptions) WithAbort(abort bool) *ExecuteOptions {
+	opts.Abort = abort
+	return opts
+}
+
+// Returns the region to use for a transaction with the given options.
+func (c *Client) region(opts *ExecuteOptions) string {
+	if opts != nil && opts.Region != "" {
+		return opts.Region
+	}
+	return c.Region
+}
+
+// Returns the region to send with an async transaction request, which is
+// only sent when it is set explicitly, by the given options, the client's
+// options or a change to the client's Region, and is otherwise left to the
+// service.
+func (c *Client) asyncRegion(opts *ExecuteOptions) string {
+	if opts != nil && opts.Region != "" {
+		return opts.Region
+	}
+	if c.regionSet || c.Region != DefaultRegion {
+		return c.Region
+	}
+	return ""
+}
+
+func (opts *ExecuteOptions) WithStuckTimeout(d time.Duration) *ExecuteOptions {
+	opts.StuckTimeout = d
+	return opts
+}
+
+func (opts *ExecuteOptions) WithResubmit(max int, reasons ...string) *ExecuteOptions {
+	opts.MaxResubmits = max
+	opts.ResubmitOn = reasons
+	return opts
+}
+
+func (opts *ExecuteOptions) WithPoll(poll *PollOptions) *ExecuteOptions {
+	opts.Poll = poll
+	return opts
+}
+
+// Optional settings for polling a transaction until it completes.
+type PollOptions struct {
+	// Time between polls. Zero polls at 20% of the transaction's run time
+	// so far, up to two minutes between polls, as when no options are given.
+	Interval time.Duration
+
+	// Maximum time to wait, after which ErrPollTimeout is returned, zero
+	// means no limit.
+	Timeout time.Duration
+
+	// Factor by which Interval grows after each poll, up to two minutes,
+	// values of 1 or less keep the interval constant.
+	Backoff float64
+}
+
+// Returned when a transaction does not complete within the Timeout of its
+// PollOptions. The transaction is not cancelled, so it can still be waited
+// on again or cancelled with CancelTransaction.
+var ErrPollTimeout = errors.New("transaction poll timeout")
+
+// Returns the pause before the first poll of a transaction.
+func (poll *PollOptions) firstPause() time.Duration {
+	if poll != nil && poll.Interval > 0 {
+		return poll.Interval
+	}
+	return 500 * time.Millisecond
+}
+
+// Returns the pause before the next poll of a transaction that started at
+// t0, given the previous pause.
+func (poll *PollOptions) nextPause(prev time.Duration, t0 time.Time) time.Duration {
+	var pause time.Duration
+	switch {
+	case poll == nil || poll.Interval <= 0:
+		pause = time.Since(t0) / 5 // 20% of total run time
+	case poll.Backoff > 1:
+		pause = time.Duration(float64(prev) * poll.Backoff)
+	default:
+		pause = poll.Interval
+	}
+	if pause > twoMinutes {
+		pause = twoMinutes
+	}
+	return pause
+}
+
+// Answers if the given transaction was aborted for one of the reasons that
+// allow it to be re-submitted.
+func (opts *ExecuteOptions) isResubmitReason(tx *Transaction) bool {
+	if tx.State != Aborted {
+		return false
+	}
+	for _, reason := range opts.ResubmitOn {
+		if tx.AbortReason == reason {
+			return true
+		}
+	}
+	return false
+}
+
+var ErrTransactionStuck = errors.New("transaction stuck")
+
+// TransactionStuckError is returned when a transaction remains in the same
+// non-terminal state for longer than the `StuckTimeout` execute option. It
+// matches ErrTransactionStuck when using errors.Is.
+type TransactionStuckError struct {
+	TransactionID string
+	State         TransactionState // last seen state
+	Duration      time.Duration    // time spent in the last seen state
+}
+
+func (e TransactionStuckError) Error() string {
+	return fmt.Sprintf(
+		"transaction %s stuck in state %s for %s",
+		e.TransactionID, e.State, e.Duration.Round(time.Second))
+}
+
+func (e TransactionStuckError) Is(target error) bool {
+	return target == ErrTransactionStuck
+}
+
+// TransactionProblemsError is returned when a transaction executed with
+// `FailOnError` reports one or more error problems.
+type TransactionProblemsError struct {
+	TransactionID string
+	Problems      []Problem
+}
+
+func (e TransactionProblemsError) Error() string {
+	var msgs []string
+	for _, p := range e.Problems {
+		if p.IsError {
+			msgs = append(msgs, p.Message)
+		}
+	}
+	return fmt.Sprintf(
+		"transaction %s failed with %d error(s): %s",
+		e.TransactionID, len(msgs), strings.Join(msgs, "; "))
+}
+
+// Returns a TransactionProblemsError if any of the given problems is an
+// error, otherwise nil.
+func checkProblems(id string, problems []Problem) error {
+	for _, p := range problems {
+		if p.IsError {
+			return TransactionProblemsError{id, problems}
+		}
+	}
+	return nil
+}
+
 // Deprecated: use `Execute`
 func (c *Client) ExecuteV1(
 	database, engine, source string,
 	inputs map[string]string,
 	readonly bool,
+) (*TransactionResult, error) {
+	return c.ExecuteV1Context(c.Context(), database, engine, source, inputs, readonly)
+}
+
+func (c *Client) ExecuteV1Context(
+	ctx context.Context, database, engine, source string,
+	inputs map[string]string,
+	readonly bool,
+) (*TransactionResult, error) {
+	return c.ExecuteV1WithOptionsContext(ctx, database, engine, source, inputs, readonly, nil)
+}
+
+// Deprecated: use `Execute`
+func (c *Client) ExecuteV1WithOptions(
+	database, engine, source string,
+	inputs map[string]string,
+	readonly bool,
+	opts *ExecuteOptions,
+) (*TransactionResult, error) {
+	return c.ExecuteV1WithOptionsContext(c.Context(), database, engine, source, inputs, readonly, opts)
+}
+
+func (c *Client) ExecuteV1WithOptionsContext(
+	ctx context.Context, database, engine, source string,
+	inputs map[string]string,
+	readonly bool,
+	opts *ExecuteOptions,
 ) (*TransactionResult, error) {
 	var result TransactionResult
 	tx := TransactionV1{
-		Region:   c.Region,
+		Region:   c.region(opts),
 		Database: database,
 		Engine:   engine,
 		Mode:     "OPEN",
+		Abort:    opts != nil && opts.Abort,
 		Readonly: readonly}
-	queryAction, err := makeQueryAction(source, inputs)
+	queryAction, err := makeQueryAction(source, inputs, opts)
 	if err != nil {
 		return nil, err
 	}
 	data := tx.Payload(queryAction)
-	err = c.Post(PathTransaction, tx.QueryArgs(), data, &result)
+	err = c.PostContext(ctx, PathTransaction, tx.QueryArgs(), data, &result)
 	if err != nil {
 		return nil, err
 	}
 	return &result, nil
 }
 
+// Returned when tags are given for a transaction executed using the v1
+// endpoint, which does not support them.
+var ErrTagsNotSupported = errors.New("tags not supported by the v1 endpoint")
+
+// Execute the given transaction using the v1 endpoint, and return the result
+// as a complete TransactionResponse.
+func (c *Client) executeV1(
+	ctx context.Context, database, engine, source string,
+	inputs map[string]string, readonly bool,
+	opts *ExecuteOptions,
+) (*TransactionResponse, error) {
+	result, err := c.ExecuteV1WithOptionsContext(ctx, database, engine, source, inputs, readonly, opts)
+	if err != nil {
+		return nil, err
+	}
+	rsp, err := newTransactionResponseV1(result)
+	if err != nil {
+		return nil, err
+	}
+	rsp.Transaction.Database = database
+	rsp.Transaction.Engine = engine
+	rsp.Transaction.Query = source
+	rsp.Transaction.ReadOnly = readonly
+	rsp.RolledBack = opts != nil && opts.Abort
+	return rsp, nil
+}
+
+// Execute the given query and roll it back once it has run, so that none of
+// its changes to the database are persisted, whether or not it succeeds.
+// The response holds the outputs and problems the query would have produced
+// had it been committed, which can be used to validate a write query before
+// running it for real. The response has `RolledBack` set, and its
+// transaction is reported in the Aborted state, because that is how the
+// service reports a transaction that was rolled back on request; the
+// problems, not the state, show whether the query itself failed.
+func (c *Client) ExecuteAbort(database, engine, source string) (*TransactionResponse, error) {
+	return c.ExecuteAbortContext(c.Context(), database, engine, source)
+}
+
+func (c *Client) ExecuteAbortContext(
+	ctx context.Context, database, engine, source string,
+) (*TransactionResponse, error) {
+	opts := NewExecuteOptions().WithAbort(true)
+	return c.ExecuteWithOptionsContext(ctx, database, engine, source, nil, false, opts)
+}
+
 //
 // Transactions
 //
@@ -962,55 +2457,306 @@ func isTransactionComplete(tx *Transaction) bool {
 
 const twoMinutes = 2 * time.Minute
 
-// todo: consider making the polling coefficients part of tx options
 func (c *Client) Execute(
 	database, engine, source string,
 	inputs map[string]string, readonly bool,
 	tags ...string,
 ) (*TransactionResponse, error) {
+	return c.ExecuteContext(c.Context(), database, engine, source, inputs, readonly, tags...)
+}
+
+func (c *Client) ExecuteContext(
+	ctx context.Context, database, engine, source string,
+	inputs map[string]string, readonly bool,
+	tags ...string,
+) (*TransactionResponse, error) {
+	return c.ExecuteWithOptionsContext(ctx, database, engine, source, inputs, readonly, nil, tags...)
+}
+
+// Execute the given transaction and wait for it to complete. If `opts` has
+// `FailOnError` set, and the transaction reports any error problems, a
+// TransactionProblemsError is returned instead of the response. Transactions
+// aborted for one of the `ResubmitOn` reasons are executed again, and waiting
+// on a transaction that makes no progress fails after `StuckTimeout`.
+func (c *Client) ExecuteWithOptions(
+	database, engine, source string,
+	inputs map[string]string, readonly bool,
+	opts *ExecuteOptions,
+	tags ...string,
+) (*TransactionResponse, error) {
+	return c.ExecuteWithOptionsContext(c.Context(), database, engine, source, inputs, readonly, opts, tags...)
+}
+
+func (c *Client) ExecuteWithOptionsContext(
+	ctx context.Context, database, engine, source string,
+	inputs map[string]string, readonly bool,
+	opts *ExecuteOptions,
+	tags ...string,
+) (*TransactionResponse, error) {
+	rsp, err := c.execute(ctx, database, engine, source, inputs, readonly, opts, tags...)
+	if err != nil {
+		return nil, err
+	}
+	if opts != nil && opts.FailOnError {
+		if rsp.Problems == nil {
+			rsp.Problems, err = c.GetTransactionProblemsContext(ctx, rsp.Transaction.ID)
+			if err != nil {
+				return nil, err
+			}
+		}
+		problems := rsp.Problems
+		if err := checkProblems(rsp.Transaction.ID, problems); err != nil {
+			return nil, err
+		}
+	}
+	return rsp, nil
+}
+
+// Execute the given query with the contents of the given readers as named
+// string inputs, eg the data of several CSV files that the query joins, and
+// wait for it to complete, as with ExecuteWithOptions. Each input is
+// referenced by name in the source, like the string inputs of Execute.
+// Typed inputs may also be given in `opts`, but their names must not clash
+// with the names of the readers. Inputs are sent in the body of the
+// transaction request, so each reader is read in full before the request is
+// sent, and reading stops as soon as an input is larger than the client's
+// MaxRequestBytes, if set.
+func (c *Client) ExecuteWithInputs(
+	database, engine, source string,
+	inputs map[string]io.Reader, readonly bool,
+	opts *ExecuteOptions,
+) (*TransactionResponse, error) {
+	return c.ExecuteWithInputsContext(c.Context(), database, engine, source, inputs, readonly, opts)
+}
+
+func (c *Client) ExecuteWithInputsContext(
+	ctx context.Context, database, engine, source string,
+	inputs map[string]io.Reader, readonly bool,
+	opts *ExecuteOptions,
+) (*TransactionResponse, error) {
+	values, err := c.readInputs(inputs, opts)
+	if err != nil {
+		return nil, err
+	}
+	return c.ExecuteWithOptionsContext(ctx, database, engine, source, values, readonly, opts)
+}
+
+// Returns the contents of the given input readers, keyed by input name.
+func (c *Client) readInputs(
+	inputs map[string]io.Reader, opts *ExecuteOptions,
+) (map[string]string, error) {
+	result := make(map[string]string, len(inputs))
+	for name, r := range inputs {
+		if err := checkRelationName(name); err != nil {
+			return nil, err
+		}
+		if opts != nil {
+			if _, ok := opts.Inputs[name]; ok {
+				return nil, errors.Errorf("input '%s' is given more than once", name)
+			}
+		}
+		if c.maxRequestBytes > 0 {
+			r = io.LimitReader(r, c.maxRequestBytes+1)
+		}
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return nil, errors.Wrapf(err, "input '%s'", name)
+		}
+		if c.maxRequestBytes > 0 && int64(len(data)) > c.maxRequestBytes {
+			return nil, errors.Wrapf(ErrRequestTooLarge,
+				"input '%s' is larger than the limit of %d bytes", name, c.maxRequestBytes)
+		}
+		result[name] = string(data)
+	}
+	return result, nil
+}
+
+func (c *Client) execute(
+	ctx context.Context, database, engine, source string,
+	inputs map[string]string, readonly bool,
+	opts *ExecuteOptions,
+	tags ...string,
+) (*TransactionResponse, error) {
+	for attempt := 0; ; attempt++ {
+		rsp, err := c.executeOnce(ctx, database, engine, source, inputs, readonly, opts, tags...)
+		if err != nil {
+			return nil, err
+		}
+		if opts == nil || attempt >= opts.MaxResubmits || !opts.isResubmitReason(&rsp.Transaction) {
+			return rsp, nil
+		}
+	}
+}
+
+// Returns a TransactionStuckError if the transaction has been in the given
+// non-terminal state for longer than the timeout allows.
+func checkStuck(tx *Transaction, since time.Time, timeout time.Duration) error {
+	if timeout <= 0 {
+		return nil
+	}
+	if d := time.Since(since); d > timeout {
+		return TransactionStuckError{tx.ID, tx.State, d}
+	}
+	return nil
+}
+
+func (c *Client) executeOnce(
+	ctx context.Context, database, engine, source string,
+	inputs map[string]string, readonly bool,
+	opts *ExecuteOptions,
+	tags ...string,
+) (*TransactionResponse, error) {
+	var stuckTimeout time.Duration
+	var poll *PollOptions
+	if opts != nil {
+		stuckTimeout, poll = opts.StuckTimeout, opts.Poll
+	}
 	t0 := time.Now()
-	rsp, err := c.ExecuteAsync(database, engine, source, inputs, readonly, tags...)
+	rsp, err := c.ExecuteAsyncWithOptionsContext(ctx, database, engine, source, inputs, readonly, opts, tags...)
 	if err != nil {
 		return nil, err
 	}
 	if isTransactionComplete(&rsp.Transaction) {
 		return rsp, nil // fast path
 	}
-	id := rsp.Transaction.ID
-	opts := GetTransactionOptions{true, true, true}
-	time.Sleep(500 * time.Millisecond)
+	return c.waitForTransaction(ctx, &rsp.Transaction, t0, stuckTimeout, poll)
+}
+
+// Wait for the given transaction to complete, and return it along with its
+// results, metadata and problems, as returned by `Execute`. This can be used
+// to collect the outputs of a transaction submitted with `ExecuteAsync`.
+// If the context given to WaitForTransactionContext is done before the
+// transaction completes, the transaction is cancelled and the context's
+// error is returned.
+func (c *Client) WaitForTransaction(id string) (*TransactionResponse, error) {
+	return c.WaitForTransactionContext(c.Context(), id)
+}
+
+func (c *Client) WaitForTransactionContext(ctx context.Context, id string) (*TransactionResponse, error) {
+	return c.WaitForTransactionWithOptionsContext(ctx, id, nil)
+}
+
+// Wait for the given transaction to complete, as WaitForTransaction does,
+// polling it as given by `opts`. Returns an error matching ErrPollTimeout if
+// the transaction does not complete within the options' timeout.
+func (c *Client) WaitForTransactionWithOptions(id string, opts *PollOptions) (*TransactionResponse, error) {
+	return c.WaitForTransactionWithOptionsContext(c.Context(), id, opts)
+}
+
+func (c *Client) WaitForTransactionWithOptionsContext(
+	ctx context.Context, id string, opts *PollOptions,
+) (*TransactionResponse, error) {
+	rsp, err := c.GetTransactionContext(ctx, id, GetTransactionOptions{true, true, true})
+	if err != nil {
+		return nil, err
+	}
+	if isTransactionComplete(&rsp.Transaction) {
+		return rsp, nil
+	}
+	t0 := time.Now()
+	if rsp.Transaction.CreatedOn > 0 {
+		t0 = time.UnixMilli(rsp.Transaction.CreatedOn)
+	}
+	return c.waitForTransaction(ctx, &rsp.Transaction, t0, 0, opts)
+}
+
+// Poll the given transaction, which started at t0, until it completes,
+// returning a TransactionStuckError if it remains in the same state for
+// longer than the stuck timeout, or ErrPollTimeout if it does not complete
+// within the poll timeout, which also bounds the poll requests themselves.
+// If the context is done first, the transaction is cancelled and the
+// context's error is returned.
+func (c *Client) waitForTransaction(
+	ctx context.Context, tx *Transaction, t0 time.Time, stuckTimeout time.Duration,
+	poll *PollOptions,
+) (*TransactionResponse, error) {
+	id := tx.ID
+	state, since := tx.State, t0 // last seen state
+	getOpts := GetTransactionOptions{true, true, true}
+	var deadline time.Time
+	pctx := ctx // context of the poll requests
+	if poll != nil && poll.Timeout > 0 {
+		deadline = time.Now().Add(poll.Timeout)
+		var cancel context.CancelFunc
+		pctx, cancel = context.WithDeadline(ctx, deadline)
+		defer cancel()
+	}
+	interval := poll.firstPause()
+	pause := interval
 	for {
-		rsp, err := c.GetTransaction(id, opts)
+		if !deadline.IsZero() {
+			// don't oversleep the deadline
+			if remaining := time.Until(deadline); remaining < pause {
+				pause = remaining
+			}
+		}
+		if err := c.sleep(ctx, pause); err != nil {
+			return nil, c.cancelWait(ctx, id, err)
+		}
+		if !deadline.IsZero() && !time.Now().Before(deadline) {
+			return nil, errors.Wrapf(ErrPollTimeout, "transaction %s", id)
+		}
+		rsp, err := c.GetTransactionContext(pctx, id, getOpts)
 		if err != nil {
-			return nil, err
+			if ctx.Err() == nil && pctx.Err() != nil {
+				return nil, errors.Wrapf(ErrPollTimeout, "transaction %s", id)
+			}
+			return nil, c.cancelWait(ctx, id, err)
 		}
 		if isTransactionComplete(&rsp.Transaction) {
 			return rsp, nil
 		}
-		delta := time.Since(t0)                  // total run time
-		pause := time.Duration(int64(delta) / 5) // 20% of total run time
-		if pause > twoMinutes {
-			pause = twoMinutes
+		if rsp.Transaction.State != state {
+			state, since = rsp.Transaction.State, time.Now()
+		}
+		if err := checkStuck(&rsp.Transaction, since, stuckTimeout); err != nil {
+			return nil, err
+		}
+		if !deadline.IsZero() && !time.Now().Before(deadline) {
+			return nil, errors.Wrapf(ErrPollTimeout, "transaction %s", id)
+		}
+		interval = poll.nextPause(interval, t0)
+		pause = interval
+		if stuckTimeout > 0 {
+			// don't oversleep the stuck timeout
+			if remaining := stuckTimeout - time.Since(since); remaining > 0 && remaining < pause {
+				pause = remaining + time.Millisecond
+			}
 		}
-		time.Sleep(pause)
 	}
 }
 
+// Maximum time spent cancelling a transaction whose wait was cancelled.
+const cancelWaitTimeout = 10 * time.Second
+
+// Returns the given error from waiting on the given transaction. If the wait
+// failed because a context given by the caller is done, the transaction is
+// cancelled so that it does not keep running unobserved. The cancellation has
+// its own short deadline, as the wait's context is done. A wait on the
+// client's own context never cancels the transaction.
+func (c *Client) cancelWait(ctx context.Context, id string, err error) error {
+	if ctx.Err() == nil {
+		return err
+	}
+	if _, ok := ctx.(clientContext); ok {
+		return ctx.Err()
+	}
+	cctx, cancel := context.WithTimeout(context.Background(), cancelWaitTimeout)
+	defer cancel()
+	_, _ = c.CancelTransactionContext(cctx, id) // best effort
+	return ctx.Err()
+}
+
 // Returns the results of a fast path response, which will contain data for
 // the transaction resource, problems, metadata and results in various parts
 // of the multipart response.
 func ReadTransactionResponse(rsp *http.Response) (*TransactionResponse, error) {
 	var result TransactionResponse
 
-	h := rsp.Header.Get("content-type")
-	ctype, params, err := mime.ParseMediaType(h)
+	r, err := newMultipartReader(rsp)
 	if err != nil {
 		return nil, err
 	}
-	if ctype != "multipart/form-data" {
-		return nil, fmt.Errorf("bad content type: '%s'", ctype)
-	}
-	r := multipart.NewReader(rsp.Body, params["boundary"])
 	for {
 		part, err := r.NextPart()
 		if err != nil {
@@ -1046,18 +2792,77 @@ func ReadTransactionResponse(rsp *http.Response) (*TransactionResponse, error) {
 				return nil, err
 			}
 
-		default: // otherwise it's an errow encoded partition
-			id, rsp, err := readTransactionPartition(part)
-			if err != nil {
-				return nil, err
-			}
-			if result.Partitions == nil {
-				result.Partitions = map[string]*Partition{}
-			}
-			result.Partitions[id] = rsp
-		}
+		default: // otherwise it's an errow encoded partition
+			id, rsp, err := readTransactionPartition(part)
+			if err != nil {
+				return nil, err
+			}
+			if result.Partitions == nil {
+				result.Partitions = map[string]*Partition{}
+			}
+			result.Partitions[id] = rsp
+		}
+	}
+	return &result, nil
+}
+
+// Returns the Rel source in the given file, with any leading byte order mark
+// removed and CRLF line endings normalized to LF.
+func ReadRelFile(fname string) (string, error) {
+	data, err := os.ReadFile(fname)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return "", errors.Wrapf(err, "rel source file '%s' does not exist", fname)
+		}
+		return "", errors.Wrapf(err, "failed to read rel source file '%s'", fname)
+	}
+	data = bytes.TrimPrefix(data, []byte("\ufeff"))
+	data = bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))
+	return string(data), nil
+}
+
+// Execute the Rel source in the given file and wait for the transaction to
+// complete.
+func (c *Client) ExecuteFile(
+	database, engine, fname string,
+	inputs map[string]string, readonly bool,
+	tags ...string,
+) (*TransactionResponse, error) {
+	return c.ExecuteFileContext(c.Context(), database, engine, fname, inputs, readonly, tags...)
+}
+
+func (c *Client) ExecuteFileContext(
+	ctx context.Context, database, engine, fname string,
+	inputs map[string]string, readonly bool,
+	tags ...string,
+) (*TransactionResponse, error) {
+	source, err := ReadRelFile(fname)
+	if err != nil {
+		return nil, err
+	}
+	return c.ExecuteContext(ctx, database, engine, source, inputs, readonly, tags...)
+}
+
+// Submit the Rel source in the given file, returning the response without
+// waiting for the transaction to complete.
+func (c *Client) ExecuteFileAsync(
+	database, engine, fname string,
+	inputs map[string]string, readonly bool,
+	tags ...string,
+) (*TransactionResponse, error) {
+	return c.ExecuteFileAsyncContext(c.Context(), database, engine, fname, inputs, readonly, tags...)
+}
+
+func (c *Client) ExecuteFileAsyncContext(
+	ctx context.Context, database, engine, fname string,
+	inputs map[string]string, readonly bool,
+	tags ...string,
+) (*TransactionResponse, error) {
+	source, err := ReadRelFile(fname)
+	if err != nil {
+		return nil, err
 	}
-	return &result, nil
+	return c.ExecuteAsyncContext(ctx, database, engine, source, inputs, readonly, tags...)
 }
 
 func (c *Client) ExecuteAsync(
@@ -1065,20 +2870,67 @@ func (c *Client) ExecuteAsync(
 	inputs map[string]string, readonly bool,
 	tags ...string,
 ) (*TransactionResponse, error) {
-	var inputList = make([]interface{}, 0)
-	for k, v := range inputs {
-		input, _ := makeQueryActionInput(k, v)
-		inputList = append(inputList, input)
+	return c.ExecuteAsyncContext(c.Context(), database, engine, query, inputs, readonly, tags...)
+}
+
+func (c *Client) ExecuteAsyncContext(
+	ctx context.Context, database, engine, query string,
+	inputs map[string]string, readonly bool,
+	tags ...string,
+) (*TransactionResponse, error) {
+	return c.ExecuteAsyncWithOptionsContext(ctx, database, engine, query, inputs, readonly, nil, tags...)
+}
+
+// Submit the given transaction using the given options, and immediately
+// return the response, which will contain results if the transaction
+// completed on the fast path.
+func (c *Client) ExecuteAsyncWithOptions(
+	database, engine, query string,
+	inputs map[string]string, readonly bool,
+	opts *ExecuteOptions,
+	tags ...string,
+) (*TransactionResponse, error) {
+	return c.ExecuteAsyncWithOptionsContext(c.Context(), database, engine, query, inputs, readonly, opts, tags...)
+}
+
+func (c *Client) ExecuteAsyncWithOptionsContext(
+	ctx context.Context, database, engine, query string,
+	inputs map[string]string, readonly bool,
+	opts *ExecuteOptions,
+	tags ...string,
+) (*TransactionResponse, error) {
+	if opts != nil && (opts.ResultsAPI == ResultsAPIV1 || opts.Abort) {
+		if len(tags) > 0 {
+			return nil, ErrTagsNotSupported
+		}
+		return c.executeV1(ctx, database, engine, query, inputs, readonly, opts)
+	}
+	actionInputs, err := makeQueryActionInputs(inputs, opts)
+	if err != nil {
+		return nil, err
+	}
+	persist, err := persistNames(opts)
+	if err != nil {
+		return nil, err
+	}
+	if readonly && len(persist) > 0 {
+		return nil, errors.New("cannot persist relations in a read-only transaction")
+	}
+	inputList := make([]any, len(actionInputs))
+	for i, input := range actionInputs {
+		inputList[i] = input
 	}
 	tx := TransactionRequest{
+		Region:   c.asyncRegion(opts),
 		Database: database,
 		Engine:   engine,
 		Query:    query,
 		ReadOnly: readonly,
 		Inputs:   inputList,
+		Persist:  persist,
 		Tags:     tags}
 	var rsp *http.Response
-	err := c.request(http.MethodPost, PathTransactions, nil, nil, tx, &rsp)
+	err = c.requestContext(ctx, http.MethodPost, PathTransactions, nil, nil, tx, &rsp)
 	if err != nil {
 		return nil, err
 	}
@@ -1109,10 +2961,16 @@ type GetTransactionOptions struct {
 // selected in `opts`, if available.
 func (c *Client) GetTransaction(id string, opts ...GetTransactionOptions) (
 	*TransactionResponse, error,
+) {
+	return c.GetTransactionContext(c.Context(), id, opts...)
+}
+
+func (c *Client) GetTransactionContext(ctx context.Context, id string, opts ...GetTransactionOptions) (
+	*TransactionResponse, error,
 ) {
 	var result TransactionResponse
 	rsp := struct{ Transaction *Transaction }{Transaction: &result.Transaction}
-	err := c.Get(makePath(PathTransactions, id), nil, nil, &rsp)
+	err := c.GetContext(ctx, makePath(PathTransactions, id), nil, nil, &rsp)
 	if err != nil {
 		return nil, err
 	}
@@ -1131,21 +2989,21 @@ func (c *Client) GetTransaction(id string, opts ...GetTransactionOptions) (
 	if results {
 		wg.Add(1)
 		go func() {
-			result.Partitions, errR = c.GetTransactionResults(id)
+			result.Partitions, errR = c.GetTransactionResultsContext(ctx, id)
 			wg.Done()
 		}()
 	}
 	if metadata {
 		wg.Add(1)
 		go func() {
-			result.Metadata, errM = c.GetTransactionMetadata(id)
+			result.Metadata, errM = c.GetTransactionMetadataContext(ctx, id)
 			wg.Done()
 		}()
 	}
 	if problems {
 		wg.Add(1)
 		go func() {
-			result.Problems, errP = c.GetTransactionProblems(id)
+			result.Problems, errP = c.GetTransactionProblemsContext(ctx, id)
 			wg.Done()
 		}()
 	}
@@ -1181,10 +3039,16 @@ func readTransactionMetadata(r io.Reader) (*TransactionMetadata, error) {
 
 func (c *Client) GetTransactionMetadata(id string) (
 	*TransactionMetadata, error,
+) {
+	return c.GetTransactionMetadataContext(c.Context(), id)
+}
+
+func (c *Client) GetTransactionMetadataContext(ctx context.Context, id string) (
+	*TransactionMetadata, error,
 ) {
 	var rsp *http.Response
 	headers := map[string]string{"Accept": "application/x-protobuf"}
-	err := c.Get(makePath(PathTransactions, id, "metadata"), headers, nil, &rsp)
+	err := c.GetContext(ctx, makePath(PathTransactions, id, "metadata"), headers, nil, &rsp)
 	if err != nil {
 		return nil, err
 	}
@@ -1202,15 +3066,73 @@ func readTransactionProblems(r io.Reader) ([]Problem, error) {
 
 // todo: deprecated, should be loaded from partitions
 func (c *Client) GetTransactionProblems(id string) ([]Problem, error) {
+	return c.GetTransactionProblemsContext(c.Context(), id)
+}
+
+func (c *Client) GetTransactionProblemsContext(ctx context.Context, id string) ([]Problem, error) {
 	var result []Problem
-	err := c.Get(makePath(PathTransactions, id, "problems"), nil, nil, &result)
+	err := c.GetContext(ctx, makePath(PathTransactions, id, "problems"), nil, nil, &result)
 	if err != nil {
 		return nil, err
 	}
 	return result, nil
 }
 
-// Read one partition from transactionr results.
+// Calls fn with each of the problems of the given transaction, as they are
+// decoded from the response, so that transactions with very many problems,
+// eg integrity warnings from a large load, can be processed without holding
+// all of them in memory. Stops and returns the error if fn returns one.
+func (c *Client) GetTransactionProblemsStream(id string, fn func(Problem) error) error {
+	return c.GetTransactionProblemsStreamContext(c.Context(), id, fn)
+}
+
+func (c *Client) GetTransactionProblemsStreamContext(
+	ctx context.Context, id string, fn func(Problem) error,
+) error {
+	var rsp *http.Response
+	err := c.GetContext(ctx, makePath(PathTransactions, id, "problems"), nil, nil, &rsp)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+	dec := json.NewDecoder(rsp.Body)
+	if t, err := dec.Token(); err != nil {
+		return err
+	} else if t == nil {
+		return nil // null, no problems
+	} else if t != json.Delim('[') {
+		return errors.Errorf("unexpected problems token '%v'", t)
+	}
+	for dec.More() {
+		var problem Problem
+		if err := dec.Decode(&problem); err != nil {
+			return err
+		}
+		if err := fn(problem); err != nil {
+			return err
+		}
+	}
+	_, err = dec.Token() // closing ']'
+	return err
+}
+
+// Returns a reader for the parts of the given multipart response.
+func newMultipartReader(rsp *http.Response) (*multipart.Reader, error) {
+	h := rsp.Header.Get("content-type")
+	ctype, params, err := mime.ParseMediaType(h)
+	if err != nil {
+		return nil, err
+	}
+	if ctype != "multipart/form-data" {
+		return nil, fmt.Errorf("bad content type: '%s'", ctype)
+	}
+	return multipart.NewReader(rsp.Body, params["boundary"]), nil
+}
+
+// Read one partition from transaction results. The arrow stream is decoded
+// directly into the partition's record, so the partition keeps the arrow
+// types of its columns. Partitions are identified by the part's file name,
+// eg "0.arrow", or by its form name if it has no file name.
 func readTransactionPartition(part *multipart.Part) (string, *Partition, error) {
 	h := part.Header.Get("content-type")
 	ctype, _, err := mime.ParseMediaType(h)
@@ -1220,37 +3142,56 @@ func readTransactionPartition(part *multipart.Part) (string, *Partition, error)
 	if ctype != "application/vnd.apache.arrow.stream" {
 		return "", nil, fmt.Errorf("unknown content disposition '%s'", ctype)
 	}
-	r, err := ipc.NewReader(part)
+	record, err := readPartitionRecord(part)
 	if err != nil {
 		return "", nil, err
 	}
-	if r.Next() {
-		id := part.FileName()
-		record := r.Record()
-		record.Retain()
-		if r.Next() { // partitions are encoded in a single record
-			return "", nil, errors.New("unexpected record in partition")
+	id := part.FileName()
+	if id == "" {
+		id = part.FormName()
+	}
+	return id, newPartition(record), nil
+}
+
+// Read the record batches of an arrow IPC stream, combining them into a
+// single record. Partitions are usually encoded as a single record, but large
+// partitions may be split into several batches.
+func readPartitionRecord(rd io.Reader) (arrow.Record, error) {
+	r, err := ipc.NewReader(rd)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Release()
+	var records []arrow.Record
+	defer func() {
+		for _, record := range records {
+			record.Release()
 		}
-		return id, newPartition(record), nil
+	}()
+	for r.Next() {
+		record := r.Record()
+		record.Retain() // the reader releases it on the next call to Next
+		records = append(records, record)
+	}
+	if err := r.Err(); err != nil {
+		return nil, err
 	}
-	return "", nil, errors.New("no records for partition")
+	if len(records) == 0 {
+		return nil, errors.New("no records for partition")
+	}
+	return concatRecords(records)
 }
 
 // Read the results of `GetTransactionResults` which will contain a list of
 // partitions in the parts of the multipart response.
 func readTransactionResults(rsp *http.Response) (map[string]*Partition, error) {
-	h := rsp.Header.Get("content-type")
-	ctype, params, err := mime.ParseMediaType(h)
+	r, err := newMultipartReader(rsp)
 	if err != nil {
 		return nil, err
 	}
-	if ctype != "multipart/form-data" {
-		return nil, fmt.Errorf("bad content type: '%s'", ctype)
-	}
 
 	result := map[string]*Partition{}
 
-	r := multipart.NewReader(rsp.Body, params["boundary"])
 	for {
 		part, err := r.NextPart()
 		if err != nil {
@@ -1260,7 +3201,8 @@ func readTransactionResults(rsp *http.Response) (map[string]*Partition, error) {
 			return nil, err
 		}
 		switch part.FormName() {
-		case "relation-count": // ignore
+		case "metadata", "metadata.proto", "problems", "relation-count", "transaction":
+			// ignore, as these are not partitions
 		default:
 			id, p, err := readTransactionPartition(part)
 			if err != nil {
@@ -1273,122 +3215,460 @@ func readTransactionResults(rsp *http.Response) (map[string]*Partition, error) {
 }
 
 func (c *Client) GetTransactionResults(id string) (map[string]*Partition, error) {
+	return c.GetTransactionResultsContext(c.Context(), id)
+}
+
+func (c *Client) GetTransactionResultsContext(ctx context.Context, id string) (map[string]*Partition, error) {
 	var rsp *http.Response
-	err := c.Get(makePath(PathTransactions, id, "results"), nil, nil, &rsp)
+	err := c.GetContext(ctx, makePath(PathTransactions, id, "results"), nil, nil, &rsp)
+	if err != nil {
+		return nil, err
+	}
+	defer rsp.Body.Close()
+	return readTransactionResults(rsp)
+}
+
+type listTransactionsResponse struct {
+	Transactions []Transaction `json:"transactions"`
+}
+
+func (c *Client) ListTransactions(tags ...string) ([]Transaction, error) {
+	return c.ListTransactionsContext(c.Context(), tags...)
+}
+
+func (c *Client) ListTransactionsContext(ctx context.Context, tags ...string) ([]Transaction, error) {
+	args, err := queryArgs("tags", tags)
 	if err != nil {
 		return nil, err
 	}
-	defer rsp.Body.Close()
-	return readTransactionResults(rsp)
-}
-
-type listTransactionsResponse struct {
-	Transactions []Transaction `json:"transactions"`
+
+	var result listTransactionsResponse
+	err = c.GetContext(ctx, makePath(PathTransactions), nil, args, &result)
+	return result.Transactions, err
+}
+
+type cancelTransactionResponse struct {
+	Message string `json:"message"`
+}
+
+// Returned when cancelling a transaction that has already COMPLETED or
+// ABORTED, which the service reports with a 409 Conflict response.
+var ErrTransactionTerminal = errors.New("transaction in terminal state")
+
+// Requests cancellation of the given transaction, ie that the engine stop
+// executing it, and returns immediately with the service's message. Returns
+// ErrTransactionTerminal if the transaction has already COMPLETED or
+// ABORTED, in which case its outcome is unchanged: the writes of a completed
+// transaction remain committed. A transaction may still complete after
+// cancellation is requested, see AbortTransaction to confirm the outcome.
+func (c *Client) CancelTransaction(id string) (string, error) {
+	return c.CancelTransactionContext(c.Context(), id)
+}
+
+func (c *Client) CancelTransactionContext(ctx context.Context, id string) (string, error) {
+	var result cancelTransactionResponse
+	err := c.PostContext(ctx, makePath(PathTransactions, id, "cancel"), nil, nil, &result)
+	if err != nil {
+		var herr HTTPError
+		if errors.As(err, &herr) && herr.StatusCode == http.StatusConflict {
+			return "", errors.Wrapf(ErrTransactionTerminal, "transaction %s: %s", id, herr.Body)
+		}
+		return "", err
+	}
+	return result.Message, nil
+}
+
+var ErrTransactionCompleted = errors.New("transaction completed")
+
+// Aborts the given running transaction and waits until it reaches the
+// ABORTED state, at which point none of its writes are visible. Unlike
+// CancelTransaction, which only requests that execution stop, this confirms
+// the outcome: if the transaction completes before the cancellation takes
+// effect, its writes are committed and ErrTransactionCompleted is returned.
+func (c *Client) AbortTransaction(id string) error {
+	return c.AbortTransactionContext(c.Context(), id)
+}
+
+func (c *Client) AbortTransactionContext(ctx context.Context, id string) error {
+	_, err := c.CancelTransactionContext(ctx, id)
+	if err != nil && !errors.Is(err, ErrTransactionTerminal) {
+		return err
+	}
+	for pause := 500 * time.Millisecond; ; pause *= 2 {
+		rsp, err := c.GetTransactionContext(ctx, id)
+		if err != nil {
+			return err
+		}
+		switch rsp.Transaction.State {
+		case Aborted:
+			return nil
+		case Completed:
+			return errors.Wrapf(ErrTransactionCompleted, "transaction %s", id)
+		}
+		if pause > 10*time.Second {
+			pause = 10 * time.Second
+		}
+		if err := c.sleep(ctx, pause); err != nil {
+			return err
+		}
+	}
+}
+
+// TransactionResponse
+
+func (t *TransactionResponse) EnsureMetadata(c *Client) (*TransactionMetadata, error) {
+	if t.Metadata == nil {
+		metadata, err := c.GetTransactionMetadata(t.Transaction.ID)
+		if err != nil {
+			return nil, err
+		}
+		t.Metadata = metadata
+	}
+	return t.Metadata, nil
+}
+
+func (t *TransactionResponse) EnsureProblems(c *Client) ([]Problem, error) {
+	if t.Problems == nil {
+		problems, err := c.GetTransactionProblems(t.Transaction.ID)
+		if err != nil {
+			return nil, err
+		}
+		t.Problems = problems
+	}
+	return t.Problems, nil
+}
+
+func (t *TransactionResponse) EnsureResults(c *Client) (map[string]*Partition, error) {
+	if t.Partitions == nil {
+		partitions, err := c.GetTransactionResults(t.Transaction.ID)
+		if err != nil {
+			return nil, err
+		}
+		t.Partitions = partitions
+	}
+	return t.Partitions, nil
+}
+
+func (t *TransactionResponse) Partition(id string) *Partition {
+	return t.Partitions[id]
+}
+
+func (t *TransactionResponse) Relation(id string) Relation {
+	return newBaseRelation(t.Partitions[id], t.Signature(id))
+}
+
+// Answers if the given signature prefix matches the given signature, where
+// the value "_" is a position wildcard, and a TypeWildcard matches any of its
+// types.
+func matchSig(pre, sig Signature) bool {
+	if pre == nil {
+		return true
+	}
+	if len(pre) > len(sig) {
+		return false
+	}
+	for i, p := range pre {
+		if p == "_" {
+			continue
+		}
+		if w, ok := p.(*TypeWildcard); ok {
+			if !w.Match(sig[i]) {
+				return false
+			}
+			continue
+		}
+		if p != sig[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns the numeric prefix of the given relation ID, eg 10 for "10.arrow".
+func relationIDNumber(id string) (int, bool) {
+	prefix, _, _ := strings.Cut(id, ".")
+	n, err := strconv.Atoi(prefix)
+	return n, err == nil
+}
+
+// Returns the IDs of the relations in the response, eg "0.arrow", in the
+// numeric order of their prefixes, which is the order in which the
+// relations were output, so that "2.arrow" comes before "10.arrow". IDs
+// without a numeric prefix follow, in string order.
+func (t *TransactionResponse) OrderedRelationIDs() []string {
+	ids := make([]string, 0, len(t.Partitions))
+	for id := range t.Partitions {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		ni, iok := relationIDNumber(ids[i])
+		nj, jok := relationIDNumber(ids[j])
+		switch {
+		case iok && jok && ni != nj:
+			return ni < nj
+		case iok != jok:
+			return iok
+		}
+		return ids[i] < ids[j]
+	})
+	return ids
+}
+
+// Returns a collection of relations whose signature matches any of the
+// optional prefix arguments, where value "_" in the prefix matches any value in the
+// corresponding signature position, and a TypeWildcard, eg AnyNumeric, matches
+// any of its types. Relations are ordered as by `OrderedRelationIDs`.
+func (t *TransactionResponse) Relations(args ...any) RelationCollection {
+	return t.RelationsParallel(1, args...)
+}
+
+// Returns the same relations as `Relations`, but decodes the partitions
+// using up to `concurrency` goroutines, which can be significantly faster for
+// responses with many partitions. Relations are ordered by relation ID,
+// regardless of concurrency.
+func (t *TransactionResponse) RelationsParallel(concurrency int, args ...any) RelationCollection {
+	if t.Metadata == nil {
+		// cannot interpret partition data without metadata, see RawRelations
+		return RelationCollection{}
+	}
+	if t.relations == nil {
+		// construct collection of base relations
+		ids := t.OrderedRelationIDs()
+		if concurrency < 1 {
+			concurrency = 1
+		}
+		c := make(RelationCollection, len(ids))
+		next := make(chan int)
+		var wg sync.WaitGroup
+		for w := 0; w < concurrency && w < len(ids); w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := range next {
+					c[i] = newBaseRelation(t.Partitions[ids[i]], t.Signature(ids[i]))
+				}
+			}()
+		}
+		for i := range ids {
+			next <- i
+		}
+		close(next)
+		wg.Wait()
+		t.relations = c
+	}
+	return t.relations.Select(args...)
+}
+
+// Returns an iterator over the rows of the relations whose signature matches
+// the optional prefix arguments, as with `Relations`, that yields each row as
+// returned by `Relation.Row`, with constant values restored. Relations are
+// visited in the order of `OrderedRelationIDs`, and each partition is decoded
+// only when the iterator reaches it, so the rows are never collected into a
+// single relation. With Go 1.23 or later the iterator can be used in a range
+// statement, eg `for row := range rsp.Rows("output") { ... }`.
+func (t *TransactionResponse) Rows(args ...any) func(yield func([]any) bool) {
+	return func(yield func([]any) bool) {
+		if t.Metadata == nil {
+			return
+		}
+		pre := Signature(args)
+		ids := t.OrderedRelationIDs()
+		for i, id := range ids {
+			var r Relation
+			if len(t.relations) == len(ids) { // already decoded
+				r = t.relations[i]
+			} else {
+				r = newBaseRelation(t.Partitions[id], t.Signature(id))
+			}
+			if len(args) > 0 && !matchSig(pre, r.Signature()) {
+				continue
+			}
+			nrows := r.NumRows()
+			for rnum := 0; rnum < nrows; rnum++ {
+				if !yield(r.Row(rnum)) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// Returns a collection of relations decoded directly from the arrow
+// partitions, without requiring the transaction metadata. The signature of
+// each relation is the type signature of its partition, so symbols and other
+// constant values that were specialized out of the partition data are not
+// restored, and types encoded as arrow composites (eg, Int128) are returned
+// in their raw form. Relations are ordered by relation ID and may be
+// filtered by the optional signature prefix arguments, as with `Relations`.
+func (t *TransactionResponse) RawRelations(args ...any) RelationCollection {
+	c := RelationCollection{}
+	for _, id := range t.OrderedRelationIDs() {
+		c = append(c, newRawRelation(t.Partitions[id]))
+	}
+	return c.Select(args...)
+}
+
+// Returns the single value of the relation with the given ID, ignoring any
+// leading symbol columns, eg the value 42 of the relation (:output, 42).
+// Returns an error if the relation does not have exactly one row and one
+// non-symbol column.
+func (t *TransactionResponse) Scalar(id string) (any, error) {
+	if t.Metadata == nil {
+		return nil, errors.New("missing transaction metadata")
+	}
+	if _, ok := t.Partitions[id]; !ok {
+		return nil, errors.Errorf("relation '%s' not found", id)
+	}
+	rel := t.Relation(id)
+	sig := rel.Signature()
+	cnum := 0
+	for cnum < len(sig) {
+		if _, ok := sig[cnum].(string); !ok {
+			break
+		}
+		cnum++
+	}
+	if rel.NumRows() != 1 || len(sig)-cnum != 1 {
+		return nil, errors.Errorf(
+			"relation '%s' %s with %d row(s) is not a scalar", id, sig.String(), rel.NumRows())
+	}
+	return rel.Column(cnum).Value(0), nil
 }
 
-func (c *Client) ListTransactions(tags ...string) ([]Transaction, error) {
-	args, err := queryArgs("tags", tags)
+// Returns the scalar value of the given relation as type T.
+func scalarAs[T any](t *TransactionResponse, id string) (T, error) {
+	var zero T
+	v, err := t.Scalar(id)
 	if err != nil {
-		return nil, err
+		return zero, err
+	}
+	result, ok := v.(T)
+	if !ok {
+		return zero, errors.Errorf("relation '%s' value %v is a %T, not a %T", id, v, v, zero)
 	}
+	return result, nil
+}
 
-	var result listTransactionsResponse
-	err = c.Get(makePath(PathTransactions), nil, args, &result)
-	return result.Transactions, err
+func (t *TransactionResponse) Int64Scalar(id string) (int64, error) {
+	return scalarAs[int64](t, id)
 }
 
-type cancelTransactionResponse struct {
-	Message string `json:"message"`
+func (t *TransactionResponse) Float64Scalar(id string) (float64, error) {
+	return scalarAs[float64](t, id)
 }
 
-func (c *Client) CancelTransaction(id string) (string, error) {
-	var result cancelTransactionResponse
-	if err := c.Post(makePath(PathTransactions, id, "cancel"), nil, nil, &result); err != nil {
-		return "", err
-	}
-	return result.Message, nil
+func (t *TransactionResponse) StringScalar(id string) (string, error) {
+	return scalarAs[string](t, id)
 }
 
-// TransactionResponse
+// Returns the partition with the given relation ID encoded as an arrow IPC
+// stream, for use with other arrow based tools.
+func (t *TransactionResponse) ArrowIPC(id string) ([]byte, error) {
+	p, ok := t.Partitions[id]
+	if !ok {
+		return nil, errors.Errorf("relation '%s' not found", id)
+	}
+	return p.ArrowIPC()
+}
 
-func (t *TransactionResponse) EnsureMetadata(c *Client) (*TransactionMetadata, error) {
-	if t.Metadata == nil {
-		metadata, err := c.GetTransactionMetadata(t.Transaction.ID)
+// Returns all partitions encoded as arrow IPC streams, keyed by relation ID.
+// Each partition is a separate stream because partitions generally have
+// different schemas.
+func (t *TransactionResponse) ArrowIPCAll() (map[string][]byte, error) {
+	result := make(map[string][]byte, len(t.Partitions))
+	for id, p := range t.Partitions {
+		data, err := p.ArrowIPC()
 		if err != nil {
 			return nil, err
 		}
-		t.Metadata = metadata
+		result[id] = data
 	}
-	return t.Metadata, nil
+	return result, nil
 }
 
-func (t *TransactionResponse) EnsureProblems(c *Client) ([]Problem, error) {
-	if t.Problems == nil {
-		problems, err := c.GetTransactionProblems(t.Transaction.ID)
-		if err != nil {
-			return nil, err
-		}
-		t.Problems = problems
+// Returns how long the transaction ran, as reported by the service, or
+// computed from its creation and finish times if the service does not report
+// a duration. Returns zero if the transaction has not finished.
+func (t TransactionResponse) Duration() time.Duration {
+	tx := t.Transaction
+	if tx.Duration > 0 {
+		return time.Duration(tx.Duration) * time.Millisecond
 	}
-	return t.Problems, nil
+	if tx.FinishedAt > 0 && tx.CreatedOn > 0 {
+		return time.Duration(tx.FinishedAt-tx.CreatedOn) * time.Millisecond
+	}
+	return 0
 }
 
-func (t *TransactionResponse) EnsureResults(c *Client) (map[string]*Partition, error) {
-	if t.Partitions == nil {
-		partitions, err := c.GetTransactionResults(t.Transaction.ID)
-		if err != nil {
-			return nil, err
+// Returns the distinct, sorted names of the relations in the response, eg
+// ["output", "rel"], where a relation's name is the leading symbol of its
+// signature. Relations whose signature does not start with a symbol are
+// ignored. Returns nil if the response has no metadata.
+func (t TransactionResponse) OutputNames() []string {
+	if t.Metadata == nil {
+		return nil
+	}
+	seen := map[string]bool{}
+	result := []string{}
+	for _, sig := range t.Metadata.Signatures() {
+		if len(sig) == 0 {
+			continue
+		}
+		if name, ok := sig[0].(string); ok && !seen[name] {
+			seen[name] = true
+			result = append(result, name)
 		}
-		t.Partitions = partitions
 	}
-	return t.Partitions, nil
+	sort.Strings(result)
+	return result
 }
 
-func (t *TransactionResponse) Partition(id string) *Partition {
-	return t.Partitions[id]
+// Signature prefixes of the relations that report diagnostics, rather than
+// results, eg integrity constraint violations.
+var DefaultDiagnosticPrefixes = []Signature{
+	{"rel", "catalog", "diagnostic"},
+	{"rel", "catalog", "ic_violation"},
 }
 
-func (t *TransactionResponse) Relation(id string) Relation {
-	return newBaseRelation(t.Partitions[id], t.Signature(id))
+// Answers if the given relation matches any of the given signature prefixes.
+func isDiagnostic(r Relation, prefixes []Signature) bool {
+	for _, pre := range prefixes {
+		if matchSig(pre, r.Signature()) {
+			return true
+		}
+	}
+	return false
 }
 
-// Answers if the given signature prefix matches the given signature, where
-// the value "_" is a position wildcard.
-func matchSig(pre, sig Signature) bool {
-	if pre == nil {
-		return true
+// Returns the relations of the response that report diagnostics, ie whose
+// signature matches one of the given prefixes, or one of the
+// DefaultDiagnosticPrefixes if none are given.
+func (t *TransactionResponse) Diagnostics(prefixes ...Signature) RelationCollection {
+	if len(prefixes) == 0 {
+		prefixes = DefaultDiagnosticPrefixes
 	}
-	if len(pre) > len(sig) {
-		return false
-	}
-	for i, p := range pre {
-		if p == "_" {
-			continue
-		}
-		if p != sig[i] {
-			return false
+	c := RelationCollection{}
+	for _, r := range t.Relations() {
+		if isDiagnostic(r, prefixes) {
+			c = append(c, r)
 		}
 	}
-	return true
+	return c
 }
 
-// Returns a collection of relations whose signature matches any of the
-// optional prefix arguments, where value "_" in the prefix matches any value in the
-// corresponding signature position.
-func (t *TransactionResponse) Relations(args ...any) RelationCollection {
-	if t.Metadata == nil {
-		// cannot interpret partition data as without metadata
-		return RelationCollection{}
+// Returns the relations of the response that are not diagnostics, as
+// selected by `Diagnostics` with the same prefixes.
+func (t *TransactionResponse) UserRelations(prefixes ...Signature) RelationCollection {
+	if len(prefixes) == 0 {
+		prefixes = DefaultDiagnosticPrefixes
 	}
-	if t.relations == nil {
-		// construct collection of base relations
-		c := RelationCollection{}
-		for id, p := range t.Partitions {
-			c = append(c, newBaseRelation(p, t.Signature(id)))
+	c := RelationCollection{}
+	for _, r := range t.Relations() {
+		if !isDiagnostic(r, prefixes) {
+			c = append(c, r)
 		}
-		t.relations = c
 	}
-	return t.relations.Select(args...)
+	return c
 }
 
 // Returns the type signature corresponding to the given relation ID.
@@ -1396,9 +3676,25 @@ func (t TransactionResponse) Signature(id string) Signature {
 	return t.Metadata.Signature(id)
 }
 
+// Returns the type signatures of the relations whose leading symbol is the
+// given name, keyed by relation ID. The signatures are taken from the
+// metadata alone, so a query's output schema can be checked without
+// fetching or decoding its results, eg using the metadata returned by
+// `GetTransactionMetadata`.
+func (t TransactionResponse) SignatureByName(name string) map[string]Signature {
+	if t.Metadata == nil {
+		return map[string]Signature{}
+	}
+	return t.Metadata.SignaturesByName(name)
+}
+
 // Transaction based operations
 
 func (c *Client) ListEDBs(database, engine string) ([]EDB, error) {
+	return c.ListEDBsContext(c.Context(), database, engine)
+}
+
+func (c *Client) ListEDBsContext(ctx context.Context, database, engine string) ([]EDB, error) {
 	var result listEDBsResponse
 	tx := &TransactionV1{
 		Region:   c.Region,
@@ -1407,7 +3703,7 @@ func (c *Client) ListEDBs(database, engine string) ([]EDB, error) {
 		Mode:     "OPEN",
 		Readonly: true}
 	data := tx.Payload(makeListEDBAction())
-	err := c.Post(PathTransaction, tx.QueryArgs(), data, &result)
+	err := c.PostContext(ctx, PathTransaction, tx.QueryArgs(), data, &result)
 	if err != nil {
 		return nil, err
 	}
@@ -1420,12 +3716,67 @@ func (c *Client) ListEDBs(database, engine string) ([]EDB, error) {
 	return result.Actions[0].Result.Rels, nil
 }
 
+// Returns the given database along with its installed models and base
+// relations. The models and base relations are listed by a single
+// transaction, rather than one transaction each as with ListModels and
+// ListEDBs.
+func (c *Client) DescribeDatabase(database, engine string) (*DatabaseOverview, error) {
+	return c.DescribeDatabaseContext(c.Context(), database, engine)
+}
+
+func (c *Client) DescribeDatabaseContext(
+	ctx context.Context, database, engine string,
+) (*DatabaseOverview, error) {
+	db, err := c.GetDatabaseContext(ctx, database)
+	if err != nil {
+		return nil, err
+	}
+	var result describeDatabaseResponse
+	tx := &TransactionV1{
+		Region:   c.Region,
+		Database: database,
+		Engine:   engine,
+		Mode:     "OPEN",
+		Readonly: true}
+	data := tx.Payload(makeListModelsAction(), makeListEDBAction())
+	if err = c.PostContext(ctx, PathTransaction, tx.QueryArgs(), data, &result); err != nil {
+		return nil, err
+	}
+	overview := &DatabaseOverview{Database: *db, Models: []Model{}, EDBs: []EDB{}}
+	for i, action := range result.Actions {
+		switch {
+		case action.Name == "action0" || action.Name == "" && i == 0:
+			overview.Models = append(overview.Models, action.Result.Models...)
+		case action.Name == "action1" || action.Name == "" && i == 1:
+			overview.EDBs = append(overview.EDBs, action.Result.Rels...)
+		}
+	}
+	return overview, nil
+}
+
+// CSVMode determines how loaded CSV data is combined with the existing
+// contents of the target relation.
+type CSVMode int
+
+const (
+	// Insert the loaded data into the relation, keeping its existing
+	// contents, so loading the same data twice is harmless but loading
+	// different data into the same row positions merges the rows.
+	CSVModeInsert CSVMode = iota
+
+	// Replace the contents of the relation with the loaded data. The delete
+	// and insert happen in the same transaction, so the relation is never
+	// observed empty, and a failed load leaves it unchanged.
+	CSVModeReplace
+)
+
 type CSVOptions struct {
 	Schema     map[string]string
 	HeaderRow  *int
 	Delim      rune
 	EscapeChar rune
 	QuoteChar  rune
+	Mode       CSVMode
 }
 
 func NewCSVOptions() *CSVOptions {
@@ -1457,6 +3808,11 @@ func (opts *CSVOptions) WithSchema(schema map[string]string) *CSVOptions {
 	return opts
 }
 
+func (opts *CSVOptions) WithMode(mode CSVMode) *CSVOptions {
+	opts.Mode = mode
+	return opts
+}
+
 // Generates Rel schema config defs for the given CSV options.
 func genSchemaConfig(b *strings.Builder, opts *CSVOptions) {
 	if opts == nil {
@@ -1478,26 +3834,13 @@ func genSchemaConfig(b *strings.Builder, opts *CSVOptions) {
 	b.WriteString("}\n")
 }
 
-func genLiteralInt(v int) string {
-	return strconv.Itoa(v)
-}
-
-func genLiteralRune(v rune) string {
-	if v == '\'' {
-		return "'\\''"
-	}
-	return fmt.Sprintf("'%s'", string(v))
-}
-
-// Returns a Rel literal for the given value.
+// Returns a Rel literal for the given syntax option value.
 func genLiteral(v interface{}) string {
-	switch vv := v.(type) {
-	case int:
-		return genLiteralInt(vv)
-	case rune:
-		return genLiteralRune(vv)
+	lit, err := RelLiteral(v)
+	if err != nil {
+		panic("unreached")
 	}
-	panic("unreached")
+	return lit
 }
 
 // Generates a Rel syntax config def for the given option name and value.
@@ -1528,29 +3871,198 @@ func genSyntaxConfig(b *strings.Builder, opts *CSVOptions) {
 
 // Generate Rel to load CSV data into a relation with the given name.
 func genLoadCSV(relation string, opts *CSVOptions) string {
+	return genLoadCSVAt(relation, opts, 0)
+}
+
+// Generate Rel to load CSV data into a relation with the given name, adding
+// the given offset to the position of each row, so that rows loaded by
+// separate transactions do not share positions.
+func genLoadCSVAt(relation string, opts *CSVOptions, offset int) string {
 	b := new(strings.Builder)
 	genSyntaxConfig(b, opts)
 	genSchemaConfig(b, opts)
 	b.WriteString("def config[:data]: data\n")
-	b.WriteString(fmt.Sprintf("def insert[:%s]: load_csv[config]", relation))
+	if opts != nil && opts.Mode == CSVModeReplace {
+		b.WriteString(fmt.Sprintf("def delete[:%s]: %s\n", relation, relation))
+	}
+	if offset == 0 {
+		b.WriteString(fmt.Sprintf("def insert[:%s]: load_csv[config]", relation))
+	} else {
+		b.WriteString(fmt.Sprintf(
+			"def insert[:%s](col, pos, v): exists((p) | load_csv[config](col, p, v) and pos = p + %d)",
+			relation, offset))
+	}
 	return b.String()
 }
 
 func (c *Client) LoadCSV(
 	database, engine, relation string, r io.Reader, opts *CSVOptions,
 ) (*TransactionResult, error) {
+	return c.LoadCSVContext(c.Context(), database, engine, relation, r, opts)
+}
+
+func (c *Client) LoadCSVContext(
+	ctx context.Context, database, engine, relation string, r io.Reader, opts *CSVOptions,
+) (*TransactionResult, error) {
+	if err := checkRelationName(relation); err != nil {
+		return nil, err
+	}
 	data, err := ioutil.ReadAll(r)
 	if err != nil {
 		return nil, err
 	}
 	source := genLoadCSV(relation, opts)
 	inputs := map[string]string{"data": string(data)}
-	return c.ExecuteV1(database, engine, source, inputs, false)
+	return c.ExecuteV1Context(ctx, database, engine, source, inputs, false)
+}
+
+// Reads the next CSV record from the given reader, including its line
+// terminator, taking account of line breaks within quoted fields. Returns
+// io.EOF when there are no more records.
+func readCSVRecord(r *bufio.Reader, quote, escape rune) (string, error) {
+	var b strings.Builder
+	inQuote := false
+	for {
+		line, err := r.ReadString('\n')
+		b.WriteString(line)
+		escaped := false
+		for _, ch := range line {
+			switch {
+			case escaped:
+				escaped = false
+			case ch == escape && escape != quote && inQuote:
+				escaped = true
+			case ch == quote:
+				inQuote = !inQuote
+			}
+		}
+		if err != nil {
+			if err == io.EOF && b.Len() > 0 {
+				return b.String(), nil
+			}
+			return "", err
+		}
+		if !inQuote {
+			return b.String(), nil
+		}
+	}
+}
+
+// Loads CSV data into the given relation in batches of at most `batchRows`
+// rows, executing one transaction per batch and calling `onBatch`, if not
+// nil, with the total number of rows loaded after each batch. The header
+// rows, as given by the `HeaderRow` option, are read once and sent with each
+// batch so that every batch has the same columns. Returns the number of data
+// rows loaded, which on failure can be used to resume the load from the
+// following row.
+//
+// The positions of the rows of each batch after the first are offset by the
+// size of the batches before it, so that rows from different batches never
+// share a position and are appended to the relation rather than merged.
+// Positions are therefore unique and increase with the row's place in the
+// input, but differ from those given by LoadCSV for the same data. In
+// CSVModeReplace, only the first batch replaces the relation, and later
+// batches are inserted.
+func (c *Client) LoadCSVBatched(
+	database, engine, relation string, r io.Reader, opts *CSVOptions,
+	batchRows int, onBatch func(n int),
+) (int, error) {
+	return c.LoadCSVBatchedContext(c.Context(), database, engine, relation, r, opts, batchRows, onBatch)
+}
+
+func (c *Client) LoadCSVBatchedContext(
+	ctx context.Context, database, engine, relation string, r io.Reader, opts *CSVOptions,
+	batchRows int, onBatch func(n int),
+) (int, error) {
+	if batchRows <= 0 {
+		return 0, errors.Errorf("invalid batch size %d", batchRows)
+	}
+	if err := checkRelationName(relation); err != nil {
+		return 0, err
+	}
+	quote, escape := '"', '\\'
+	nheader := 1
+	if opts != nil {
+		if opts.QuoteChar != 0 {
+			quote = opts.QuoteChar
+		}
+		if opts.EscapeChar != 0 {
+			escape = opts.EscapeChar
+		}
+		if opts.HeaderRow != nil {
+			nheader = *opts.HeaderRow
+		}
+	}
+	br := bufio.NewReader(r)
+	var header strings.Builder
+	for i := 0; i < nheader; i++ {
+		rec, err := readCSVRecord(br, quote, escape)
+		if err == io.EOF {
+			return 0, nil // no data
+		}
+		if err != nil {
+			return 0, err
+		}
+		header.WriteString(rec)
+	}
+	batchOpts := opts
+	total, offset := 0, 0
+	for {
+		var batch strings.Builder
+		batch.WriteString(header.String())
+		n := 0
+		for ; n < batchRows; n++ {
+			rec, err := readCSVRecord(br, quote, escape)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return total, err
+			}
+			batch.WriteString(rec)
+		}
+		if n == 0 {
+			return total, nil
+		}
+		source := genLoadCSVAt(relation, batchOpts, offset)
+		inputs := map[string]string{"data": batch.String()}
+		rsp, err := c.ExecuteV1Context(ctx, database, engine, source, inputs, false)
+		if err != nil {
+			return total, err
+		}
+		if rsp.Aborted {
+			return total, errors.Errorf("batch at row %d aborted", total)
+		}
+		if total == 0 && opts != nil && opts.Mode == CSVModeReplace {
+			insertOpts := *opts
+			insertOpts.Mode = CSVModeInsert
+			batchOpts = &insertOpts
+		}
+		// positions within a batch, whether line numbers or byte offsets,
+		// are at most its size
+		offset += batch.Len()
+		total += n
+		if onBatch != nil {
+			onBatch(total)
+		}
+		if n < batchRows {
+			return total, nil
+		}
+	}
 }
 
 func (c *Client) LoadJSON(
 	database, engine, relation string, r io.Reader,
 ) (*TransactionResult, error) {
+	return c.LoadJSONContext(c.Context(), database, engine, relation, r)
+}
+
+func (c *Client) LoadJSONContext(
+	ctx context.Context, database, engine, relation string, r io.Reader,
+) (*TransactionResult, error) {
+	if err := checkRelationName(relation); err != nil {
+		return nil, err
+	}
 	data, err := ioutil.ReadAll(r)
 	if err != nil {
 		return nil, err
@@ -1559,7 +4071,7 @@ func (c *Client) LoadJSON(
 	b.WriteString("def config[:data]: data\n")
 	b.WriteString(fmt.Sprintf("def insert[:%s]: load_json[config]", relation))
 	inputs := map[string]string{"data": string(data)}
-	return c.ExecuteV1(database, engine, b.String(), inputs, false)
+	return c.ExecuteV1Context(ctx, database, engine, b.String(), inputs, false)
 }
 
 //
@@ -1567,12 +4079,18 @@ func (c *Client) LoadJSON(
 //
 
 func (c *Client) CreateUser(email string, roles []string) (*User, error) {
+	return c.CreateUserContext(c.Context(), email, roles)
+}
+
+func (c *Client) CreateUserContext(
+	ctx context.Context, email string, roles []string,
+) (*User, error) {
 	if len(roles) == 0 {
 		roles = append(roles, "user")
 	}
 	var result createUserResponse
 	data := &createUserRequest{Email: email, Roles: roles}
-	err := c.Post(PathUsers, nil, data, &result)
+	err := c.PostContext(ctx, PathUsers, nil, data, &result)
 	if err != nil {
 		return nil, err
 	}
@@ -1580,8 +4098,12 @@ func (c *Client) CreateUser(email string, roles []string) (*User, error) {
 }
 
 func (c *Client) DeleteUser(id string) (*DeleteUserResponse, error) {
+	return c.DeleteUserContext(c.Context(), id)
+}
+
+func (c *Client) DeleteUserContext(ctx context.Context, id string) (*DeleteUserResponse, error) {
 	var result DeleteUserResponse
-	err := c.Delete(makePath(PathUsers, id), nil, nil, &result)
+	err := c.DeleteContext(ctx, makePath(PathUsers, id), nil, nil, &result)
 	if err != nil {
 		return nil, err
 	}
@@ -1589,18 +4111,30 @@ func (c *Client) DeleteUser(id string) (*DeleteUserResponse, error) {
 }
 
 func (c *Client) DisableUser(id string) (*User, error) {
+	return c.DisableUserContext(c.Context(), id)
+}
+
+func (c *Client) DisableUserContext(ctx context.Context, id string) (*User, error) {
 	req := UpdateUserRequest{Status: "INACTIVE"}
-	return c.UpdateUser(id, req)
+	return c.UpdateUserContext(ctx, id, req)
 }
 
 func (c *Client) EnableUser(id string) (*User, error) {
+	return c.EnableUserContext(c.Context(), id)
+}
+
+func (c *Client) EnableUserContext(ctx context.Context, id string) (*User, error) {
 	req := UpdateUserRequest{Status: "ACTIVE"}
-	return c.UpdateUser(id, req)
+	return c.UpdateUserContext(ctx, id, req)
 }
 
 // Returns the User with the given email or nil if it does not exist.
 func (c *Client) FindUser(email string) (*User, error) {
-	users, err := c.ListUsers()
+	return c.FindUserContext(c.Context(), email)
+}
+
+func (c *Client) FindUserContext(ctx context.Context, email string) (*User, error) {
+	users, err := c.ListUsersContext(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -1613,8 +4147,12 @@ func (c *Client) FindUser(email string) (*User, error) {
 }
 
 func (c *Client) GetUser(id string) (*User, error) {
+	return c.GetUserContext(c.Context(), id)
+}
+
+func (c *Client) GetUserContext(ctx context.Context, id string) (*User, error) {
 	var result getUserResponse
-	err := c.Get(makePath(PathUsers, id), nil, nil, &result)
+	err := c.GetContext(ctx, makePath(PathUsers, id), nil, nil, &result)
 	if err != nil {
 		return nil, err
 	}
@@ -1622,8 +4160,12 @@ func (c *Client) GetUser(id string) (*User, error) {
 }
 
 func (c *Client) ListUsers() ([]User, error) {
+	return c.ListUsersContext(c.Context())
+}
+
+func (c *Client) ListUsersContext(ctx context.Context) ([]User, error) {
 	var result listUsersResponse
-	err := c.Get(PathUsers, nil, nil, &result)
+	err := c.GetContext(ctx, PathUsers, nil, nil, &result)
 	if err != nil {
 		return nil, err
 	}
@@ -1631,8 +4173,27 @@ func (c *Client) ListUsers() ([]User, error) {
 }
 
 func (c *Client) UpdateUser(id string, req UpdateUserRequest) (*User, error) {
+	return c.UpdateUserContext(c.Context(), id, req)
+}
+
+func (c *Client) UpdateUserContext(
+	ctx context.Context, id string, req UpdateUserRequest,
+) (*User, error) {
+	return c.UpdateUserIfMatchContext(ctx, id, req, "")
+}
+
+// Update the given user, if the user's ETag matches the given ETag, eg as
+// returned by GetUser. Returns ErrConflict if the user has been modified
+// since. An empty ETag updates the user unconditionally.
+func (c *Client) UpdateUserIfMatch(id string, req UpdateUserRequest, etag string) (*User, error) {
+	return c.UpdateUserIfMatchContext(c.Context(), id, req, etag)
+}
+
+func (c *Client) UpdateUserIfMatchContext(
+	ctx context.Context, id string, req UpdateUserRequest, etag string,
+) (*User, error) {
 	var result updateUserResponse
-	err := c.Patch(makePath(PathUsers, id), nil, &req, &result)
+	err := c.requestContext(ctx, http.MethodPatch, makePath(PathUsers, id), ifMatch(etag), nil, &req, &result)
 	if err != nil {
 		return nil, err
 	}
@@ -1645,13 +4206,19 @@ func (c *Client) UpdateUser(id string, req UpdateUserRequest) (*User, error) {
 
 func (c *Client) CreateSnowflakeIntegration(
 	name, snowflakeAccount string, adminCreds, proxyCreds *SnowflakeCredentials,
+) (*Integration, error) {
+	return c.CreateSnowflakeIntegrationContext(c.Context(), name, snowflakeAccount, adminCreds, proxyCreds)
+}
+
+func (c *Client) CreateSnowflakeIntegrationContext(
+	ctx context.Context, name, snowflakeAccount string, adminCreds, proxyCreds *SnowflakeCredentials,
 ) (*Integration, error) {
 	var result Integration
 	req := createSnowflakeIntegrationRequest{Name: name}
 	req.Snowflake.Account = snowflakeAccount
 	req.Snowflake.Admin = *adminCreds
 	req.Snowflake.Proxy = *proxyCreds
-	if err := c.Post(PathIntegrationsAlpha, nil, &req, &result); err != nil {
+	if err := c.PostContext(ctx, PathIntegrationsAlpha, nil, &req, &result); err != nil {
 		return nil, err
 	}
 	return &result, nil
@@ -1659,32 +4226,66 @@ func (c *Client) CreateSnowflakeIntegration(
 
 func (c *Client) UpdateSnowflakeIntegration(
 	name, raiClientID, raiClientSecret string, proxyCreds *SnowflakeCredentials,
+) error {
+	return c.UpdateSnowflakeIntegrationContext(c.Context(), name, raiClientID, raiClientSecret, proxyCreds)
+}
+
+func (c *Client) UpdateSnowflakeIntegrationContext(
+	ctx context.Context, name, raiClientID, raiClientSecret string, proxyCreds *SnowflakeCredentials,
+) error {
+	return c.UpdateSnowflakeIntegrationIfMatchContext(ctx, name, raiClientID, raiClientSecret, proxyCreds, "")
+}
+
+// Update the given integration, if its ETag matches the given ETag, and
+// otherwise return ErrConflict. An empty ETag updates unconditionally.
+func (c *Client) UpdateSnowflakeIntegrationIfMatch(
+	name, raiClientID, raiClientSecret string, proxyCreds *SnowflakeCredentials, etag string,
+) error {
+	return c.UpdateSnowflakeIntegrationIfMatchContext(c.Context(), name, raiClientID, raiClientSecret, proxyCreds, etag)
+}
+
+func (c *Client) UpdateSnowflakeIntegrationIfMatchContext(
+	ctx context.Context, name, raiClientID, raiClientSecret string, proxyCreds *SnowflakeCredentials, etag string,
 ) error {
 	var result Integration
 	req := updateSnowflakeIntegrationRequest{Name: name}
 	req.Snowflake.Proxy = *proxyCreds
 	req.RAI.ClientID = raiClientID
 	req.RAI.ClientSecret = raiClientSecret
-	return c.Patch(PathIntegrationsAlpha, nil, &req, &result)
+	return c.requestContext(ctx, http.MethodPatch, PathIntegrationsAlpha, ifMatch(etag), nil, &req, &result)
 }
 
 func (c *Client) DeleteSnowflakeIntegration(name string, adminCreds *SnowflakeCredentials) error {
+	return c.DeleteSnowflakeIntegrationContext(c.Context(), name, adminCreds)
+}
+
+func (c *Client) DeleteSnowflakeIntegrationContext(
+	ctx context.Context, name string, adminCreds *SnowflakeCredentials,
+) error {
 	req := deleteSnowflakeIntegrationRequest{}
 	req.Snowflake.Admin = *adminCreds
-	return c.Delete(makePath(PathIntegrationsAlpha, name), nil, &req, nil)
+	return c.DeleteContext(ctx, makePath(PathIntegrationsAlpha, name), nil, &req, nil)
 }
 
 func (c *Client) GetSnowflakeIntegration(name string) (*Integration, error) {
+	return c.GetSnowflakeIntegrationContext(c.Context(), name)
+}
+
+func (c *Client) GetSnowflakeIntegrationContext(ctx context.Context, name string) (*Integration, error) {
 	var result Integration
-	if err := c.Get(makePath(PathIntegrationsAlpha, name), nil, nil, &result); err != nil {
+	if err := c.GetContext(ctx, makePath(PathIntegrationsAlpha, name), nil, nil, &result); err != nil {
 		return nil, err
 	}
 	return &result, nil
 }
 
 func (c *Client) ListSnowflakeIntegrations() ([]Integration, error) {
+	return c.ListSnowflakeIntegrationsContext(c.Context())
+}
+
+func (c *Client) ListSnowflakeIntegrationsContext(ctx context.Context) ([]Integration, error) {
 	var result []Integration
-	if err := c.Get(PathIntegrationsAlpha, nil, nil, &result); err != nil {
+	if err := c.GetContext(ctx, PathIntegrationsAlpha, nil, nil, &result); err != nil {
 		return nil, err
 	}
 	return result, nil
@@ -1704,6 +4305,12 @@ func (c *Client) ListSnowflakeIntegrations() ([]Integration, error) {
 // assigned to the specified role
 func (c *Client) CreateSnowflakeDatabaseLink(
 	integration, database, schema, role string, creds *SnowflakeCredentials,
+) (*SnowflakeDatabaseLink, error) {
+	return c.CreateSnowflakeDatabaseLinkContext(c.Context(), integration, database, schema, role, creds)
+}
+
+func (c *Client) CreateSnowflakeDatabaseLinkContext(
+	ctx context.Context, integration, database, schema, role string, creds *SnowflakeCredentials,
 ) (*SnowflakeDatabaseLink, error) {
 	var result SnowflakeDatabaseLink
 	path := makePath(PathIntegrationsAlpha, integration, "database-links")
@@ -1712,7 +4319,7 @@ func (c *Client) CreateSnowflakeDatabaseLink(
 	req.Snowflake.Schema = schema
 	req.Snowflake.Role = role
 	req.Snowflake.Credentials = *creds
-	if err := c.Post(path, nil, &req, &result); err != nil {
+	if err := c.PostContext(ctx, path, nil, &req, &result); err != nil {
 		return nil, err
 	}
 	return &result, nil
@@ -1720,6 +4327,12 @@ func (c *Client) CreateSnowflakeDatabaseLink(
 
 func (c *Client) UpdateSnowflakeDatabaseLink(
 	integration, database, schema, role string, creds *SnowflakeCredentials,
+) error {
+	return c.UpdateSnowflakeDatabaseLinkContext(c.Context(), integration, database, schema, role, creds)
+}
+
+func (c *Client) UpdateSnowflakeDatabaseLinkContext(
+	ctx context.Context, integration, database, schema, role string, creds *SnowflakeCredentials,
 ) error {
 	var result SnowflakeDatabaseLink
 	name := fmt.Sprintf("%s.%s", database, schema)
@@ -1727,27 +4340,39 @@ func (c *Client) UpdateSnowflakeDatabaseLink(
 	req := updateSnowflakeDatabaseLinkRequest{}
 	req.Snowflake.Role = role
 	req.Snowflake.Credentials = *creds
-	return c.Patch(path, nil, &req, &result)
+	return c.PatchContext(ctx, path, nil, &req, &result)
 }
 
 func (c *Client) DeleteSnowflakeDatabaseLink(
 	integration, database, schema, role string, creds *SnowflakeCredentials,
+) error {
+	return c.DeleteSnowflakeDatabaseLinkContext(c.Context(), integration, database, schema, role, creds)
+}
+
+func (c *Client) DeleteSnowflakeDatabaseLinkContext(
+	ctx context.Context, integration, database, schema, role string, creds *SnowflakeCredentials,
 ) error {
 	name := fmt.Sprintf("%s.%s", database, schema)
 	path := makePath(PathIntegrationsAlpha, integration, "database-links", name)
 	req := deleteSnowflakeDatabaseLinkRequest{}
 	req.Snowflake.Role = role
 	req.Snowflake.Credentials = *creds
-	return c.Delete(path, nil, &req, nil)
+	return c.DeleteContext(ctx, path, nil, &req, nil)
 }
 
 func (c *Client) GetSnowflakeDatabaseLink(
 	integration, database, schema string,
+) (*SnowflakeDatabaseLink, error) {
+	return c.GetSnowflakeDatabaseLinkContext(c.Context(), integration, database, schema)
+}
+
+func (c *Client) GetSnowflakeDatabaseLinkContext(
+	ctx context.Context, integration, database, schema string,
 ) (*SnowflakeDatabaseLink, error) {
 	var result SnowflakeDatabaseLink
 	name := fmt.Sprintf("%s.%s", database, schema)
 	path := makePath(PathIntegrationsAlpha, integration, "database-links", name)
-	if err := c.Get(path, nil, nil, &result); err != nil {
+	if err := c.GetContext(ctx, path, nil, nil, &result); err != nil {
 		return nil, err
 	}
 	return &result, nil
@@ -1755,10 +4380,16 @@ func (c *Client) GetSnowflakeDatabaseLink(
 
 func (c *Client) ListSnowflakeDatabaseLinks(
 	integration string,
+) ([]SnowflakeDatabaseLink, error) {
+	return c.ListSnowflakeDatabaseLinksContext(c.Context(), integration)
+}
+
+func (c *Client) ListSnowflakeDatabaseLinksContext(
+	ctx context.Context, integration string,
 ) ([]SnowflakeDatabaseLink, error) {
 	var result []SnowflakeDatabaseLink
 	path := makePath(PathIntegrationsAlpha, integration, "database-links")
-	if err := c.Get(path, nil, nil, &result); err != nil {
+	if err := c.GetContext(ctx, path, nil, nil, &result); err != nil {
 		return nil, err
 	}
 	return result, nil
@@ -1782,6 +4413,12 @@ type DataStreamOpts_alpha struct {
 // Creates a data stream to replicate data from a Snowflake table/view to a RAI relation.
 func (c *Client) CreateSnowflakeDataStream(
 	integration, dbLink string, opts *DataStreamOpts_alpha,
+) (*SnowflakeDataStream, error) {
+	return c.CreateSnowflakeDataStreamContext(c.Context(), integration, dbLink, opts)
+}
+
+func (c *Client) CreateSnowflakeDataStreamContext(
+	ctx context.Context, integration, dbLink string, opts *DataStreamOpts_alpha,
 ) (*SnowflakeDataStream, error) {
 	var result SnowflakeDataStream
 	path := makePath(PathIntegrationsAlpha, integration, "database-links", dbLink, "data-streams")
@@ -1792,7 +4429,7 @@ func (c *Client) CreateSnowflakeDataStream(
 	req.Snowflake.Credentials = opts.Credentials
 	req.RAI.Database = opts.RaiDatabase
 	req.RAI.Relation = opts.Relation
-	if err := c.Post(path, nil, &req, &result); err != nil {
+	if err := c.PostContext(ctx, path, nil, &req, &result); err != nil {
 		return nil, err
 	}
 	return &result, nil
@@ -1802,6 +4439,12 @@ func (c *Client) CreateSnowflakeDataStream(
 // creds are optional; passing nil will fall back to stored SF credentials
 func (c *Client) DeleteSnowflakeDataStream(
 	integration, dbLink, objectName, role string, creds *SnowflakeCredentials,
+) error {
+	return c.DeleteSnowflakeDataStreamContext(c.Context(), integration, dbLink, objectName, role, creds)
+}
+
+func (c *Client) DeleteSnowflakeDataStreamContext(
+	ctx context.Context, integration, dbLink, objectName, role string, creds *SnowflakeCredentials,
 ) error {
 	path := makePath(PathIntegrationsAlpha, integration, "database-links", dbLink, "data-streams", objectName)
 	req := deleteSnowflakeDataStreamRequest{}
@@ -1809,15 +4452,21 @@ func (c *Client) DeleteSnowflakeDataStream(
 	if creds != nil {
 		req.Snowflake.Credentials = *creds
 	}
-	return c.Delete(path, nil, &req, nil)
+	return c.DeleteContext(ctx, path, nil, &req, nil)
 }
 
 func (c *Client) GetSnowflakeDataStream(
 	integration, dbLink, objectName string,
+) (*SnowflakeDataStream, error) {
+	return c.GetSnowflakeDataStreamContext(c.Context(), integration, dbLink, objectName)
+}
+
+func (c *Client) GetSnowflakeDataStreamContext(
+	ctx context.Context, integration, dbLink, objectName string,
 ) (*SnowflakeDataStream, error) {
 	var result SnowflakeDataStream
 	path := makePath(PathIntegrationsAlpha, integration, "database-links", dbLink, "data-streams", objectName)
-	if err := c.Get(path, nil, nil, &result); err != nil {
+	if err := c.GetContext(ctx, path, nil, nil, &result); err != nil {
 		return nil, err
 	}
 	return &result, nil
@@ -1825,10 +4474,16 @@ func (c *Client) GetSnowflakeDataStream(
 
 func (c *Client) ListSnowflakeDataStreams(
 	integration, dbLink string,
+) ([]SnowflakeDataStream, error) {
+	return c.ListSnowflakeDataStreamsContext(c.Context(), integration, dbLink)
+}
+
+func (c *Client) ListSnowflakeDataStreamsContext(
+	ctx context.Context, integration, dbLink string,
 ) ([]SnowflakeDataStream, error) {
 	var result []SnowflakeDataStream
 	path := makePath(PathIntegrationsAlpha, integration, "database-links", dbLink, "data-streams")
-	if err := c.Get(path, nil, nil, &result); err != nil {
+	if err := c.GetContext(ctx, path, nil, nil, &result); err != nil {
 		return nil, err
 	}
 	return result, nil
@@ -1836,10 +4491,16 @@ func (c *Client) ListSnowflakeDataStreams(
 
 func (c *Client) GetSnowflakeDataStreamStatus(
 	integration, dbLink, objectName string,
+) (*SnowflakeDataStreamStatus, error) {
+	return c.GetSnowflakeDataStreamStatusContext(c.Context(), integration, dbLink, objectName)
+}
+
+func (c *Client) GetSnowflakeDataStreamStatusContext(
+	ctx context.Context, integration, dbLink, objectName string,
 ) (*SnowflakeDataStreamStatus, error) {
 	var result SnowflakeDataStreamStatus
 	path := makePath(PathIntegrationsAlpha, integration, "database-links", dbLink, "data-streams", objectName, "status")
-	if err := c.Get(path, nil, nil, &result); err != nil {
+	if err := c.GetContext(ctx, path, nil, nil, &result); err != nil {
 		return nil, err
 	}
 	return &result, nil
@@ -1856,6 +4517,12 @@ type DataStreamOpts struct {
 // Register snowflake datastream created by native app to replicate data from a Snowflake table/view to a RAI relation.
 func (c *Client) RegisterSnowflakeDataStream(
 	integration string, opts *DataStreamOpts,
+) (*SnowflakeDataStream, error) {
+	return c.RegisterSnowflakeDataStreamContext(c.Context(), integration, opts)
+}
+
+func (c *Client) RegisterSnowflakeDataStreamContext(
+	ctx context.Context, integration string, opts *DataStreamOpts,
 ) (*SnowflakeDataStream, error) {
 	var result SnowflakeDataStream
 	path := makePath(PathIntegrationsBeta, integration, "data-streams")
@@ -1863,7 +4530,7 @@ func (c *Client) RegisterSnowflakeDataStream(
 	req.Snowflake.Object = opts.ObjectName
 	req.RAI.Database = opts.RaiDatabase
 	req.RAI.Relation = opts.Relation
-	if err := c.Post(path, nil, &req, &result); err != nil {
+	if err := c.PostContext(ctx, path, nil, &req, &result); err != nil {
 		return nil, err
 	}
 	return &result, nil
@@ -1872,18 +4539,30 @@ func (c *Client) RegisterSnowflakeDataStream(
 // Unregisters a datastream deleted by native app
 func (c *Client) UnregisterSnowflakeDataStream(
 	integration, objectName string,
+) error {
+	return c.UnregisterSnowflakeDataStreamContext(c.Context(), integration, objectName)
+}
+
+func (c *Client) UnregisterSnowflakeDataStreamContext(
+	ctx context.Context, integration, objectName string,
 ) error {
 	path := makePath(PathIntegrationsBeta, integration, "data-streams", objectName)
-	return c.Delete(path, nil, nil, nil)
+	return c.DeleteContext(ctx, path, nil, nil, nil)
 }
 
 // Get datastream registered by native app
 func (c *Client) GetRegisteredSnowflakeDataStream(
 	integration, objectName string,
+) (*SnowflakeDataStream, error) {
+	return c.GetRegisteredSnowflakeDataStreamContext(c.Context(), integration, objectName)
+}
+
+func (c *Client) GetRegisteredSnowflakeDataStreamContext(
+	ctx context.Context, integration, objectName string,
 ) (*SnowflakeDataStream, error) {
 	var result SnowflakeDataStream
 	path := makePath(PathIntegrationsBeta, integration, "data-streams", objectName)
-	if err := c.Get(path, nil, nil, &result); err != nil {
+	if err := c.GetContext(ctx, path, nil, nil, &result); err != nil {
 		return nil, err
 	}
 	return &result, nil
@@ -1892,10 +4571,16 @@ func (c *Client) GetRegisteredSnowflakeDataStream(
 // List datastreams registered by native app associated with the integration
 func (c *Client) ListRegisteredSnowflakeDataStreams(
 	integration string,
+) ([]SnowflakeDataStream, error) {
+	return c.ListRegisteredSnowflakeDataStreamsContext(c.Context(), integration)
+}
+
+func (c *Client) ListRegisteredSnowflakeDataStreamsContext(
+	ctx context.Context, integration string,
 ) ([]SnowflakeDataStream, error) {
 	var result []SnowflakeDataStream
 	path := makePath(PathIntegrationsBeta, integration, "data-streams")
-	if err := c.Get(path, nil, nil, &result); err != nil {
+	if err := c.GetContext(ctx, path, nil, nil, &result); err != nil {
 		return nil, err
 	}
 	return result, nil
@@ -1904,10 +4589,16 @@ func (c *Client) ListRegisteredSnowflakeDataStreams(
 // Get datastream status registered by native app
 func (c *Client) GetRegisteredSnowflakeDataStreamStatus(
 	integration, objectName string,
+) (*SnowflakeDataStreamStatus, error) {
+	return c.GetRegisteredSnowflakeDataStreamStatusContext(c.Context(), integration, objectName)
+}
+
+func (c *Client) GetRegisteredSnowflakeDataStreamStatusContext(
+	ctx context.Context, integration, objectName string,
 ) (*SnowflakeDataStreamStatus, error) {
 	var result SnowflakeDataStreamStatus
 	path := makePath(PathIntegrationsBeta, integration, "data-streams", objectName, "status")
-	if err := c.Get(path, nil, nil, &result); err != nil {
+	if err := c.GetContext(ctx, path, nil, nil, &result); err != nil {
 		return nil, err
 	}
 	return &result, nil
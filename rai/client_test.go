@@ -15,17 +15,33 @@
 package rai
 
 import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"math/big"
+	"mime/multipart"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -148,6 +164,338 @@ func TestTokenCacheFile(t *testing.T) {
 	assertTokenCacheFileCreated(t)
 }
 
+func TestConfigErrors(t *testing.T) {
+	var cfg Config
+	err := LoadConfigFile(filepath.Join(t.TempDir(), "config"), "default", &cfg)
+	assert.True(t, errors.Is(err, ErrConfigFileNotFound))
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+
+	err = LoadConfigString("[default]\nhost = h\n", "other", &cfg)
+	assert.True(t, errors.Is(err, ErrConfigProfileNotFound))
+	assert.Equal(t, "config profile 'other' not found", err.Error())
+
+	err = LoadConfigString("[default]\nclient_id = id\n", "default", &cfg)
+	assert.True(t, errors.Is(err, ErrConfigMissingField))
+	var cerr ConfigError
+	assert.True(t, errors.As(err, &cerr))
+	assert.Equal(t, "client_secret", cerr.Field)
+
+	err = LoadConfigString("[default\n", "default", &cfg)
+	assert.NotNil(t, err)
+	assert.False(t, errors.Is(err, ErrConfigProfileNotFound))
+
+	assert.Nil(t, LoadConfigString("[default]\nclient_id = id\nclient_secret = s\n", "default", &cfg))
+}
+
+func TestConfigRegion(t *testing.T) {
+	var cfg Config
+	assert.Nil(t, LoadConfigString("[default]\nregion = us-east\n", "default", &cfg))
+	assert.Equal(t, "us-east", cfg.Region)
+	assert.Equal(t, "us-east", NewClient(context.Background(), &ClientOptions{Config: cfg}).Region)
+
+	// regions other than the default are accepted
+	for _, v := range []string{"eu-west", "us-west-2", " eu-central-1 "} {
+		cfg = Config{}
+		assert.Nil(t, LoadConfigString("[default]\nregion = "+v+"\n", "default", &cfg))
+		assert.Equal(t, strings.TrimSpace(v), cfg.Region)
+	}
+
+	for _, v := range []string{"", "US East", "us_east", "us-east-"} {
+		cfg = Config{}
+		err := LoadConfigString("[default]\nregion = "+v+"\n", "default", &cfg)
+		assert.True(t, errors.Is(err, ErrConfigInvalidField), v)
+		assert.True(t, errors.Is(err, ErrInvalidRegion), v)
+		assert.Equal(t, "", cfg.Region)
+	}
+
+	// options given directly are checked when the client is created
+	client, err := NewClientFromOptions(context.Background(), &ClientOptions{Config: Config{Region: "eu-west"}})
+	assert.Nil(t, err)
+	assert.Equal(t, "eu-west", client.Region)
+	client, err = NewClientFromOptions(context.Background(), &ClientOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, DefaultRegion, client.Region)
+	client, err = NewClientFromOptions(context.Background(), &ClientOptions{Config: Config{Region: "eu west"}})
+	assert.Nil(t, client)
+	assert.True(t, errors.Is(err, ErrInvalidRegion))
+}
+
+func TestConfigCredentialTypes(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "token")
+	assert.Nil(t, os.WriteFile(fname, []byte("file-token\n"), 0600))
+
+	var cfg Config
+	assert.Nil(t, LoadConfigString("[default]\naccess_token = abc\n", "default", &cfg))
+	token, err := NewClient(context.Background(), &ClientOptions{Config: cfg}).AccessToken()
+	assert.Nil(t, err)
+	assert.Equal(t, "abc", token)
+
+	cfg = Config{}
+	assert.Nil(t, LoadConfigString("[default]\naccess_token_file = "+fname+"\n", "default", &cfg))
+	token, err = NewClient(context.Background(), &ClientOptions{Config: cfg}).AccessToken()
+	assert.Nil(t, err)
+	assert.Equal(t, "file-token", token)
+
+	cfg = Config{}
+	err = LoadConfigString(
+		"[default]\naccess_token = abc\nclient_id = id\nclient_secret = s\n", "default", &cfg)
+	assert.True(t, errors.Is(err, ErrConfigCredentials))
+}
+
+func TestConfigClientCredentialsUrl(t *testing.T) {
+	const creds = "[default]\nclient_id = id\nclient_secret = s\n"
+	var cfg Config
+	assert.Nil(t, LoadConfigString(creds, "default", &cfg))
+	assert.Equal(t, defaultClientCredentialsUrl, cfg.Credentials.ClientCredentialsUrl)
+
+	cfg = Config{}
+	err := LoadConfigString(
+		creds+"client_credentials_url = https://login.staging.example.com/oauth/token\n", "default", &cfg)
+	assert.Nil(t, err)
+	assert.Equal(t, "https://login.staging.example.com/oauth/token", cfg.Credentials.ClientCredentialsUrl)
+	client := NewClient(context.Background(), &ClientOptions{Config: cfg})
+	assert.Equal(t, cfg.Credentials, client.accessTokenHandler.(*ClientCredentialsHandler).creds)
+
+	for _, v := range []string{"/oauth/token", "login.example.com/oauth/token", "https://"} {
+		cfg = Config{}
+		err = LoadConfigString(creds+"client_credentials_url = "+v+"\n", "default", &cfg)
+		assert.True(t, errors.Is(err, ErrConfigInvalidField), v)
+	}
+}
+
+func TestStaticTokenHandler(t *testing.T) {
+	handler := NewStaticTokenHandler("abc", time.Now().Add(time.Hour))
+	token, err := handler.GetAccessToken()
+	assert.Nil(t, err)
+	assert.Equal(t, "abc", token)
+
+	handler = NewStaticTokenHandler("abc", time.Time{})
+	token, err = handler.GetAccessToken()
+	assert.Nil(t, err)
+	assert.Equal(t, "abc", token)
+
+	handler = NewStaticTokenHandler("abc", time.Now().Add(-time.Second))
+	token, err = handler.GetAccessToken()
+	assert.Equal(t, ErrAccessTokenExpired, err)
+	assert.Equal(t, "", token)
+}
+
+func TestTokenRefresh(t *testing.T) {
+	var count int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&count, 1)
+		fmt.Fprintf(w, `{"access_token": "token-%d", "expires_in": 3600}`, n)
+	}))
+	defer server.Close()
+
+	client := NewClient(context.Background(), &ClientOptions{})
+	creds := &ClientCredentials{
+		ClientID:             fmt.Sprintf("rai-sdk-go-%s", uuid.New().String()),
+		ClientSecret:         "secret",
+		ClientCredentialsUrl: server.URL,
+	}
+	handler := NewClientCredentialsHandler(client, creds)
+	handler.Start(context.Background(), time.Minute)
+	for i := 0; i < 100 && handler.currentToken() == nil; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	handler.Stop()
+	handler.Stop() // stopping twice is harmless
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&count))
+	token, err := handler.GetAccessToken()
+	assert.Nil(t, err)
+	assert.Equal(t, "token-1", token)
+}
+
+// Test that background refresh can be restarted after its context is done.
+func TestTokenRefreshRestart(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"access_token": "token", "expires_in": 3600}`)
+	}))
+	defer server.Close()
+
+	client := NewClient(context.Background(), &ClientOptions{})
+	creds := &ClientCredentials{
+		ClientID:             fmt.Sprintf("rai-sdk-go-%s", uuid.New().String()),
+		ClientSecret:         "secret",
+		ClientCredentialsUrl: server.URL,
+	}
+	handler := NewClientCredentialsHandler(client, creds)
+	running := func() bool {
+		handler.mu.Lock()
+		defer handler.mu.Unlock()
+		return handler.stop != nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	handler.Start(ctx, time.Minute)
+	assert.True(t, running())
+	cancel()
+	for i := 0; i < 100 && running(); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.False(t, running())
+
+	handler.Start(context.Background(), time.Minute)
+	assert.True(t, running())
+	handler.Stop()
+	assert.False(t, running())
+}
+
+func TestRefreshToken(t *testing.T) {
+	var grants []string
+	refreshFails := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		grants = append(grants, req["grant_type"])
+		if req["grant_type"] == "refresh_token" {
+			assert.Equal(t, "", req["client_secret"])
+			if refreshFails {
+				w.WriteHeader(http.StatusForbidden)
+				fmt.Fprint(w, `{"error": "invalid_grant"}`)
+				return
+			}
+			fmt.Fprintf(w, `{"access_token": "renewed-%s", "expires_in": 3600}`, req["refresh_token"])
+			return
+		}
+		fmt.Fprint(w, `{"access_token": "issued", "refresh_token": "r", "expires_in": 3600}`)
+	}))
+	defer server.Close()
+
+	client := NewClient(context.Background(), &ClientOptions{})
+	creds := &ClientCredentials{
+		ClientID:             fmt.Sprintf("rai-sdk-go-%s", uuid.New().String()),
+		ClientSecret:         "secret",
+		ClientCredentialsUrl: server.URL,
+	}
+	handler := NewClientCredentialsHandler(client, creds)
+	token, err := handler.GetAccessToken()
+	assert.Nil(t, err)
+	assert.Equal(t, "issued", token)
+
+	// the token cache holds refresh tokens, so is only readable by its owner
+	fname, err := cachePath()
+	assert.Nil(t, err)
+	info, err := os.Stat(fname)
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	renewed, err := handler.refresh()
+	assert.Nil(t, err)
+	assert.Equal(t, "renewed-r", renewed.Token)
+	assert.Equal(t, "r", renewed.RefreshToken) // kept when not reissued
+
+	refreshFails = true
+	var debug strings.Builder
+	client.SetDebug(&debug)
+	renewed, err = handler.refresh()
+	assert.Nil(t, err)
+	assert.Equal(t, "issued", renewed.Token)
+	assert.Contains(t, debug.String(), "token refresh failed")
+	assert.Equal(t, []string{
+		"client_credentials", "refresh_token", "refresh_token", "client_credentials"}, grants)
+}
+
+func TestConcurrentTokenFetch(t *testing.T) {
+	var fetches int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		time.Sleep(20 * time.Millisecond)
+		fmt.Fprint(w, `{"access_token": "issued", "expires_in": 3600}`)
+	}))
+	defer server.Close()
+
+	client := NewClient(context.Background(), &ClientOptions{})
+	creds := &ClientCredentials{
+		ClientID:             fmt.Sprintf("rai-sdk-go-%s", uuid.New().String()),
+		ClientSecret:         "secret",
+		ClientCredentialsUrl: server.URL,
+	}
+	handler := NewClientCredentialsHandler(client, creds)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			token, err := handler.GetAccessToken()
+			assert.Nil(t, err)
+			assert.Equal(t, "issued", token)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&fetches))
+}
+
+func TestDeviceCodeHandler(t *testing.T) {
+	var polls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Nil(t, r.ParseForm())
+		if r.URL.Path == "/device" {
+			fmt.Fprint(w, `{"device_code": "dc", "user_code": "ABCD", "verification_uri": "https://verify", "interval": 1}`)
+			return
+		}
+		assert.Equal(t, "dc", r.Form.Get("device_code"))
+		if atomic.AddInt32(&polls, 1) < 3 {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"error": "authorization_pending"}`)
+			return
+		}
+		fmt.Fprint(w, `{"access_token": "token", "expires_in": 3600}`)
+	}))
+	defer server.Close()
+
+	var prompt strings.Builder
+	client := NewClient(context.Background(), &ClientOptions{})
+	handler := NewDeviceCodeHandler(client, &DeviceCodeConfig{
+		ClientID:               fmt.Sprintf("rai-sdk-go-%s", uuid.New().String()),
+		DeviceAuthorizationUrl: server.URL + "/device",
+		TokenUrl:               server.URL + "/token",
+		Prompt:                 &prompt})
+	handler.unit = time.Millisecond
+
+	token, err := handler.GetAccessToken()
+	assert.Nil(t, err)
+	assert.Equal(t, "token", token)
+	assert.Equal(t, int32(3), polls)
+	assert.Contains(t, prompt.String(), "https://verify")
+	assert.Contains(t, prompt.String(), "ABCD")
+
+	token, err = handler.GetAccessToken() // cached
+	assert.Nil(t, err)
+	assert.Equal(t, "token", token)
+	assert.Equal(t, int32(3), polls)
+}
+
+func TestNotFoundErrors(t *testing.T) {
+	newResponse := func(status int, body string) *http.Response {
+		return &http.Response{
+			StatusCode: status,
+			Header:     http.Header{},
+			Body:       io.NopCloser(strings.NewReader(body))}
+	}
+
+	err := httpError(newResponse(404, `{"message": "engine 'foo' not found"}`))
+	assert.True(t, errors.Is(err, ErrNotFound))
+	assert.True(t, errors.Is(err, ErrEngineNotFound))
+	assert.False(t, errors.Is(err, ErrDatabaseNotFound))
+
+	err = httpError(newResponse(404, "database 'foo' not found"))
+	assert.True(t, errors.Is(err, ErrNotFound))
+	assert.True(t, errors.Is(err, ErrDatabaseNotFound))
+	assert.False(t, errors.Is(err, ErrEngineNotFound))
+
+	err = httpError(newResponse(404, "not found"))
+	assert.True(t, errors.Is(err, ErrNotFound))
+	assert.False(t, errors.Is(err, ErrEngineNotFound))
+	assert.False(t, errors.Is(err, ErrDatabaseNotFound))
+
+	err = httpError(newResponse(400, "bad engine"))
+	assert.False(t, errors.Is(err, ErrNotFound))
+	assert.False(t, errors.Is(err, ErrEngineNotFound))
+}
+
 // Test database management APIs.
 func TestDatabase(t *testing.T) {
 	client := test.client
@@ -306,6 +654,164 @@ func TestEngine(t *testing.T) {
 
 }
 
+// Test that engine operations observe context cancellation.
+func TestEngineContextCancel(t *testing.T) {
+	client := test.client
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	engine, err := client.CreateEngineContext(ctx, test.engineName, test.engineSize)
+	assert.Nil(t, engine)
+	assert.Equal(t, context.Canceled, err)
+
+	err = client.DeleteEngineContext(ctx, test.engineName)
+	assert.Equal(t, context.Canceled, err)
+
+	// the test engine is left untouched
+	engine, err = client.GetEngine(test.engineName)
+	assert.Nil(t, err)
+	assert.NotNil(t, engine)
+}
+
+func TestWaitForEngineState(t *testing.T) {
+	var states []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		state := states[0]
+		if len(states) > 1 {
+			states = states[1:]
+		}
+		fmt.Fprintf(w, `{"computes": [{"name": "e", "state": "%s"}]}`, state)
+	}))
+	defer server.Close()
+	client := newServerClient(t, server)
+	opts := &EngineWaitOptions{Interval: time.Millisecond}
+
+	states = []string{"SUSPENDING", "SUSPENDING", "SUSPENDED"}
+	engine, err := client.WaitForEngineState("e", "SUSPENDED", opts)
+	assert.Nil(t, err)
+	assert.Equal(t, "SUSPENDED", engine.State)
+
+	states = []string{"RESUMING", "PROVISION_FAILED"}
+	engine, err = client.WaitForEngineState("e", "PROVISIONED", opts)
+	assert.True(t, errors.Is(err, ErrEngineFailed))
+	assert.Equal(t, "PROVISION_FAILED", engine.State)
+
+	states = []string{"RESUMING"}
+	opts.Timeout = 20 * time.Millisecond
+	engine, err = client.WaitForEngineState("e", "PROVISIONED", opts)
+	assert.Nil(t, engine)
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
+
+func TestEngineVersion(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/compute":
+			fmt.Fprint(w, `{"computes": [`+
+				`{"name": "a", "version": "2023.1.1"}, `+
+				`{"name": "b", "version": "2023.2.0"}, `+
+				`{"name": "c", "version": "2023.1.1"}]}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	client := newServerClient(t, server)
+
+	engines, err := client.ListEngines()
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(engines))
+	assert.Equal(t, "2023.2.0", engines[1].Version)
+
+	engines, err = client.ListEnginesWithVersion("2023.1.1")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(engines))
+	assert.Equal(t, "a", engines[0].Name)
+	assert.Equal(t, "c", engines[1].Name)
+
+	engines, err = client.ListEnginesWithVersion("2022.12.0")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(engines))
+}
+
+func TestCreateEngineFailed(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"compute": {"name": "e", "state": "PROVISION_FAILED", "state_reason": "quota exceeded"}}`)
+	}))
+	defer server.Close()
+	client := newServerClient(t, server)
+
+	engine, err := client.CreateEngine("e", "XS")
+	assert.True(t, errors.Is(err, ErrEngineProvisionFailed))
+	assert.True(t, errors.Is(err, ErrEngineFailed))
+	assert.Equal(t, "quota exceeded", engine.StateReason)
+	assert.Equal(t, "engine 'e' is in state PROVISION_FAILED: quota exceeded", err.Error())
+}
+
+func TestWaitForEngine(t *testing.T) {
+	var states []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		state := states[0]
+		if len(states) > 1 {
+			states = states[1:]
+		}
+		if r.Method == http.MethodPut {
+			fmt.Fprintf(w, `{"compute": {"name": "e", "state": "%s"}}`, state)
+			return
+		}
+		fmt.Fprintf(w, `{"computes": [{"name": "e", "state": "%s"}]}`, state)
+	}))
+	defer server.Close()
+	client := newServerClient(t, server)
+	opts := &EngineWaitOptions{Interval: time.Millisecond}
+
+	states = []string{"REQUESTED", "PROVISIONING", "PROVISIONED"}
+	engine, err := client.CreateEngineAsync("e", "XS")
+	assert.Nil(t, err)
+	assert.Equal(t, "REQUESTED", engine.State)
+	engine, err = client.WaitForEngine("e", opts)
+	assert.Nil(t, err)
+	assert.Equal(t, "PROVISIONED", engine.State)
+
+	states = []string{"PROVISIONING", "PROVISION_FAILED"}
+	engine, err = client.WaitForEngine("e", opts)
+	assert.True(t, errors.Is(err, ErrEngineProvisionFailed))
+	assert.Equal(t, "PROVISION_FAILED", engine.State)
+
+	states = []string{"PROVISIONING"}
+	opts.Timeout = 20 * time.Millisecond
+	engine, err = client.WaitForEngine("e", opts)
+	assert.Nil(t, engine)
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
+
+func TestSuspendResumeEngine(t *testing.T) {
+	var suspended []bool
+	state := "PROVISIONED"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPatch {
+			var req SuspendEngineRequest
+			_ = json.NewDecoder(r.Body).Decode(&req)
+			suspended = append(suspended, req.Suspend)
+			state = map[bool]string{true: "SUSPENDED", false: "PROVISIONED"}[req.Suspend]
+			fmt.Fprint(w, `{}`)
+			return
+		}
+		fmt.Fprintf(w, `{"computes": [{"name": "e", "state": "%s"}]}`, state)
+	}))
+	defer server.Close()
+	client := newServerClient(t, server)
+	opts := EngineWaitOptions{Interval: time.Millisecond}
+
+	err := client.SuspendEngine("e", opts)
+	assert.Nil(t, err)
+	engine, err := client.ResumeEngine("e", opts)
+	assert.Nil(t, err)
+	assert.Equal(t, "PROVISIONED", engine.State)
+	assert.Equal(t, []bool{true, false}, suspended)
+}
+
 // Test transaction execution.
 func TestExecuteV1(t *testing.T) {
 	client := test.client
@@ -331,6 +837,61 @@ func TestExecuteV1(t *testing.T) {
 	assert.Equal(t, expected, columns)
 }
 
+func TestExecuteV1WithOptions(t *testing.T) {
+	client := test.client
+
+	query := "def output = 1\ndef other = 2"
+	opts := NewExecuteOptions().WithOutputs("other")
+
+	rsp, err := client.ExecuteV1WithOptions(test.databaseName, test.engineName, query, nil, true, opts)
+	assert.Nil(t, err)
+	assert.Equal(t, false, rsp.Aborted)
+	assert.Equal(t, 1, len(rsp.Output))
+	if len(rsp.Output) == 1 {
+		assert.Equal(t, "other", rsp.Output[0].RelKey.Name)
+	}
+}
+
+func TestQueryActionOptions(t *testing.T) {
+	action, err := makeQueryAction("def output = 1", nil, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{}, action["persist"])
+	assert.Equal(t, []string{}, action["outputs"])
+
+	opts := NewExecuteOptions().WithPersist("a", "b").WithOutputs("output")
+	action, err = makeQueryAction("def output = 1", nil, opts)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a", "b"}, action["persist"])
+	assert.Equal(t, []string{"output"}, action["outputs"])
+
+	opts = NewExecuteOptions().WithPersist("a b")
+	_, err = makeQueryAction("def output = 1", nil, opts)
+	assert.True(t, errors.Is(err, ErrInvalidRelationName))
+}
+
+func TestQueryActionInputs(t *testing.T) {
+	opts := NewExecuteOptions().WithInput("n", 42).WithInput("x", 1.5).WithInput("b", true)
+	inputs, err := makeQueryActionInputs(map[string]string{"s": "abc"}, opts)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, len(inputs))
+	keys := []string{}
+	for _, input := range inputs {
+		key := input["rel_key"].(map[string]interface{})
+		keys = append(keys, key["name"].(string)+":"+key["keys"].([]string)[0])
+	}
+	assert.Equal(t, []string{
+		"b:Bool", "n:Int64", "s:RAI_VariableSizeStrings.VariableSizeString", "x:Float64"}, keys)
+	assert.Equal(t, [][]any{{42}}, inputs[1]["columns"])
+
+	// the async path reports bad inputs instead of dropping them
+	opts = NewExecuteOptions().WithInput("t", time.Now())
+	_, err = makeQueryActionInputs(nil, opts)
+	assert.NotNil(t, err)
+	client := NewClient(context.Background(), &ClientOptions{})
+	_, err = client.ExecuteAsyncWithOptions("db", "engine", "def output = t", nil, true, opts)
+	assert.NotNil(t, err)
+}
+
 func TestListTransactions(t *testing.T) {
 	client := test.client
 
@@ -532,6 +1093,186 @@ func TestLoadCSVNoHeader(t *testing.T) {
 	}
 }
 
+func TestRelLiteral(t *testing.T) {
+	tests := []struct {
+		value    any
+		expected string
+	}{
+		{"abc", `"abc"`},
+		{`say "hi"`, `"say \"hi\""`},
+		{`C:\temp`, `"C:\\temp"`},
+		{"100%", `"100\%"`},
+		{"a\nb\tc\x00", `"a\nb\tc\u0000"`},
+		{"héllo", `"héllo"`},
+		{'a', `'a'`},
+		{'\'', `'\''`},
+		{'\\', `'\\'`},
+		{true, "boolean_true"},
+		{false, "boolean_false"},
+		{42, "42"},
+		{int64(-42), "-42"},
+		{int8(-8), "int[8, -8]"},
+		{uint8(8), "uint[8, 8]"},
+		{uint64(64), "uint[64, 64]"},
+		{big.NewInt(128), "int[128, 128]"},
+		{new(big.Int).Neg(new(big.Int).Lsh(big.NewInt(1), 127)), "int[128, -170141183460469231731687303715884105728]"},
+		{int32(42), "'*'"},
+		{1.5, "1.5"},
+		{2.0, "2.0"},
+		{1e100, "1e+100"},
+		{float32(0.5), "float[32, 0.5]"},
+		{time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC), "2022-01-02T03:04:05Z"},
+		{time.Date(2022, 1, 2, 3, 4, 5, 6e6, time.UTC), "2022-01-02T03:04:05.006Z"},
+		{time.Date(2021, 10, 12, 1, 22, 31, 0, time.FixedZone("", 10*60*60)), "2021-10-12T01:22:31+10:00"},
+		{time.Date(2022, 1, 2, 3, 4, 5, 6e6+7, time.FixedZone("", -5*60*60)), "2022-01-02T03:04:05.006-05:00"},
+		{DateOf(time.Date(2022, 1, 2, 23, 4, 5, 0, time.FixedZone("", 10*60*60))), "2022-01-02"},
+		{decimal.RequireFromString("3.14"), `parse_decimal[64, 2, "3.14"]`},
+		{decimal.RequireFromString("-7"), `parse_decimal[64, 0, "-7"]`},
+	}
+	for _, test := range tests {
+		lit, err := RelLiteral(test.value)
+		assert.Nil(t, err)
+		assert.Equal(t, test.expected, lit)
+	}
+
+	_, err := RelLiteral(math.NaN())
+	assert.NotNil(t, err)
+	_, err = RelLiteral([]int{1})
+	assert.NotNil(t, err)
+	_, err = RelLiteral((*big.Int)(nil))
+	assert.NotNil(t, err)
+	_, err = RelLiteral(new(big.Int).Lsh(big.NewInt(1), 127))
+	assert.NotNil(t, err)
+}
+
+func TestInvalidRelationName(t *testing.T) {
+	client := NewClient(context.Background(), &ClientOptions{})
+	for _, name := range []string{"foo/bar", "foo bar", "1foo", "", "foo]: 1\ndef bar[:x"} {
+		_, err := client.LoadCSV("db", "e", name, strings.NewReader("a\n1\n"), nil)
+		assert.True(t, errors.Is(err, ErrInvalidRelationName), name)
+		_, err = client.LoadCSVBatched("db", "e", name, strings.NewReader("a\n1\n"), nil, 1, nil)
+		assert.True(t, errors.Is(err, ErrInvalidRelationName), name)
+		_, err = client.LoadJSON("db", "e", name, strings.NewReader("{}"))
+		assert.True(t, errors.Is(err, ErrInvalidRelationName), name)
+	}
+	assert.Nil(t, checkRelationName("my_data2"))
+}
+
+func TestQueryBuilder(t *testing.T) {
+	source, err := NewQuery("people").Where("age", ">", 21).Select("name", "age").Build()
+	assert.Nil(t, err)
+	assert.Equal(t,
+		"def _query_rows(row) = people(:age, row, w1) and w1 > 21\n"+
+			"def output(x1, x2) = _query_rows(row) and people(:name, row, x1) and people(:age, row, x2)",
+		source)
+
+	source, err = NewQuery("people").
+		Where("name", "==", `a"b`).Where("age", "<=", 30).Limit(10).Build()
+	assert.Nil(t, err)
+	assert.Equal(t,
+		"def _query_rows(row) = people(:name, row, w1) and w1 = \"a\\\"b\" and people(:age, row, w2) and w2 <= 30\n"+
+			"def _query_limit(row) = top[10, _query_rows](_, row)\n"+
+			"def output(col, row, v) = _query_limit(row) and people(col, row, v)",
+		source)
+
+	source, err = NewQuery("people").Build()
+	assert.Nil(t, err)
+	assert.Equal(t,
+		"def _query_rows(row) = people(_, row, _)\n"+
+			"def output(col, row, v) = _query_rows(row) and people(col, row, v)",
+		source)
+
+	_, err = NewQuery("people").Where("age", "~", 1).Build()
+	assert.NotNil(t, err)
+	_, err = NewQuery("people").Select("first name").Build()
+	assert.True(t, errors.Is(err, ErrInvalidRelationName))
+	_, err = NewQuery("people]").Build()
+	assert.True(t, errors.Is(err, ErrInvalidRelationName))
+	_, err = NewQuery("people").Where("age", ">", math.Inf(1)).Build()
+	assert.NotNil(t, err)
+}
+
+func TestGenLoadCSVMode(t *testing.T) {
+	source := genLoadCSV("rel", nil)
+	assert.Equal(t, "def config[:data]: data\ndef insert[:rel]: load_csv[config]", source)
+
+	opts := NewCSVOptions().WithMode(CSVModeReplace)
+	source = genLoadCSV("rel", opts)
+	assert.Equal(t, "def config[:data]: data\n"+
+		"def delete[:rel]: rel\n"+
+		"def insert[:rel]: load_csv[config]", source)
+}
+
+func TestReadCSVRecord(t *testing.T) {
+	r := bufio.NewReader(strings.NewReader("a,\"b\nc\",d\ne,\"f\\\"\ng\"\nh"))
+	var records []string
+	for {
+		rec, err := readCSVRecord(r, '"', '\\')
+		if err == io.EOF {
+			break
+		}
+		assert.Nil(t, err)
+		records = append(records, rec)
+	}
+	assert.Equal(t, []string{"a,\"b\nc\",d\n", "e,\"f\\\"\ng\"\n", "h"}, records)
+}
+
+func TestLoadCSVBatched(t *testing.T) {
+	var batches, sources []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var tx struct {
+			Actions []struct {
+				Action struct {
+					Source struct {
+						Value string `json:"value"`
+					} `json:"source"`
+					Inputs []struct {
+						Columns [][]string `json:"columns"`
+					} `json:"inputs"`
+				} `json:"action"`
+			} `json:"actions"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&tx)
+		batches = append(batches, tx.Actions[0].Action.Inputs[0].Columns[0][0])
+		sources = append(sources, tx.Actions[0].Action.Source.Value)
+		fmt.Fprint(w, `{"aborted": false}`)
+	}))
+	defer server.Close()
+	client := newServerClient(t, server)
+
+	var progress []int
+	data := "a,b\n1,2\n3,4\n5,6\n"
+	n, err := client.LoadCSVBatched(
+		"db", "engine", "rel", strings.NewReader(data), nil, 2,
+		func(n int) { progress = append(progress, n) })
+	assert.Nil(t, err)
+	assert.Equal(t, 3, n)
+	assert.Equal(t, []int{2, 3}, progress)
+	assert.Equal(t, []string{"a,b\n1,2\n3,4\n", "a,b\n5,6\n"}, batches)
+
+	// rows of the second batch follow those of the first, which is 12 bytes
+	assert.Equal(t, genLoadCSV("rel", nil), sources[0])
+	assert.Equal(t, "def config[:data]: data\n"+
+		"def insert[:rel](col, pos, v): exists((p) | load_csv[config](col, p, v) and pos = p + 12)",
+		sources[1])
+
+	batches, sources = nil, nil
+	opts := NewCSVOptions().WithMode(CSVModeReplace)
+	_, err = client.LoadCSVBatched("db", "engine", "rel", strings.NewReader(data), opts, 2, nil)
+	assert.Nil(t, err)
+	assert.Contains(t, sources[0], "def delete[:rel]: rel\n")
+	assert.NotContains(t, sources[1], "def delete")
+	assert.Contains(t, sources[1], "pos = p + 12)")
+
+	batches = nil
+	opts = NewCSVOptions().WithHeaderRow(0)
+	n, err = client.LoadCSVBatched(
+		"db", "engine", "rel", strings.NewReader(data), opts, 3, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, n)
+	assert.Equal(t, []string{"a,b\n1,2\n3,4\n", "5,6\n"}, batches)
+}
+
 // Test loading CSV data with alternate syntax options.
 func TestLoadCSVAltSyntax(t *testing.T) {
 	client := test.client
@@ -788,6 +1529,86 @@ func TestModels(t *testing.T) {
 	assert.Nil(t, model)
 }
 
+func TestLoadModelsOrdered(t *testing.T) {
+	client := test.client
+
+	models := []NamedModel{
+		{"test_model_a", strings.NewReader("def A = 1")},
+		{"test_model_b", strings.NewReader("def B = A + 1")}}
+	rsp, err := client.LoadModelsOrdered(test.databaseName, test.engineName, models)
+	assert.Nil(t, err)
+	assert.NotNil(t, rsp)
+	if rsp != nil {
+		assert.Equal(t, false, rsp.Aborted)
+		assert.Equal(t, 0, len(rsp.Problems))
+	}
+
+	modelNames, err := client.ListModelNames(test.databaseName, test.engineName)
+	assert.Nil(t, err)
+	assert.True(t, contains(modelNames, "test_model_a"))
+	assert.True(t, contains(modelNames, "test_model_b"))
+
+	_, err = client.DeleteModels(
+		test.databaseName, test.engineName, []string{"test_model_a", "test_model_b"})
+	assert.Nil(t, err)
+}
+
+func TestModelHash(t *testing.T) {
+	var models []Model
+	err := json.Unmarshal([]byte(`[{"name": "a", "value": "def a = 1"}, {"name": "b", "value": ""}]`), &models)
+	assert.Nil(t, err)
+	assert.Equal(t, "a", models[0].Name)
+	assert.Equal(t, ModelHash("def a = 1"), models[0].Hash)
+	assert.Equal(t, 9, models[0].Size)
+	assert.NotEqual(t, ModelHash("def a = 2"), models[0].Hash)
+	assert.Equal(t, "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855", models[1].Hash)
+	assert.Equal(t, 0, models[1].Size)
+}
+
+func TestSortModels(t *testing.T) {
+	names := func(models []NamedModel) []string {
+		result := []string{}
+		for _, m := range models {
+			result = append(result, m.Name)
+		}
+		return result
+	}
+	models := []NamedModel{{"a", nil}, {"b", nil}, {"c", nil}}
+
+	sorted, err := SortModels(models, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a", "b", "c"}, names(sorted))
+
+	sorted, err = SortModels(models, map[string][]string{"a": {"c", "lib"}, "c": {"b"}})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"b", "c", "a"}, names(sorted))
+
+	_, err = SortModels(models, map[string][]string{"a": {"c"}, "c": {"a"}})
+	assert.NotNil(t, err)
+}
+
+func TestDeleteModelsWithResult(t *testing.T) {
+	client := test.client
+
+	r := strings.NewReader("def R = 1")
+	_, err := client.LoadModel(test.databaseName, test.engineName, "test_model", r)
+	assert.Nil(t, err)
+
+	models := []string{"test_model", "test_model_missing"}
+	rsp, err := client.DeleteModelsWithResult(test.databaseName, test.engineName, models)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"test_model"}, rsp.Deleted)
+	assert.Equal(t, []string{"test_model_missing"}, rsp.NotFound)
+	assert.NotNil(t, rsp.Result)
+
+	// repeating the delete is harmless
+	rsp, err = client.DeleteModelsWithResult(test.databaseName, test.engineName, models)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{}, rsp.Deleted)
+	assert.Equal(t, models, rsp.NotFound)
+	assert.Nil(t, rsp.Result)
+}
+
 // Test OAuth Client APIs.
 func TestOAuthClient(t *testing.T) {
 	client := test.client
@@ -1039,6 +1860,1068 @@ func TestTransactionAbort(t *testing.T) {
 	assert.Equal(t, "integrity constraint violation", rsp.Transaction.AbortReason)
 }
 
+func TestFailOnError(t *testing.T) {
+	query := `def output = undefined_relation`
+
+	rsp, err := test.client.Execute(test.databaseName, test.engineName, query, nil, true, o11yTag)
+	assert.Nil(t, err)
+	assert.NotNil(t, rsp)
+
+	opts := NewExecuteOptions().WithFailOnError(true)
+	rsp, err = test.client.ExecuteWithOptions(
+		test.databaseName, test.engineName, query, nil, true, opts, o11yTag)
+	assert.Nil(t, rsp)
+	var perr TransactionProblemsError
+	assert.True(t, errors.As(err, &perr))
+	assert.NotEmpty(t, perr.TransactionID)
+	assert.NotEmpty(t, perr.Problems)
+}
+
+// Returns a client that sends requests to the given test server.
+func newServerClient(t *testing.T, server *httptest.Server) *Client {
+	u, err := url.Parse(server.URL)
+	assert.Nil(t, err)
+	opts := &ClientOptions{}
+	opts.Scheme, opts.Host, opts.Port = u.Scheme, u.Hostname(), u.Port()
+	return NewClient(context.Background(), opts)
+}
+
+func TestTransactionStuck(t *testing.T) {
+	var polls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprint(w, `{"id": "tx", "state": "CREATED"}`)
+			return
+		}
+		atomic.AddInt32(&polls, 1)
+		fmt.Fprint(w, `{"transaction": {"id": "tx", "state": "RUNNING"}}`)
+	}))
+	defer server.Close()
+
+	client := newServerClient(t, server)
+	xopts := NewExecuteOptions().WithStuckTimeout(time.Second)
+	rsp, err := client.ExecuteWithOptions("db", "engine", "def output = 1", nil, true, xopts)
+	assert.Nil(t, rsp)
+	assert.True(t, errors.Is(err, ErrTransactionStuck))
+	var serr TransactionStuckError
+	assert.True(t, errors.As(err, &serr))
+	assert.Equal(t, "tx", serr.TransactionID)
+	assert.Equal(t, Running, serr.State)
+	assert.True(t, serr.Duration > time.Second)
+	assert.True(t, atomic.LoadInt32(&polls) > 1)
+}
+
+func TestWaitForTransaction(t *testing.T) {
+	var polls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/transactions/tx":
+			state := "RUNNING"
+			if atomic.AddInt32(&polls, 1) > 1 {
+				state = "COMPLETED"
+			}
+			fmt.Fprintf(w, `{"transaction": {"id": "tx", "state": "%s"}}`, state)
+		case "/transactions/tx/problems":
+			fmt.Fprint(w, `[{"message": "warning"}]`)
+		case "/transactions/tx/metadata":
+			w.Header().Set("Content-Type", "application/x-protobuf")
+		case "/transactions/tx/results":
+			mw := multipart.NewWriter(w)
+			w.Header().Set("Content-Type", mw.FormDataContentType())
+			mw.Close()
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	client := newServerClient(t, server)
+
+	rsp, err := client.WaitForTransaction("tx")
+	assert.Nil(t, err)
+	assert.Equal(t, Completed, rsp.Transaction.State)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&polls))
+	assert.NotNil(t, rsp.Metadata)
+	assert.NotNil(t, rsp.Partitions)
+	assert.Equal(t, "warning", rsp.Problems[0].Message)
+}
+
+func TestExecuteContext(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/transactions":
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprint(w, `{"id": "tx", "state": "RUNNING"}`)
+		case "/transactions/tx":
+			fmt.Fprint(w, `{"transaction": {"id": "tx", "state": "RUNNING"}}`)
+		case "/database":
+			fmt.Fprint(w, `{"database": {"name": "db"}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	client := newServerClient(t, server)
+
+	// the transaction never completes, so only its context ends the wait
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	rsp, err := client.ExecuteContext(ctx, "db", "engine", "def output = 1", nil, true)
+	assert.Nil(t, rsp)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+
+	// other requests made with the client are not affected
+	db, err := client.CreateDatabase("db")
+	assert.Nil(t, err)
+	assert.Equal(t, "db", db.Name)
+	tx, err := client.GetTransaction("tx")
+	assert.Nil(t, err)
+	assert.Equal(t, Running, tx.Transaction.State)
+}
+
+func TestExecuteCached(t *testing.T) {
+	var posts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var tx TransactionRequest
+		_ = json.NewDecoder(r.Body).Decode(&tx)
+		assert.True(t, tx.ReadOnly)
+		state := "COMPLETED"
+		if strings.Contains(tx.Query, "abort") {
+			state = "ABORTED"
+		}
+		atomic.AddInt32(&posts, 1)
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"id": "tx", "state": "%s"}`, state)
+	}))
+	defer server.Close()
+	client := newServerClient(t, server)
+
+	execute := func(database, source string, ttl time.Duration) int32 {
+		_, err := client.ExecuteCached(database, "engine", source, ttl)
+		assert.Nil(t, err)
+		return atomic.LoadInt32(&posts)
+	}
+	assert.Equal(t, int32(1), execute("db", "def output = 1", time.Minute))
+	assert.Equal(t, int32(1), execute("db", "def output = 1", time.Minute))
+	assert.Equal(t, int32(2), execute("db", "def output = 2", time.Minute))
+	assert.Equal(t, int32(3), execute("db2", "def output = 1", time.Minute))
+
+	// expired entries are executed again
+	assert.Equal(t, int32(4), execute("db", "def output = 3", time.Millisecond))
+	time.Sleep(5 * time.Millisecond)
+	assert.Equal(t, int32(5), execute("db", "def output = 3", time.Millisecond))
+
+	// aborted transactions are not cached
+	assert.Equal(t, int32(6), execute("db", "def output = abort", time.Minute))
+	assert.Equal(t, int32(7), execute("db", "def output = abort", time.Minute))
+
+	// a cache shared with a client of another region is not hit
+	other := NewClient(context.Background(), &ClientOptions{ResultCache: client.resultCache})
+	other.Scheme, other.Host, other.Port = client.Scheme, client.Host, client.Port
+	other.Region = "eu-west"
+	_, err := other.ExecuteCached("db", "engine", "def output = 1", time.Minute)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(8), atomic.LoadInt32(&posts))
+
+	// a client created without NewClient caches in memory
+	literal := &Client{Scheme: client.Scheme, Host: client.Host, Port: client.Port}
+	literal.SetAccessTokenHandler(NewNopAccessTokenHandler())
+	literal.HttpClient = server.Client()
+	for i := 0; i < 2; i++ {
+		_, err = literal.ExecuteCached("db", "engine", "def output = 4", time.Minute)
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, int32(9), atomic.LoadInt32(&posts))
+}
+
+// Test that cached responses can be read concurrently, run with -race.
+func TestExecuteCachedConcurrent(t *testing.T) {
+	const source = "def output = 1"
+	cache := NewMemoryResultCache()
+	client := NewClient(context.Background(), &ClientOptions{ResultCache: cache})
+	cache.Set(resultCacheKey(client.Host, client.Region, "db", source), newPartitionedResponse(20, 10), time.Minute)
+
+	var wg sync.WaitGroup
+	results := make([][][]any, 2)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			rsp, err := client.ExecuteCached("db", "engine", source, time.Minute)
+			assert.Nil(t, err)
+			if i == 0 {
+				results[i] = rowsOf(rsp.Relations().Union())
+				return
+			}
+			rsp.Rows()(func(row []any) bool {
+				results[i] = append(results[i], row)
+				return true
+			})
+		}(i)
+	}
+	wg.Wait()
+	assert.Equal(t, 200, len(results[0]))
+	assert.Equal(t, results[0], results[1])
+}
+
+func TestRequestTooLarge(t *testing.T) {
+	var posts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&posts, 1)
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		fmt.Fprint(w, `{"message": "payload too large"}`)
+	}))
+	defer server.Close()
+	client := newServerClient(t, server)
+
+	_, err := client.ExecuteAsync("db", "engine", "def output = 1", nil, true)
+	assert.True(t, errors.Is(err, ErrRequestTooLarge))
+	assert.True(t, errors.Is(err, newHTTPError(http.StatusRequestEntityTooLarge, nil, "")))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&posts))
+
+	// oversized requests fail without being sent
+	u, _ := url.Parse(server.URL)
+	opts := &ClientOptions{MaxRequestBytes: 1024}
+	opts.Scheme, opts.Host, opts.Port = u.Scheme, u.Hostname(), u.Port()
+	client = NewClient(context.Background(), opts)
+	_, err = client.ExecuteAsync("db", "engine", strings.Repeat("x", 1024), nil, true)
+	assert.True(t, errors.Is(err, ErrRequestTooLarge))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&posts))
+
+	_, err = client.ExecuteAsync("db", "engine", "def output = 1", nil, true)
+	assert.True(t, errors.Is(err, ErrRequestTooLarge))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&posts))
+}
+
+func TestTransactionRegion(t *testing.T) {
+	var tx map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tx = nil
+		_ = json.NewDecoder(r.Body).Decode(&tx)
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{"id": "tx", "state": "COMPLETED"}`)
+	}))
+	defer server.Close()
+	client := newServerClient(t, server)
+
+	// the region is not sent unless it is set explicitly
+	_, err := client.ExecuteAsync("db", "engine", "def output = 1", nil, true)
+	assert.Nil(t, err)
+	assert.NotContains(t, tx, "region")
+
+	opts := NewExecuteOptions().WithRegion("eu-west")
+	_, err = client.ExecuteAsyncWithOptions("db", "engine", "def output = 1", nil, true, opts)
+	assert.Nil(t, err)
+	assert.Equal(t, "eu-west", tx["region"])
+
+	u, err := url.Parse(server.URL)
+	assert.Nil(t, err)
+	copts := &ClientOptions{}
+	copts.Scheme, copts.Host, copts.Port = u.Scheme, u.Hostname(), u.Port()
+	copts.Region = DefaultRegion
+	client = NewClient(context.Background(), copts)
+	_, err = client.ExecuteAsync("db", "engine", "def output = 1", nil, true)
+	assert.Nil(t, err)
+	assert.Equal(t, DefaultRegion, tx["region"])
+}
+
+func TestTransactionPersist(t *testing.T) {
+	var tx TransactionRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tx = TransactionRequest{}
+		_ = json.NewDecoder(r.Body).Decode(&tx)
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{"id": "tx", "state": "COMPLETED"}`)
+	}))
+	defer server.Close()
+	client := newServerClient(t, server)
+
+	_, err := client.ExecuteAsync("db", "engine", "def output = 1", nil, false)
+	assert.Nil(t, err)
+	assert.Nil(t, tx.Persist)
+
+	opts := NewExecuteOptions().WithPersist("totals")
+	_, err = client.ExecuteAsyncWithOptions("db", "engine", "def totals = 1", nil, false, opts)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"totals"}, tx.Persist)
+
+	_, err = client.ExecuteAsyncWithOptions("db", "engine", "def totals = 1", nil, true, opts)
+	assert.NotNil(t, err)
+
+	opts = NewExecuteOptions().WithPersist("total:s")
+	_, err = client.ExecuteAsyncWithOptions("db", "engine", "def totals = 1", nil, false, opts)
+	assert.True(t, errors.Is(err, ErrInvalidRelationName))
+}
+
+func TestExecuteWithInputs(t *testing.T) {
+	var tx TransactionRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tx = TransactionRequest{}
+		_ = json.NewDecoder(r.Body).Decode(&tx)
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{"id": "tx", "state": "COMPLETED"}`)
+	}))
+	defer server.Close()
+	client := newServerClient(t, server)
+
+	const source = "def output = load_csv[people_csv], load_csv[orders_csv], limit"
+	inputs := func() map[string]io.Reader {
+		return map[string]io.Reader{
+			"people_csv": strings.NewReader("id,name\n1,a\n"),
+			"orders_csv": strings.NewReader("id,total\n1,42\n")}
+	}
+	opts := NewExecuteOptions().WithInput("limit", 10)
+	_, err := client.ExecuteWithInputs("db", "engine", source, inputs(), true, opts)
+	assert.Nil(t, err)
+	values := map[string]any{}
+	for _, input := range tx.Inputs {
+		m := input.(map[string]any)
+		name := m["rel_key"].(map[string]any)["name"].(string)
+		values[name] = m["columns"].([]any)[0].([]any)[0]
+	}
+	assert.Equal(t, map[string]any{
+		"limit":      float64(10),
+		"orders_csv": "id,total\n1,42\n",
+		"people_csv": "id,name\n1,a\n"}, values)
+
+	opts = NewExecuteOptions().WithInput("people_csv", 1)
+	_, err = client.ExecuteWithInputs("db", "engine", source, inputs(), true, opts)
+	assert.NotNil(t, err)
+
+	_, err = client.ExecuteWithInputs(
+		"db", "engine", source, map[string]io.Reader{"a b": strings.NewReader("")}, true, nil)
+	assert.True(t, errors.Is(err, ErrInvalidRelationName))
+
+	client.maxRequestBytes = 12
+	_, err = client.ExecuteWithInputs("db", "engine", source, inputs(), true, nil)
+	assert.True(t, errors.Is(err, ErrRequestTooLarge))
+}
+
+func TestDebug(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"databases": []}`)
+	}))
+	defer server.Close()
+	client := newServerClient(t, server)
+	client.accessTokenHandler = NewStaticTokenHandler("secret-token", time.Time{})
+
+	var out strings.Builder
+	client.SetDebug(&out)
+	_, err := client.ListDatabases()
+	assert.Nil(t, err)
+	trace := out.String()
+	assert.Contains(t, trace, "> GET "+server.URL+"/database")
+	assert.Contains(t, trace, "> Authorization: <redacted>")
+	assert.NotContains(t, trace, "secret-token")
+	assert.Contains(t, trace, "< 200 OK")
+
+	out.Reset()
+	client.SetDebug(nil)
+	_, err = client.ListDatabases()
+	assert.Nil(t, err)
+	assert.Equal(t, "", out.String())
+}
+
+func TestCompressedResponses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Contains(t, r.Header.Get("Accept-Encoding"), "gzip")
+		var body bytes.Buffer
+		var zw io.WriteCloser
+		switch r.URL.Path {
+		case "/compute":
+			w.Header().Set("Content-Encoding", "deflate")
+			zw = zlib.NewWriter(&body)
+		default:
+			w.Header().Set("Content-Encoding", "gzip")
+			zw = gzip.NewWriter(&body)
+		}
+		switch r.URL.Path {
+		case "/database":
+			fmt.Fprint(zw, `{"databases": [{"name": "db"}]}`)
+		case "/compute":
+			fmt.Fprint(zw, `{"computes": [{"name": "engine"}]}`)
+		case "/transactions":
+			mw := multipart.NewWriter(zw)
+			part, _ := mw.CreateFormField("transaction")
+			fmt.Fprint(part, `{"id": "tx", "state": "COMPLETED"}`)
+			part, _ = mw.CreateFormField("problems")
+			fmt.Fprint(part, `[{"message": "warning"}]`)
+			mw.Close()
+			w.Header().Set("Content-Type", mw.FormDataContentType())
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(zw, `{"message": "bad request"}`)
+		}
+		zw.Close()
+		w.Write(body.Bytes())
+	}))
+	defer server.Close()
+	client := newServerClient(t, server)
+
+	databases, err := client.ListDatabases()
+	assert.Nil(t, err)
+	assert.Equal(t, "db", databases[0].Name)
+
+	engines, err := client.ListEngines()
+	assert.Nil(t, err)
+	assert.Equal(t, "engine", engines[0].Name)
+
+	rsp, err := client.ExecuteAsync("db", "engine", "def output = 1", nil, true)
+	assert.Nil(t, err)
+	assert.Equal(t, "tx", rsp.Transaction.ID)
+	assert.Equal(t, "warning", rsp.Problems[0].Message)
+
+	err = client.Get("/other", nil, nil, nil)
+	var herr HTTPError
+	assert.True(t, errors.As(err, &herr))
+	assert.Equal(t, `{"message": "bad request"}`, herr.Body)
+}
+
+func TestRequestContext(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		fmt.Fprint(w, `{"databases": [{"name": "db"}], "computes": [{"name": "engine"}]}`)
+	}))
+	defer server.Close()
+	client := newServerClient(t, server)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := client.ListDatabasesContext(ctx)
+	assert.True(t, errors.Is(err, context.Canceled))
+	_, err = client.GetEngineContext(ctx, "engine")
+	assert.True(t, errors.Is(err, context.Canceled))
+	assert.Equal(t, int32(0), atomic.LoadInt32(&requests))
+
+	// the client's own context is unaffected
+	databases, err := client.ListDatabases()
+	assert.Nil(t, err)
+	assert.Equal(t, "db", databases[0].Name)
+	engine, err := client.GetEngineContext(context.Background(), "engine")
+	assert.Nil(t, err)
+	assert.Equal(t, "engine", engine.Name)
+
+	// the exported request methods are bound to the given context too
+	n := atomic.LoadInt32(&requests)
+	assert.True(t, errors.Is(client.GetContext(ctx, "/path", nil, nil, nil), context.Canceled))
+	assert.True(t, errors.Is(client.PostContext(ctx, "/path", nil, nil, nil), context.Canceled))
+	assert.True(t, errors.Is(client.PutContext(ctx, "/path", nil, nil, nil), context.Canceled))
+	assert.True(t, errors.Is(client.PatchContext(ctx, "/path", nil, nil, nil), context.Canceled))
+	assert.True(t, errors.Is(client.DeleteContext(ctx, "/path", nil, nil, nil), context.Canceled))
+	assert.Equal(t, n, atomic.LoadInt32(&requests))
+	assert.Nil(t, client.GetContext(context.Background(), "/path", nil, nil, nil))
+	assert.Equal(t, n+1, atomic.LoadInt32(&requests))
+}
+
+func TestConditionalUpdate(t *testing.T) {
+	etag := `"v1"`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if m := r.Header.Get("If-Match"); m != "" && m != etag {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		if r.Method == http.MethodPatch {
+			etag = `"v2"`
+		}
+		w.Header().Set("ETag", etag)
+		fmt.Fprint(w, `{"user": {"id": "u1", "email": "a@b.c"}}`)
+	}))
+	defer server.Close()
+	client := newServerClient(t, server)
+
+	user, err := client.GetUser("u1")
+	assert.Nil(t, err)
+	assert.Equal(t, `"v1"`, user.ETag)
+
+	_, err = client.UpdateUserIfMatch("u1", UpdateUserRequest{Status: "INACTIVE"}, user.ETag)
+	assert.Nil(t, err)
+
+	// the user was modified since it was read
+	_, err = client.UpdateUserIfMatch("u1", UpdateUserRequest{Status: "ACTIVE"}, user.ETag)
+	assert.True(t, errors.Is(err, ErrConflict))
+
+	_, err = client.UpdateUser("u1", UpdateUserRequest{Status: "ACTIVE"})
+	assert.Nil(t, err)
+}
+
+func TestGetAccessToken(t *testing.T) {
+	var req map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req = nil
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		fmt.Fprint(w, `{"access_token": "token", "expires_in": 3600}`)
+	}))
+	defer server.Close()
+	client := newServerClient(t, server)
+
+	creds := &ClientCredentials{
+		ClientID: "id", ClientSecret: "secret", ClientCredentialsUrl: server.URL}
+	token, err := client.GetAccessToken(creds)
+	assert.Nil(t, err)
+	assert.Equal(t, "token", token.Token)
+	assert.Equal(t, map[string]string{
+		"client_id":     "id",
+		"client_secret": "secret",
+		"audience":      "https://" + client.Host,
+		"grant_type":    "client_credentials"}, req)
+
+	creds.Audience, creds.Scope = "https://api.example.com", "read:all"
+	_, err = client.GetAccessToken(creds)
+	assert.Nil(t, err)
+	assert.Equal(t, "https://api.example.com", req["audience"])
+	assert.Equal(t, "read:all", req["scope"])
+}
+
+func TestDescribeDatabase(t *testing.T) {
+	var transactions int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == PathDatabase {
+			fmt.Fprint(w, `{"databases": [{"name": "db", "state": "CREATED"}]}`)
+			return
+		}
+		transactions++
+		var req struct {
+			Actions []struct {
+				Action DbAction `json:"action"`
+			} `json:"actions"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		assert.Equal(t, 2, len(req.Actions))
+		fmt.Fprint(w, `{"actions": [
+			{"name": "action0", "result": {"sources": [{"name": "m", "value": "def x = 1"}]}},
+			{"name": "action1", "result": {"rels": [{"name": "x", "keys": [], "values": []}]}}]}`)
+	}))
+	defer server.Close()
+	client := newServerClient(t, server)
+
+	overview, err := client.DescribeDatabase("db", "e")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, transactions)
+	assert.Equal(t, "db", overview.Database.Name)
+	assert.Equal(t, []Model{{
+		Name: "m", Value: "def x = 1", Hash: ModelHash("def x = 1"), Size: 9}}, overview.Models)
+	assert.Equal(t, 1, len(overview.EDBs))
+	assert.Equal(t, "x", overview.EDBs[0].Name)
+}
+
+func TestLoadModelsAsync(t *testing.T) {
+	var tx TransactionRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&tx)
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{"id": "tx", "state": "RUNNING"}`)
+	}))
+	defer server.Close()
+	client := newServerClient(t, server)
+
+	rsp, err := client.LoadModelsAsync("db", "e", map[string]io.Reader{
+		"b":         strings.NewReader("def b = 2"),
+		"app/\"a\"": strings.NewReader("def a = 1"),
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "tx", rsp.Transaction.ID)
+	assert.False(t, tx.ReadOnly)
+	assert.Equal(t, strings.Join([]string{
+		`def delete:rel:catalog:model["app/\"a\""] = rel:catalog:model["app/\"a\""]`,
+		`def insert:rel:catalog:model["app/\"a\""] = _model_input_0`,
+		`def delete:rel:catalog:model["b"] = rel:catalog:model["b"]`,
+		`def insert:rel:catalog:model["b"] = _model_input_1`,
+		``}, "\n"), tx.Query)
+	assert.Equal(t, 2, len(tx.Inputs))
+	input := tx.Inputs[0].(map[string]any)
+	assert.Equal(t, []any{[]any{"def a = 1"}}, input["columns"])
+}
+
+func TestListModelNamesMatching(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"actions": [{"name": "action0", "result": {"sources": [
+			{"name": "app/foo/a"}, {"name": "app/foo/b"}, {"name": "app/foo/x/c"},
+			{"name": "app/bar/d"}, {"name": "stdlib"}]}}]}`)
+	}))
+	defer server.Close()
+	client := newServerClient(t, server)
+
+	names, err := client.ListModelNamesMatching("db", "e", "app/foo/*")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"app/foo/a", "app/foo/b"}, names)
+
+	names, err = client.ListModelNamesMatching("db", "e", "app/*/?")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"app/foo/a", "app/foo/b", "app/bar/d"}, names)
+
+	names, err = client.ListModelNamesMatching("db", "e", "other/*")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{}, names)
+
+	_, err = client.ListModelNamesMatching("db", "e", "app/[")
+	assert.True(t, errors.Is(err, path.ErrBadPattern))
+
+	ok, err := client.ModelExists("db", "e", "app/foo/x/c")
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	ok, err = client.ModelExists("db", "e", "app/foo")
+	assert.Nil(t, err)
+	assert.False(t, ok)
+}
+
+func TestDeleteDatabases(t *testing.T) {
+	var mu sync.Mutex
+	deleted := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req deleteDatabaseRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		switch req.Name {
+		case "missing":
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"message": "database not found"}`)
+		case "locked":
+			w.WriteHeader(http.StatusConflict)
+		default:
+			mu.Lock()
+			deleted = append(deleted, req.Name)
+			mu.Unlock()
+			fmt.Fprintf(w, `{"name": "%s", "message": "deleted successfully"}`, req.Name)
+		}
+	}))
+	defer server.Close()
+	client := newServerClient(t, server)
+
+	names := []string{"a", "missing", "locked", "b"}
+	for _, concurrency := range []int{1, 3} {
+		deleted = []string{}
+		results := client.DeleteDatabasesParallel(concurrency, names)
+		assert.Equal(t, 4, len(results))
+		assert.Nil(t, results["a"])
+		assert.Nil(t, results["b"])
+		assert.Nil(t, results["missing"])
+		assert.True(t, errors.Is(results["locked"], newHTTPError(http.StatusConflict, nil, "")))
+		assert.ElementsMatch(t, []string{"a", "b"}, deleted)
+	}
+	assert.Equal(t, 0, len(client.DeleteDatabases(nil)))
+}
+
+func TestClose(t *testing.T) {
+	started := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+	client := newServerClient(t, server)
+
+	done := make(chan error)
+	go func() {
+		_, err := client.GetEngine("e")
+		done <- err
+	}()
+	<-started
+	assert.Nil(t, client.Close())
+	assert.True(t, errors.Is(<-done, context.Canceled))
+
+	_, err := client.GetEngine("e")
+	assert.True(t, errors.Is(err, context.Canceled))
+}
+
+// Test that replacing the client's context leaves running requests alone.
+func TestSetContext(t *testing.T) {
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+		fmt.Fprint(w, `{"computes": [{"name": "e", "state": "PROVISIONED"}]}`)
+	}))
+	defer server.Close()
+	client := newServerClient(t, server)
+
+	done := make(chan error)
+	go func() {
+		_, err := client.GetEngine("e")
+		done <- err
+	}()
+	<-started
+	ctx, cancel := context.WithCancel(context.Background())
+	client.SetContext(ctx)
+	cancel()
+	close(release)
+	assert.Nil(t, <-done)
+
+	_, err := client.GetEngine("e")
+	assert.True(t, errors.Is(err, context.Canceled))
+}
+
+// Test that a client created without NewClient can have its context replaced
+// and be closed.
+func TestClientLiteral(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"computes": [{"name": "e", "state": "PROVISIONED"}]}`)
+	}))
+	defer server.Close()
+	u, err := url.Parse(server.URL)
+	assert.Nil(t, err)
+	client := &Client{Scheme: u.Scheme, Host: u.Hostname(), Port: u.Port()}
+	client.SetAccessTokenHandler(NewNopAccessTokenHandler())
+	client.HttpClient = server.Client()
+
+	_, err = client.GetEngine("e")
+	assert.Nil(t, err)
+	client.SetContext(context.Background())
+	_, err = client.GetEngine("e")
+	assert.Nil(t, err)
+
+	assert.Nil(t, client.Close())
+	assert.Nil(t, client.Close())
+	_, err = client.GetEngine("e")
+	assert.True(t, errors.Is(err, context.Canceled))
+}
+
+func TestTransactionDuration(t *testing.T) {
+	var rsp TransactionResponse
+	err := json.Unmarshal([]byte(`{
+		"id": "tx", "state": "COMPLETED", "engine_name": "e",
+		"created_on": 1000, "finished_at": 3500, "duration": 2400}`), &rsp.Transaction)
+	assert.Nil(t, err)
+	assert.Equal(t, "e", rsp.Transaction.Engine)
+	assert.Equal(t, 2400*time.Millisecond, rsp.Duration())
+
+	rsp.Transaction.Duration = 0
+	assert.Equal(t, 2500*time.Millisecond, rsp.Duration())
+
+	rsp.Transaction.FinishedAt = 0
+	assert.Equal(t, time.Duration(0), rsp.Duration())
+}
+
+func TestAbortTransaction(t *testing.T) {
+	var cancelled bool
+	final := "ABORTED"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			assert.True(t, strings.HasSuffix(r.URL.Path, "/tx/cancel"))
+			cancelled = true
+			fmt.Fprint(w, `{"message": "cancelling"}`)
+			return
+		}
+		state := "RUNNING"
+		if cancelled {
+			state = final
+		}
+		fmt.Fprintf(w, `{"transaction": {"id": "tx", "state": "%s"}}`, state)
+	}))
+	defer server.Close()
+	client := newServerClient(t, server)
+
+	assert.Nil(t, client.AbortTransaction("tx"))
+
+	cancelled, final = false, "COMPLETED"
+	err := client.AbortTransaction("tx")
+	assert.True(t, errors.Is(err, ErrTransactionCompleted))
+}
+
+func TestCancelTransaction(t *testing.T) {
+	var cancels int32
+	state := "RUNNING"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		assert.True(t, strings.HasSuffix(r.URL.Path, "/tx/cancel"))
+		atomic.AddInt32(&cancels, 1)
+		if state != "RUNNING" {
+			w.WriteHeader(http.StatusConflict)
+			fmt.Fprintf(w, `{"message": "transaction is %s"}`, state)
+			return
+		}
+		fmt.Fprint(w, `{"message": "cancelling"}`)
+	}))
+	defer server.Close()
+	client := newServerClient(t, server)
+
+	msg, err := client.CancelTransaction("tx")
+	assert.Nil(t, err)
+	assert.Equal(t, "cancelling", msg)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&cancels))
+
+	// the cancel is requested without checking the state first
+	for _, state = range []string{"COMPLETED", "ABORTED"} {
+		_, err = client.CancelTransaction("tx")
+		assert.True(t, errors.Is(err, ErrTransactionTerminal))
+	}
+	assert.Equal(t, int32(3), atomic.LoadInt32(&cancels))
+}
+
+// Test that a transaction is cancelled when a context given to a wait on it
+// is done before it completes, but not when the client's context is.
+func TestWaitForTransactionCancel(t *testing.T) {
+	var cancels int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			assert.True(t, strings.HasSuffix(r.URL.Path, "/tx/cancel"))
+			atomic.AddInt32(&cancels, 1)
+			fmt.Fprint(w, `{"message": "cancelling"}`)
+			return
+		}
+		fmt.Fprint(w, `{"transaction": {"id": "tx", "state": "RUNNING"}}`)
+	}))
+	defer server.Close()
+	client := newServerClient(t, server)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	rsp, err := client.WaitForTransactionContext(ctx, "tx")
+	assert.Nil(t, rsp)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&cancels))
+
+	// a wait on the client's context leaves the transaction running
+	ctx, cancel = context.WithCancel(context.Background())
+	client.SetContext(ctx)
+	done := make(chan error)
+	go func() {
+		_, err := client.WaitForTransaction("tx")
+		done <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	err = <-done
+	assert.True(t, errors.Is(err, context.Canceled))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&cancels))
+}
+
+func TestPollOptionsPause(t *testing.T) {
+	t0 := time.Now().Add(-10 * time.Second)
+	var poll *PollOptions
+	assert.Equal(t, 500*time.Millisecond, poll.firstPause())
+	pause := poll.nextPause(0, t0)
+	assert.True(t, pause >= 2*time.Second && pause < 3*time.Second)
+	assert.Equal(t, twoMinutes, poll.nextPause(0, t0.Add(-time.Hour)))
+
+	poll = &PollOptions{Interval: time.Second}
+	assert.Equal(t, time.Second, poll.firstPause())
+	assert.Equal(t, time.Second, poll.nextPause(time.Second, t0))
+
+	poll.Backoff = 1.5
+	assert.Equal(t, 1500*time.Millisecond, poll.nextPause(time.Second, t0))
+	assert.Equal(t, twoMinutes, poll.nextPause(100*time.Second, t0))
+}
+
+func TestWaitForTransactionPollTimeout(t *testing.T) {
+	var polls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		atomic.AddInt32(&polls, 1)
+		fmt.Fprint(w, `{"transaction": {"id": "tx", "state": "RUNNING"}}`)
+	}))
+	defer server.Close()
+	client := newServerClient(t, server)
+
+	opts := &PollOptions{Interval: 50 * time.Millisecond, Timeout: 300 * time.Millisecond, Backoff: 2}
+	t0 := time.Now()
+	rsp, err := client.WaitForTransactionWithOptions("tx", opts)
+	assert.Nil(t, rsp)
+	assert.True(t, errors.Is(err, ErrPollTimeout))
+	assert.True(t, time.Since(t0) < time.Second)
+	// the initial request, then polls after 50ms and 100ms
+	n := atomic.LoadInt32(&polls)
+	assert.True(t, n >= 3 && n <= 5, "polls: %d", n)
+}
+
+func TestWaitForTransactionPollTimeoutSlowRequest(t *testing.T) {
+	var polls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		if atomic.AddInt32(&polls, 1) > 1 {
+			// polls hang until the request is abandoned
+			select {
+			case <-r.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+			return
+		}
+		fmt.Fprint(w, `{"transaction": {"id": "tx", "state": "RUNNING"}}`)
+	}))
+	defer server.Close()
+	client := newServerClient(t, server)
+
+	opts := &PollOptions{Interval: 50 * time.Millisecond, Timeout: 200 * time.Millisecond}
+	t0 := time.Now()
+	rsp, err := client.WaitForTransactionWithOptions("tx", opts)
+	assert.Nil(t, rsp)
+	assert.True(t, errors.Is(err, ErrPollTimeout))
+	assert.True(t, time.Since(t0) < time.Second)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&polls))
+}
+
+func TestGetTransactionProblemsStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.True(t, strings.HasSuffix(r.URL.Path, "/transactions/tx/problems"))
+		fmt.Fprint(w, `[
+			{"type": "ClientProblem", "message": "one"},
+			{"type": "ClientProblem", "message": "two", "is_error": true},
+			{"type": "ClientProblem", "message": "three"}]`)
+	}))
+	defer server.Close()
+	client := newServerClient(t, server)
+
+	var messages []string
+	err := client.GetTransactionProblemsStream("tx", func(p Problem) error {
+		messages = append(messages, p.Message)
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"one", "two", "three"}, messages)
+
+	// stops at the first error returned by the callback
+	messages = nil
+	stop := errors.New("stop")
+	err = client.GetTransactionProblemsStream("tx", func(p Problem) error {
+		messages = append(messages, p.Message)
+		if p.IsError {
+			return stop
+		}
+		return nil
+	})
+	assert.Equal(t, stop, err)
+	assert.Equal(t, []string{"one", "two"}, messages)
+}
+
+func TestReadRelFile(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "query.rel")
+	err := os.WriteFile(fname, []byte("\ufeffdef output {1}\r\ndef output {2}\n"), 0644)
+	assert.Nil(t, err)
+	source, err := ReadRelFile(fname)
+	assert.Nil(t, err)
+	assert.Equal(t, "def output {1}\ndef output {2}\n", source)
+
+	_, err = ReadRelFile(fname + ".missing")
+	assert.True(t, errors.Is(err, fs.ErrNotExist))
+	assert.Contains(t, err.Error(), "does not exist")
+}
+
+func TestExecuteFileReadError(t *testing.T) {
+	client := &Client{}
+	fname := filepath.Join(t.TempDir(), "missing.rel")
+	_, err := client.ExecuteFile("db", "engine", fname, nil, true)
+	assert.True(t, errors.Is(err, fs.ErrNotExist))
+	assert.Contains(t, err.Error(), fname)
+	_, err = client.ExecuteFileAsync("db", "engine", fname, nil, true)
+	assert.True(t, errors.Is(err, fs.ErrNotExist))
+}
+
+func TestResultsAPIV1(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/transaction" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fmt.Fprint(w, `{
+			"aborted": false,
+			"output": [
+				{"rel_key": {"name": "output", "keys": [":a", "Int64"], "values": ["String"]},
+				 "columns": [[1, 2], ["x", "y"]]},
+				{"rel_key": {"name": "output", "keys": [":b"], "values": []}, "columns": []},
+				{"rel_key": {"name": "other", "keys": ["Dates.Date"], "values": ["Float64"]},
+				 "columns": [["2022-01-02"], [1.5]]}],
+			"problems": [{"type": "ClientProblem", "message": "warning"}]}`)
+	}))
+	defer server.Close()
+	client := newServerClient(t, server)
+
+	opts := NewExecuteOptions().WithResultsAPI(ResultsAPIV1)
+	rsp, err := client.ExecuteWithOptions("db", "engine", "def output = 1", nil, true, opts)
+	assert.Nil(t, err)
+	assert.Equal(t, Completed, rsp.Transaction.State)
+	assert.Equal(t, "engine", rsp.Transaction.Engine)
+
+	rs := rsp.Relations("output", "a")
+	assert.Equal(t, 1, len(rs))
+	assert.Equal(t, Signature{"output", "a", Int64Type, StringType}, rs[0].Signature())
+	assert.Equal(t, []any{"output", "a", int64(2), "y"}, rs[0].Row(1))
+
+	rs = rsp.Relations("output", "b")
+	assert.Equal(t, 1, len(rs))
+	assert.Equal(t, []any{"output", "b"}, rs[0].Row(0))
+
+	rs = rsp.Relations("other")
+	assert.Equal(t, 1, len(rs))
+	assert.Equal(t, []any{"other", "2022-01-02", 1.5}, rs[0].Row(0))
+
+	problems, err := rsp.EnsureProblems(client)
+	assert.Nil(t, err)
+	assert.Equal(t, []Problem{{Type: "ClientProblem", Message: "warning"}}, problems)
+	_, err = rsp.EnsureResults(client)
+	assert.Nil(t, err)
+	_, err = rsp.EnsureMetadata(client)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"other", "output"}, rsp.OutputNames())
+
+	// the v1 endpoint does not support tags
+	_, err = client.ExecuteAsyncWithOptions("db", "engine", "def output = 1", nil, true, opts, "tag")
+	assert.True(t, errors.Is(err, ErrTagsNotSupported))
+	opts = NewExecuteOptions().WithAbort(true)
+	_, err = client.ExecuteAsyncWithOptions("db", "engine", "def output = 1", nil, true, opts, "tag")
+	assert.True(t, errors.Is(err, ErrTagsNotSupported))
+}
+
+func TestExecuteAbort(t *testing.T) {
+	var payload map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/transaction" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		assert.Nil(t, json.NewDecoder(r.Body).Decode(&payload))
+		fmt.Fprint(w, `{
+			"aborted": true,
+			"output": [
+				{"rel_key": {"name": "output", "keys": [], "values": ["Int64"]}, "columns": [[3]]}],
+			"problems": []}`)
+	}))
+	defer server.Close()
+	client := newServerClient(t, server)
+
+	rsp, err := client.ExecuteAbort("db", "engine", "def insert:r = 1, 2, 3\ndef output = count[r]")
+	assert.Nil(t, err)
+	assert.Equal(t, true, payload["abort"])
+	assert.Equal(t, false, payload["readonly"])
+	assert.True(t, rsp.RolledBack)
+	assert.Equal(t, Aborted, rsp.Transaction.State)
+	assert.Empty(t, rsp.Problems)
+	v, err := rsp.Scalar(rsp.OrderedRelationIDs()[0])
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), v)
+
+	opts := NewExecuteOptions().WithResultsAPI(ResultsAPIV1)
+	rsp, err = client.ExecuteWithOptions("db", "engine", "def output = 1", nil, false, opts)
+	assert.Nil(t, err)
+	assert.Equal(t, false, payload["abort"])
+	assert.False(t, rsp.RolledBack)
+}
+
+func TestResubmitReason(t *testing.T) {
+	opts := NewExecuteOptions().WithResubmit(2, "engine lost")
+	assert.True(t, opts.isResubmitReason(&Transaction{State: Aborted, AbortReason: "engine lost"}))
+	assert.False(t, opts.isResubmitReason(&Transaction{State: Aborted, AbortReason: "cancelled"}))
+	assert.False(t, opts.isResubmitReason(&Transaction{State: Completed}))
+}
+
+func TestCheckProblems(t *testing.T) {
+	assert.Nil(t, checkProblems("tx", nil))
+	assert.Nil(t, checkProblems("tx", []Problem{{Message: "warning"}}))
+
+	problems := []Problem{{Message: "warning"}, {Message: "broken", IsError: true}}
+	err := checkProblems("tx", problems)
+	assert.Equal(t, TransactionProblemsError{"tx", problems}, err)
+	assert.Equal(t, "transaction tx failed with 1 error(s): broken", err.Error())
+}
+
 func TestXRequestId(t *testing.T) {
 	query := `def output {1 + 1}`
 	inputs := make([]interface{}, 0)
@@ -16,8 +16,11 @@ package rai
 
 import (
 	"fmt"
+	"io/fs"
+	"net/url"
 	"os/user"
 	"path"
+	"regexp"
 	"strings"
 
 	"github.com/pkg/errors"
@@ -30,12 +33,19 @@ const DefaultConfigProfile = "default"
 /* #nosec */
 const defaultClientCredentialsUrl = "https://login.relationalai.com/oauth/token"
 
+const defaultDeviceAuthorizationUrl = "https://login.relationalai.com/oauth/device/code"
+
+// Config holds client settings. At most one kind of credential may be
+// given: OAuth client credentials, a pre-issued access token, or the path of
+// a file containing an access token, eg one maintained by a secret manager.
 type Config struct {
-	Region      string             `json:"region"`
-	Scheme      string             `json:"scheme"`
-	Host        string             `json:"host"`
-	Port        string             `json:"port"`
-	Credentials *ClientCredentials `json:"credentials"`
+	Region          string             `json:"region"`
+	Scheme          string             `json:"scheme"`
+	Host            string             `json:"host"`
+	Port            string             `json:"port"`
+	Credentials     *ClientCredentials `json:"credentials"`
+	AccessToken     string             `json:"-"`
+	AccessTokenFile string             `json:"access_token_file,omitempty"`
 }
 
 // Expand the given file path if it start with a ~/
@@ -50,15 +60,88 @@ func expandUser(fname string) (string, error) {
 	return fname, nil
 }
 
+var (
+	ErrConfigFileNotFound    = errors.New("config file not found")
+	ErrConfigProfileNotFound = errors.New("config profile not found")
+	ErrConfigMissingField    = errors.New("config field missing")
+	ErrConfigCredentials     = errors.New("config has more than one kind of credential")
+	ErrConfigInvalidField    = errors.New("config field invalid")
+	ErrInvalidRegion         = errors.New("invalid region")
+)
+
+// Region names are lower case words separated by hyphens, eg "us-east" or
+// "eu-west-1".
+var regionPattern = regexp.MustCompile(`^[a-z][a-z0-9]*(-[a-z0-9]+)*$`)
+
+// Returns an error matching ErrInvalidRegion if the given region is empty or
+// is not a well-formed region name. The region is not checked against the
+// regions offered by the service, so that new regions need no SDK change.
+func ValidateRegion(region string) error {
+	if region == "" {
+		return errors.Wrap(ErrInvalidRegion, "region is empty")
+	}
+	if !regionPattern.MatchString(region) {
+		return errors.Wrapf(ErrInvalidRegion, "region '%s' is not well-formed", region)
+	}
+	return nil
+}
+
+// ConfigError is returned when a config cannot be loaded. It matches the
+// error given by `Kind`, eg ErrConfigProfileNotFound, when using errors.Is,
+// and unwraps to the underlying error, if any.
+type ConfigError struct {
+	Kind    error
+	File    string // empty when loading from a string
+	Profile string
+	Field   string // the missing or invalid field
+	Err     error
+}
+
+func (e ConfigError) Error() string {
+	var msg string
+	switch e.Kind {
+	case ErrConfigFileNotFound:
+		msg = fmt.Sprintf("config file '%s' not found", e.File)
+	case ErrConfigProfileNotFound:
+		msg = fmt.Sprintf("config profile '%s' not found", e.Profile)
+	case ErrConfigMissingField:
+		msg = fmt.Sprintf("config profile '%s' is missing '%s'", e.Profile, e.Field)
+	case ErrConfigInvalidField:
+		msg = fmt.Sprintf("config profile '%s' has an invalid '%s'", e.Profile, e.Field)
+	case ErrConfigCredentials:
+		msg = fmt.Sprintf(
+			"config profile '%s' must specify only one of client_id/client_secret, "+
+				"access_token or access_token_file", e.Profile)
+	default:
+		msg = "error loading config"
+	}
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e ConfigError) Is(target error) bool {
+	return target == e.Kind
+}
+
+func (e ConfigError) Unwrap() error {
+	return e.Err
+}
+
 // Load the named stanza from the source.
 // Source can be either filename or config string
 func loadStanza(source interface{}, profile string) (*ini.Section, error) {
+	fname, _ := source.(string)
 	info, err := ini.Load(source)
 	if err != nil {
-		return nil, errors.Wrapf(err, "error loading config")
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, ConfigError{Kind: ErrConfigFileNotFound, File: fname, Err: err}
+		}
+		return nil, ConfigError{File: fname, Profile: profile, Err: err}
 	}
 	if !info.HasSection(profile) {
-		return nil, errors.Errorf("config profile '%s' not found", profile)
+		return nil, ConfigError{Kind: ErrConfigProfileNotFound, File: fname, Profile: profile}
 	}
 	stanza := info.Section(profile)
 	return stanza, nil
@@ -75,7 +158,14 @@ func LoadConfigProfile(profile string, cfg *Config) error {
 }
 
 func parseConfigStanza(stanza *ini.Section, cfg *Config) error {
-	if v := stanza.Key("region").String(); v != "" {
+	if stanza.HasKey("region") {
+		// an empty region is an error, rather than falling back on the default
+		v := strings.TrimSpace(stanza.Key("region").String())
+		if err := ValidateRegion(v); err != nil {
+			return ConfigError{
+				Kind: ErrConfigInvalidField, Profile: stanza.Name(),
+				Field: "region", Err: err}
+		}
 		cfg.Region = v
 	}
 	if v := stanza.Key("scheme").String(); v != "" {
@@ -89,9 +179,43 @@ func parseConfigStanza(stanza *ini.Section, cfg *Config) error {
 	}
 	clientID := stanza.Key("client_id").String()
 	clientSecret := stanza.Key("client_secret").String()
+	accessToken := stanza.Key("access_token").String()
+	accessTokenFile := stanza.Key("access_token_file").String()
+	count := 0
+	for _, v := range []bool{clientID != "" || clientSecret != "", accessToken != "", accessTokenFile != ""} {
+		if v {
+			count++
+		}
+	}
+	if count > 1 {
+		return ConfigError{Kind: ErrConfigCredentials, Profile: stanza.Name()}
+	}
+	if accessToken != "" {
+		cfg.AccessToken = accessToken
+	}
+	if accessTokenFile != "" {
+		fname, err := expandUser(accessTokenFile)
+		if err != nil {
+			return err
+		}
+		cfg.AccessTokenFile = fname
+	}
+	if clientID != "" && clientSecret == "" {
+		return ConfigError{Kind: ErrConfigMissingField, Profile: stanza.Name(), Field: "client_secret"}
+	}
+	if clientSecret != "" && clientID == "" {
+		return ConfigError{Kind: ErrConfigMissingField, Profile: stanza.Name(), Field: "client_id"}
+	}
 	if clientID != "" && clientSecret != "" {
+		// the profile's client_credentials_url, if any, takes precedence over
+		// the default RelationalAI token endpoint
 		clientCredentialsUrl := defaultClientCredentialsUrl
 		if v := stanza.Key("client_credentials_url").String(); v != "" {
+			if u, err := url.Parse(v); err != nil || !u.IsAbs() || u.Host == "" {
+				return ConfigError{
+					Kind: ErrConfigInvalidField, Profile: stanza.Name(),
+					Field: "client_credentials_url", Err: err}
+			}
 			clientCredentialsUrl = v
 		}
 		audience := fmt.Sprintf("https://%s", cfg.Host)
@@ -103,6 +227,7 @@ func parseConfigStanza(stanza *ini.Section, cfg *Config) error {
 			ClientSecret:         clientSecret,
 			ClientCredentialsUrl: clientCredentialsUrl,
 			Audience:             audience,
+			Scope:                stanza.Key("scope").String(),
 		}
 	}
 	return nil
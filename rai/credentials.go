@@ -22,10 +22,11 @@ import (
 
 // todo: make sure CreatedOn is persisted as epoch seconds
 type AccessToken struct {
-	Token     string `json:"access_token"`
-	Scope     string `json:"scope"`
-	ExpiresIn int    `json:"expires_in"` // token lifetime in seconds
-	CreatedOn int64  `json:"created_on"` // epoch seconds
+	Token        string `json:"access_token"`
+	RefreshToken string `json:"refresh_token,omitempty"` // if issued by the server
+	Scope        string `json:"scope"`
+	ExpiresIn    int    `json:"expires_in"` // token lifetime in seconds
+	CreatedOn    int64  `json:"created_on"` // epoch seconds
 }
 
 // Returns the current time in epoch seconds.
@@ -59,5 +60,6 @@ type ClientCredentials struct {
 	ClientID             string `json:"clientId"`
 	ClientSecret         string `json:"-"`
 	ClientCredentialsUrl string `json:"clientCredentialsUrl"`
-	Audience             string `json:"audience"`
+	Audience             string `json:"audience"` // default is https://<host>
+	Scope                string `json:"scope,omitempty"`
 }
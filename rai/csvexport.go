@@ -0,0 +1,186 @@
+// Copyright 2022 RelationalAI, Inc.
+
+package rai
+
+// Support for exporting transaction results as CSV.
+
+// Relations are written a row at a time from their typed columns, so that
+// values are formatted directly from the arrow data, without being boxed as
+// the `[]any` rows returned by `Row`. Strings, symbols and chars are written
+// unquoted, other than as needed by CSV, decimals according to the
+// DecimalFormat option, and all other values are written as they are by the
+// column's `String` method.
+
+import (
+	"context"
+	"encoding/csv"
+	"io"
+	"net/http"
+
+	"github.com/apache/arrow/go/v7/arrow/ipc"
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+)
+
+type CSVWriteOptions struct {
+	Delim         rune          // field delimiter, default ','
+	Header        bool          // write a header row of column names
+	DecimalFormat DecimalFormat // default DecimalShortest
+}
+
+func NewCSVWriteOptions() *CSVWriteOptions {
+	return &CSVWriteOptions{}
+}
+
+func (opts *CSVWriteOptions) WithDelim(delim rune) *CSVWriteOptions {
+	opts.Delim = delim
+	return opts
+}
+
+func (opts *CSVWriteOptions) WithHeader(header bool) *CSVWriteOptions {
+	opts.Header = header
+	return opts
+}
+
+func (opts *CSVWriteOptions) WithDecimalFormat(f DecimalFormat) *CSVWriteOptions {
+	opts.DecimalFormat = f
+	return opts
+}
+
+// Returns the decimal format of the given options.
+func (opts *CSVWriteOptions) decimalFormat() DecimalFormat {
+	if opts == nil {
+		return DecimalShortest
+	}
+	return opts.DecimalFormat
+}
+
+func newCSVWriter(w io.Writer, opts *CSVWriteOptions) *csv.Writer {
+	cw := csv.NewWriter(w)
+	if opts != nil && opts.Delim != 0 {
+		cw.Comma = opts.Delim
+	}
+	return cw
+}
+
+// Returns the CSV field for the given row of the given column.
+func csvValue(c Column, rnum int, f DecimalFormat) string {
+	switch cc := c.(type) {
+	case DataColumn[string]:
+		return cc.Item(rnum)
+	case DataColumn[rune]:
+		return string(cc.Item(rnum))
+	case DataColumn[decimal.Decimal]:
+		return formatDecimal(cc.Item(rnum), f)
+	}
+	return c.String(rnum)
+}
+
+// Write the rows of the given relation to the given CSV writer.
+func writeRelationCSV(cw *csv.Writer, r Relation, f DecimalFormat) error {
+	cols := r.Columns()
+	record := make([]string, len(cols))
+	nrows := r.NumRows()
+	for rnum := 0; rnum < nrows; rnum++ {
+		for cnum, c := range cols {
+			record[cnum] = csvValue(c, rnum, f)
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Write the given relation as CSV to the given writer.
+func WriteRelationCSV(r Relation, w io.Writer, opts *CSVWriteOptions) error {
+	cw := newCSVWriter(w, opts)
+	if opts != nil && opts.Header {
+		if err := cw.Write(columnNames(r.Signature())); err != nil {
+			return err
+		}
+	}
+	if err := writeRelationCSV(cw, r, opts.decimalFormat()); err != nil {
+		return err
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// Write the relation with the given id, eg "0.arrow", from the results of
+// the given transaction as CSV to the given writer. The relation is streamed
+// from the results endpoint a record batch at a time, so the results of the
+// transaction are never held in memory as a whole.
+func (c *Client) GetTransactionResultsAsCSV(
+	id, relationID string, w io.Writer, opts *CSVWriteOptions,
+) error {
+	return c.GetTransactionResultsAsCSVContext(c.Context(), id, relationID, w, opts)
+}
+
+func (c *Client) GetTransactionResultsAsCSVContext(
+	ctx context.Context, id, relationID string, w io.Writer, opts *CSVWriteOptions,
+) error {
+	meta, err := c.GetTransactionMetadataContext(ctx, id)
+	if err != nil {
+		return err
+	}
+	msig := meta.Signature(relationID)
+	if msig == nil {
+		return errors.Errorf("relation '%s' not found", relationID)
+	}
+	var rsp *http.Response
+	err = c.GetContext(ctx, makePath(PathTransactions, id, "results"), nil, nil, &rsp)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+	mr, err := newMultipartReader(rsp)
+	if err != nil {
+		return err
+	}
+	for {
+		part, err := mr.NextPart()
+		if err != nil {
+			if err == io.EOF {
+				return errors.Errorf("relation '%s' not found", relationID)
+			}
+			return err
+		}
+		if part.FormName() == "relation-count" || part.FileName() != relationID {
+			continue
+		}
+		return writePartitionCSV(part, msig, w, opts)
+	}
+}
+
+// Write the arrow IPC stream of a partition with the given metadata
+// signature as CSV to the given writer.
+func writePartitionCSV(rd io.Reader, msig Signature, w io.Writer, opts *CSVWriteOptions) error {
+	r, err := ipc.NewReader(rd)
+	if err != nil {
+		return err
+	}
+	defer r.Release()
+	cw := newCSVWriter(w, opts)
+	if opts != nil && opts.Header {
+		sig := make(Signature, len(msig))
+		for i, t := range msig {
+			sig[i] = relationType(t)
+		}
+		if err := cw.Write(columnNames(sig)); err != nil {
+			return err
+		}
+	}
+	for r.Next() {
+		// the record is only valid until the next call to Next
+		rel := newBaseRelation(newPartition(r.Record()), msig)
+		if err := writeRelationCSV(cw, rel, opts.decimalFormat()); err != nil {
+			return err
+		}
+	}
+	if err := r.Err(); err != nil {
+		return err
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -35,10 +35,40 @@ func DateFromRataMillis(d int64) time.Time {
 	return time.UnixMilli(d).UTC()
 }
 
+// Returns the millis since 1AD of the given time, as used to represent Rel
+// DateTime values. This is the inverse of DateFromRataMillis.
+func RataMillisFromDateTime(t time.Time) int64 {
+	return t.UnixMilli() + epochStartMillis
+}
+
+// Returns the Rata Die day number of the calendar date of the given time in
+// the time's location. This is the inverse of DateFromRataDie.
+func RataDieFromDate(t time.Time) int64 {
+	y, m, d := t.Date()
+	days := time.Date(y, m, d, 0, 0, 0, 0, time.UTC).Unix() / (24 * 60 * 60)
+	return days + epochStartDays
+}
+
+// Date is a calendar date, rendered by RelLiteral as a Rel Date literal
+// rather than as a DateTime. Only the year, month and day of the time in its
+// location are significant.
+type Date struct {
+	time.Time
+}
+
+// Returns the Date of the given time in the time's location.
+func DateOf(t time.Time) Date {
+	y, m, d := t.Date()
+	return Date{time.Date(y, m, d, 0, 0, 0, 0, t.Location())}
+}
+
+var twoTo128 = new(big.Int).Lsh(big.NewInt(1), 128)
+
+// Returns the value of the given two's complement 128 bit integer.
 func NewBigInt128(lo, hi uint64) *big.Int {
 	result := new(big.Int).SetBits([]big.Word{big.Word(lo), big.Word(hi)})
 	if int64(hi) < 0 {
-		result.Neg(result)
+		result.Sub(result, twoTo128)
 	}
 	return result
 }
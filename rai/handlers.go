@@ -14,15 +14,23 @@
 
 package rai
 
-// Implementation of the nop and client credential token handlers.
+// Implementation of the nop, static, token file, client credential and device
+// code token handlers.
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
+	"net/http"
+	"net/url"
 	"os"
 	"os/user"
 	"path"
 	"path/filepath"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 )
@@ -43,10 +51,55 @@ func (h NopAccessTokenHandler) GetAccessToken() (string, error) {
 	return "", nil
 }
 
+var ErrAccessTokenExpired = errors.New("access token expired")
+
+// This handler returns a pre-issued access token, eg one injected by a secret
+// manager or sidecar, until the token expires.
+type StaticTokenHandler struct {
+	token     string
+	expiresAt time.Time
+}
+
+// Returns a handler for the given token. A zero `expiresAt` means the token
+// never expires.
+func NewStaticTokenHandler(token string, expiresAt time.Time) StaticTokenHandler {
+	return StaticTokenHandler{token: token, expiresAt: expiresAt}
+}
+
+func (h StaticTokenHandler) GetAccessToken() (string, error) {
+	if !h.expiresAt.IsZero() && !time.Now().Before(h.expiresAt) {
+		return "", ErrAccessTokenExpired
+	}
+	return h.token, nil
+}
+
+// This handler returns the access token stored in the given file, eg one
+// written by a secret manager. The file is read on each call, so a token that
+// is rotated by rewriting the file is picked up without restarting.
+type TokenFileHandler struct {
+	fname string
+}
+
+func NewTokenFileHandler(fname string) TokenFileHandler {
+	return TokenFileHandler{fname: fname}
+}
+
+func (h TokenFileHandler) GetAccessToken() (string, error) {
+	data, err := os.ReadFile(h.fname)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to read token file")
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
 type ClientCredentialsHandler struct {
 	client      *Client
 	creds       *ClientCredentials
+	mu          sync.Mutex
+	fetch       sync.Mutex // held while fetching a token, see GetAccessToken
 	accessToken *AccessToken
+	stop        chan struct{} // closed to stop background refresh
+	done        chan struct{} // closed when background refresh exits
 }
 
 // This handler uses the given OAuth client credentials to retrieve access
@@ -66,14 +119,14 @@ func cachePath() (string, error) {
 	return path.Join(usr.HomeDir, ".rai", "tokens.json"), nil
 }
 
-// Read the access token corresponding to the given ClientID from the local
+// Read the access token corresponding to the given client ID from the local
 // token cache, returns nil if the token does not exist.
-func readAccessToken(creds *ClientCredentials) (*AccessToken, error) {
+func readAccessToken(clientID string) (*AccessToken, error) {
 	cache, err := readTokenCache()
 	if err != nil {
 		return nil, err
 	}
-	if token, ok := cache[creds.ClientID]; ok {
+	if token, ok := cache[clientID]; ok {
 		return token, nil
 	}
 	return nil, nil // doesn't exit
@@ -113,42 +166,352 @@ func writeTokenCache(cache map[string]*AccessToken) {
 		return
 	}
 
+	// the cache holds credentials, so is only readable by its owner
 	dirName := filepath.Dir(fname)
-	err = os.MkdirAll(dirName, 0775)
+	err = os.MkdirAll(dirName, 0700)
 	if err != nil {
 		fmt.Println(errors.Wrapf(err, "failed to create token directory"))
 	}
 
-	f, err := os.OpenFile(fname, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	f, err := os.OpenFile(fname, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
 	if err != nil {
 		fmt.Println(errors.Wrapf(err, "failed to open token file"))
 		return
 	}
+	if err := f.Chmod(0600); err != nil { // created by an earlier version
+		fmt.Println(errors.Wrapf(err, "failed to set token file permissions"))
+	}
 	if err := json.NewEncoder(f).Encode(cache); err != nil {
 		fmt.Println(errors.Wrapf(err, "failed to encode json"))
 	}
 	f.Close()
 }
 
+// Returns the access token currently loaded into the handler, if any.
+func (h *ClientCredentialsHandler) currentToken() *AccessToken {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.accessToken
+}
+
+func (h *ClientCredentialsHandler) setToken(token *AccessToken) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.accessToken = token
+}
+
 func (h *ClientCredentialsHandler) GetAccessToken() (string, error) {
 	// 1. is it already loaded into the handler?
-	if h.accessToken != nil && !h.accessToken.IsExpired() {
-		return h.accessToken.Token, nil
+	if token := h.currentToken(); token != nil && !token.IsExpired() {
+		return token.Token, nil
+	}
+
+	// Only one caller fetches a token at a time, and callers that were
+	// waiting on it use the token it fetched, so that concurrent requests
+	// on a new client result in a single token request.
+	h.fetch.Lock()
+	defer h.fetch.Unlock()
+	if token := h.currentToken(); token != nil && !token.IsExpired() {
+		return token.Token, nil
 	}
 
 	// 2. is it available in the tokens.json cache on disk?
-	accessToken, err := readAccessToken(h.creds)
-	if err == nil && accessToken != nil && !accessToken.IsExpired() {
-		h.accessToken = accessToken
-		return accessToken.Token, nil
+	accessToken, err := readAccessToken(h.creds.ClientID)
+	if err == nil && accessToken != nil {
+		if !accessToken.IsExpired() {
+			h.setToken(accessToken)
+			return accessToken.Token, nil
+		}
+		if h.currentToken() == nil {
+			h.setToken(accessToken) // its refresh token may still be valid
+		}
 	}
 
 	// 3. request a new token and save in tokens.json cache
-	accessToken, err = h.client.GetAccessToken(h.creds)
+	accessToken, err = h.refresh()
 	if err != nil {
 		return "", err
 	}
-	h.accessToken = accessToken
+	return accessToken.Token, nil
+}
+
+// Request a new access token, regardless of the state of the current token,
+// and save it in the tokens.json cache. If the current token carries a
+// refresh token, it is used to renew the token, falling back to the client
+// credentials if the renewal fails.
+func (h *ClientCredentialsHandler) refresh() (*AccessToken, error) {
+	var accessToken *AccessToken
+	var refreshErr error
+	if token := h.currentToken(); token != nil && token.RefreshToken != "" {
+		accessToken, refreshErr = h.client.RefreshAccessToken(
+			h.creds.ClientCredentialsUrl, h.creds.ClientID, token)
+		if refreshErr != nil && h.client.debug != nil {
+			fmt.Fprintf(h.client.debug, "token refresh failed, using client credentials: %v\n", refreshErr)
+		}
+	}
+	if accessToken == nil {
+		var err error
+		if accessToken, err = h.client.GetAccessToken(h.creds); err != nil {
+			if refreshErr != nil {
+				return nil, errors.Wrapf(err, "token refresh failed (%v)", refreshErr)
+			}
+			return nil, err
+		}
+	}
+	h.setToken(accessToken)
 	writeAccessToken(h.creds.ClientID, accessToken)
+	return accessToken, nil
+}
+
+// Minimum pause between background refresh attempts, also used to retry
+// after a failed refresh.
+const refreshRetryInterval = 10 * time.Second
+
+// Start a background goroutine that renews the access token the given
+// duration before it expires, so that requests never wait on a token fetch.
+// The goroutine runs until Stop is called or the given context is done, after
+// which Start may be called again. Calling Start while a refresh goroutine is
+// already running has no effect.
+func (h *ClientCredentialsHandler) Start(ctx context.Context, before time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.stop != nil {
+		return // already running
+	}
+	h.stop = make(chan struct{})
+	h.done = make(chan struct{})
+	go h.refreshLoop(ctx, before, h.stop, h.done)
+}
+
+// Stop the background refresh goroutine, if running, and wait for it to exit.
+func (h *ClientCredentialsHandler) Stop() {
+	h.mu.Lock()
+	stop, done := h.stop, h.done
+	h.stop, h.done = nil, nil
+	h.mu.Unlock()
+	if stop == nil {
+		return
+	}
+	close(stop)
+	<-done
+}
+
+func (h *ClientCredentialsHandler) refreshLoop(
+	ctx context.Context, before time.Duration, stop, done chan struct{},
+) {
+	defer close(done)
+
+	// Returns the instant at which the given token should be renewed.
+	refreshOn := func(token *AccessToken) time.Time {
+		return time.Unix(token.ExpiresOn(), 0).Add(-before)
+	}
+
+	if h.currentToken() == nil {
+		_, _ = h.GetAccessToken() // failures are retried below
+	}
+	for {
+		token := h.currentToken()
+		if token == nil || !time.Now().Before(refreshOn(token)) {
+			h.fetch.Lock()
+			token, _ = h.refresh()
+			h.fetch.Unlock()
+		}
+		wait := refreshRetryInterval
+		if token != nil {
+			if d := time.Until(refreshOn(token)); d > wait {
+				wait = d
+			}
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			h.mu.Lock()
+			if h.stop == stop { // not already cleared by Stop
+				h.stop, h.done = nil, nil
+			}
+			h.mu.Unlock()
+			return
+		case <-stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// Settings for the OAuth device authorization flow.
+type DeviceCodeConfig struct {
+	ClientID               string
+	DeviceAuthorizationUrl string    // default https://login.relationalai.com/oauth/device/code
+	TokenUrl               string    // default https://login.relationalai.com/oauth/token
+	Audience               string    // default https://<host>
+	Scope                  string    // optional
+	Prompt                 io.Writer // destination of user instructions, default stderr
+}
+
+var (
+	ErrDeviceCodeExpired = errors.New("device code expired")
+	ErrAccessDenied      = errors.New("access denied")
+)
+
+// This handler authenticates interactively using the OAuth device
+// authorization grant. When a token is needed, it writes a verification URL
+// and code to the configured prompt, and waits for the user to approve the
+// request in a browser. Tokens are cached locally in ~/.rai/tokens.json, so
+// the user is only prompted again once the token expires, and not even then
+// if the server issued a refresh token, eg when the "offline_access" scope
+// is requested.
+type DeviceCodeHandler struct {
+	client      *Client
+	cfg         *DeviceCodeConfig
+	mu          sync.Mutex // held for the duration of the flow
+	accessToken *AccessToken
+	unit        time.Duration // unit of the intervals returned by the service
+}
+
+func NewDeviceCodeHandler(c *Client, cfg *DeviceCodeConfig) *DeviceCodeHandler {
+	return &DeviceCodeHandler{client: c, cfg: cfg, unit: time.Second}
+}
+
+func (h *DeviceCodeHandler) GetAccessToken() (string, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.accessToken != nil && !h.accessToken.IsExpired() {
+		return h.accessToken.Token, nil
+	}
+	accessToken, err := readAccessToken(h.cfg.ClientID)
+	if err == nil && accessToken != nil {
+		if !accessToken.IsExpired() {
+			h.accessToken = accessToken
+			return accessToken.Token, nil
+		}
+		if h.accessToken == nil {
+			h.accessToken = accessToken
+		}
+	}
+
+	// renew the expired token if possible, and only prompt the user if not
+	accessToken = nil
+	if h.accessToken != nil && h.accessToken.RefreshToken != "" {
+		accessToken, _ = h.client.RefreshAccessToken(h.tokenUrl(), h.cfg.ClientID, h.accessToken)
+	}
+	if accessToken == nil {
+		if accessToken, err = h.authorize(); err != nil {
+			return "", err
+		}
+	}
+	h.accessToken = accessToken
+	writeAccessToken(h.cfg.ClientID, accessToken)
 	return accessToken.Token, nil
 }
+
+func (h *DeviceCodeHandler) tokenUrl() string {
+	if h.cfg.TokenUrl != "" {
+		return h.cfg.TokenUrl
+	}
+	return defaultClientCredentialsUrl
+}
+
+// Post the given form to the given URL.
+func (h *DeviceCodeHandler) postForm(target string, form url.Values) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodPost, target, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	h.client.ensureHeaders(req, nil)
+	return h.client.Do(req)
+}
+
+// Run the device authorization flow, returning the resulting access token.
+func (h *DeviceCodeHandler) authorize() (*AccessToken, error) {
+	authUrl := h.cfg.DeviceAuthorizationUrl
+	if authUrl == "" {
+		authUrl = defaultDeviceAuthorizationUrl
+	}
+	tokenUrl := h.tokenUrl()
+	audience := h.cfg.Audience
+	if audience == "" {
+		audience = fmt.Sprintf("https://%s", h.client.Host)
+	}
+	prompt := h.cfg.Prompt
+	if prompt == nil {
+		prompt = os.Stderr
+	}
+
+	form := url.Values{"client_id": {h.cfg.ClientID}, "audience": {audience}}
+	if h.cfg.Scope != "" {
+		form.Set("scope", h.cfg.Scope)
+	}
+	rsp, err := h.postForm(authUrl, form)
+	if err != nil {
+		return nil, err
+	}
+	var code deviceCodeResponse
+	err = json.NewDecoder(rsp.Body).Decode(&code)
+	rsp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	if code.VerificationUriComplete != "" {
+		fmt.Fprintf(prompt, "To authenticate, visit %s and confirm the code %s\n",
+			code.VerificationUriComplete, code.UserCode)
+	} else {
+		fmt.Fprintf(prompt, "To authenticate, visit %s and enter the code %s\n",
+			code.VerificationUri, code.UserCode)
+	}
+
+	interval := 5 * h.unit
+	if code.Interval > 0 {
+		interval = time.Duration(code.Interval) * h.unit
+	}
+	var deadline time.Time
+	if code.ExpiresIn > 0 {
+		deadline = time.Now().Add(time.Duration(code.ExpiresIn) * h.unit)
+	}
+	form = url.Values{
+		"grant_type":  {"urn:ietf:params:oauth:grant-type:device_code"},
+		"device_code": {code.DeviceCode},
+		"client_id":   {h.cfg.ClientID}}
+	for {
+		if err := h.client.sleep(h.client.Context(), interval); err != nil {
+			return nil, err
+		}
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			return nil, ErrDeviceCodeExpired
+		}
+		rsp, err := h.postForm(tokenUrl, form)
+		if err == nil {
+			defer rsp.Body.Close()
+			token := &AccessToken{}
+			if err := token.Load(rsp.Body); err != nil {
+				return nil, err
+			}
+			return token, nil
+		}
+		var e HTTPError
+		if !errors.As(err, &e) {
+			return nil, err
+		}
+		var body struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal([]byte(e.Body), &body) != nil {
+			return nil, err
+		}
+		switch body.Error {
+		case "authorization_pending":
+		case "slow_down":
+			interval += 5 * h.unit
+		case "expired_token":
+			return nil, ErrDeviceCodeExpired
+		case "access_denied":
+			return nil, ErrAccessDenied
+		default:
+			return nil, err
+		}
+	}
+}
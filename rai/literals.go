@@ -0,0 +1,186 @@
+// Copyright 2022 RelationalAI, Inc.
+
+package rai
+
+// Support for rendering Go values as Rel literals, and for checking relation
+// names, for use when generating Rel source.
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+)
+
+var relationNameRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+var ErrInvalidRelationName = errors.New("invalid relation name")
+
+// Returns an error matching ErrInvalidRelationName if the given name cannot
+// be used as is in generated Rel, eg in `def insert[:name]`. Names are
+// checked rather than quoted, because base relations whose names are not
+// identifiers cannot be referenced by name from Rel source.
+func checkRelationName(name string) error {
+	if !relationNameRe.MatchString(name) {
+		return errors.Wrapf(ErrInvalidRelationName, "'%s'", name)
+	}
+	return nil
+}
+
+// Write the escaped form of the given character to b, where `quote` is the
+// delimiter of the enclosing literal.
+func writeEscaped(b *strings.Builder, r rune, quote rune) {
+	switch r {
+	case '\\':
+		b.WriteString(`\\`)
+	case quote:
+		b.WriteRune('\\')
+		b.WriteRune(r)
+	case '%': // string interpolation
+		b.WriteString(`\%`)
+	case '\n':
+		b.WriteString(`\n`)
+	case '\r':
+		b.WriteString(`\r`)
+	case '\t':
+		b.WriteString(`\t`)
+	default:
+		if unicode.IsControl(r) {
+			fmt.Fprintf(b, `\u%04x`, r)
+		} else {
+			b.WriteRune(r)
+		}
+	}
+}
+
+func relStringLiteral(s string) string {
+	var b strings.Builder
+	b.WriteRune('"')
+	for _, r := range s {
+		writeEscaped(&b, r, '"')
+	}
+	b.WriteRune('"')
+	return b.String()
+}
+
+func relCharLiteral(r rune) string {
+	var b strings.Builder
+	b.WriteRune('\'')
+	if r == '%' {
+		b.WriteRune(r) // no interpolation in char literals
+	} else {
+		writeEscaped(&b, r, '\'')
+	}
+	b.WriteRune('\'')
+	return b.String()
+}
+
+func relFloatLiteral(v float64, bits int) (string, error) {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return "", errors.Errorf("float value %v has no Rel literal", v)
+	}
+	s := strconv.FormatFloat(v, 'g', -1, bits)
+	if !strings.ContainsAny(s, ".e") {
+		s += ".0" // otherwise read as an integer
+	}
+	return s, nil
+}
+
+// Returns the Rel DateTime literal for the given time, eg
+// 2021-10-12T01:22:31+10:00, keeping the time's UTC offset. DateTimes have
+// millisecond precision, so any smaller fraction of a second is truncated.
+func RelDateTimeLiteral(t time.Time) string {
+	if t.Nanosecond()/1e6 != 0 {
+		return t.Format("2006-01-02T15:04:05.000Z07:00")
+	}
+	return t.Format(time.RFC3339)
+}
+
+// Returns the Rel Date literal for the calendar date of the given time in the
+// time's location, eg 2021-10-12.
+func RelDateLiteral(t time.Time) string {
+	return t.Format("2006-01-02")
+}
+
+// The range of Rel Int128 values.
+var (
+	maxInt128 = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 127), big.NewInt(1))
+	minInt128 = new(big.Int).Neg(new(big.Int).Lsh(big.NewInt(1), 127))
+)
+
+// Returns the Rel literal for the given value, escaping strings and chars so
+// that the literal is safe to embed in generated Rel source. Int and int64
+// values are rendered as plain integer literals and float64 values as plain
+// float literals, while other widths use the type constructor, eg
+// int[8, 42], uint[32, 42] or float[32, 0.5]. A *big.Int is rendered as an
+// Int128 and must be in its range. Runes are rendered as Char literals, times
+// as DateTime literals, Date values as Date literals and decimals using
+// parse_decimal.
+//
+// An int32 is a rune in Go, so RelLiteral(int32(42)) is the Char literal
+// '*', convert the value to int to get an integer literal.
+func RelLiteral(v any) (string, error) {
+	switch vv := v.(type) {
+	case string:
+		return relStringLiteral(vv), nil
+	case rune:
+		return relCharLiteral(vv), nil
+	case bool:
+		if vv {
+			return "boolean_true", nil
+		}
+		return "boolean_false", nil
+	case int:
+		return strconv.Itoa(vv), nil
+	case int64:
+		return strconv.FormatInt(vv, 10), nil
+	case int8:
+		return fmt.Sprintf("int[8, %d]", vv), nil
+	case int16:
+		return fmt.Sprintf("int[16, %d]", vv), nil
+	case uint:
+		return fmt.Sprintf("uint[64, %d]", vv), nil
+	case uint64:
+		return fmt.Sprintf("uint[64, %d]", vv), nil
+	case uint32:
+		return fmt.Sprintf("uint[32, %d]", vv), nil
+	case uint16:
+		return fmt.Sprintf("uint[16, %d]", vv), nil
+	case uint8:
+		return fmt.Sprintf("uint[8, %d]", vv), nil
+	case *big.Int:
+		if vv == nil {
+			return "", errors.New("nil *big.Int has no Rel literal")
+		}
+		if vv.Cmp(minInt128) < 0 || vv.Cmp(maxInt128) > 0 {
+			return "", errors.Errorf("big.Int value %s is out of the Int128 range", vv)
+		}
+		return fmt.Sprintf("int[128, %s]", vv.String()), nil
+	case float64:
+		return relFloatLiteral(vv, 64)
+	case float32:
+		s, err := relFloatLiteral(float64(vv), 32)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("float[32, %s]", s), nil
+	case time.Time:
+		return RelDateTimeLiteral(vv), nil
+	case Date:
+		return RelDateLiteral(vv.Time), nil
+	case decimal.Decimal:
+		digits := -vv.Exponent()
+		if digits < 0 {
+			digits = 0
+		}
+		return fmt.Sprintf("parse_decimal[64, %d, \"%s\"]", digits, vv.StringFixed(digits)), nil
+	}
+	return "", errors.Errorf("no Rel literal for value of type '%T'", v)
+}
@@ -40,11 +40,7 @@ func fatalError(err error) {
 }
 
 func isErrNotFound(err error) bool {
-	e, ok := err.(HTTPError)
-	if !ok {
-		return false
-	}
-	return e.StatusCode == http.StatusNotFound
+	return errors.Is(err, ErrNotFound)
 }
 
 // Ensure that the test engine exists.
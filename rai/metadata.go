@@ -133,6 +133,7 @@ var (
 
 	// Composite types
 	AnyListType     = typeOf[[]any]()
+	BoolListType    = typeOf[[]bool]()
 	Float32ListType = typeOf[[]float32]()
 	Float64ListType = typeOf[[]float64]()
 	Int8ListType    = typeOf[[]int8]()
@@ -155,6 +156,53 @@ var (
 	MixedType    = typeOf[Mixed]()
 )
 
+// TypeWildcard matches any of a set of types when used in a signature
+// prefix, eg to select relations regardless of the width of a numeric
+// column:
+//
+//	rsp.Relations("output", rai.AnyInteger)
+type TypeWildcard struct {
+	name  string
+	types []reflect.Type
+}
+
+func newTypeWildcard(name string, types ...[]reflect.Type) *TypeWildcard {
+	w := &TypeWildcard{name: name}
+	for _, ts := range types {
+		w.types = append(w.types, ts...)
+	}
+	return w
+}
+
+// Answers if the given signature element is one of the wildcard's types.
+func (w *TypeWildcard) Match(t any) bool {
+	for _, wt := range w.types {
+		if t == wt {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *TypeWildcard) String() string {
+	return w.name
+}
+
+var (
+	integerTypeList = []reflect.Type{
+		Int8Type, Int16Type, Int32Type, Int64Type, Int128Type,
+		Uint8Type, Uint16Type, Uint32Type, Uint64Type, Uint128Type, BigIntType}
+	floatTypeList = []reflect.Type{Float16Type, Float32Type, Float64Type}
+)
+
+// Signature prefix wildcards matching families of numeric types.
+var (
+	AnyInteger = newTypeWildcard("AnyInteger", integerTypeList)
+	AnyFloat   = newTypeWildcard("AnyFloat", floatTypeList)
+	AnyNumeric = newTypeWildcard(
+		"AnyNumeric", integerTypeList, floatTypeList, []reflect.Type{DecimalType, RationalType})
+)
+
 // Returns the native type corresponding to the given Rel primitive type code.
 func asNativePrimitiveType(p pb.PrimitiveType) reflect.Type {
 	switch p {
@@ -371,3 +419,15 @@ func (m TransactionMetadata) Signature(id string) Signature {
 func (m TransactionMetadata) Signatures() map[string]Signature {
 	return m.sigMap
 }
+
+// Returns a mapping from relation `id` to metadata signature for the
+// relations whose leading symbol is the given name, eg "output".
+func (m TransactionMetadata) SignaturesByName(name string) map[string]Signature {
+	result := map[string]Signature{}
+	for id, sig := range m.sigMap {
+		if matchPrefix(sig, name) {
+			result[id] = sig
+		}
+	}
+	return result
+}
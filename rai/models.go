@@ -15,6 +15,7 @@
 package rai
 
 import (
+	"io"
 	"time"
 
 	"github.com/apache/arrow/go/v7/arrow"
@@ -44,20 +45,47 @@ type EDB struct {
 }
 
 type Engine struct {
-	ID          string `json:"id"`
-	Name        string `json:"name"`
-	Region      string `json:"region"`
-	AccountName string `json:"account_name"`
-	CreatedBy   string `json:"created_by"`
-	CreatedOn   string `json:"created_on,omitempty"` // todo: required?
-	DeletedOn   string `json:"deleted_on,omitempty"`
-	Size        string `json:"size"`
-	State       string `json:"state"`
+	ID          string            `json:"id"`
+	Name        string            `json:"name"`
+	Region      string            `json:"region"`
+	AccountName string            `json:"account_name"`
+	CreatedBy   string            `json:"created_by"`
+	CreatedOn   string            `json:"created_on,omitempty"` // todo: required?
+	DeletedOn   string            `json:"deleted_on,omitempty"`
+	Size        string            `json:"size"`
+	State       string            `json:"state"`
+	StateReason string            `json:"state_reason,omitempty"` // eg, why provisioning failed
+	Tags        map[string]string `json:"tags,omitempty"`
+	Version     string            `json:"version,omitempty"` // RAI version the engine runs
 }
 
 type Model struct {
 	Name  string `json:"name"`
 	Value string `json:"value"`
+	Hash  string `json:"hash,omitempty"` // see ModelHash, computed on decode
+	Size  int    `json:"size,omitempty"` // length of Value in bytes
+}
+
+// NamedModel is a named model to load.
+type NamedModel struct {
+	Name   string
+	Reader io.Reader
+}
+
+// DeleteModelsResult reports which of the requested models were deleted and
+// which did not exist.
+type DeleteModelsResult struct {
+	Deleted  []string
+	NotFound []string
+	Result   *TransactionResult // nil if there was nothing to delete
+}
+
+// DatabaseOverview combines a database with its installed models and base
+// relations.
+type DatabaseOverview struct {
+	Database Database
+	Models   []Model
+	EDBs     []EDB
 }
 
 type OAuthClient struct {
@@ -66,6 +94,7 @@ type OAuthClient struct {
 	AccountName string    `json:"account_name"`
 	CreatedBy   string    `json:"created_by"`
 	CreatedOn   time.Time `json:"created_on"`
+	ETag        string    `json:"-"` // set by GetOAuthClient
 }
 
 type OAuthClientExtra struct {
@@ -81,6 +110,7 @@ type User struct {
 	IDProviers  []string `json:"id_providers"`
 	Roles       []string `json:"roles"`
 	Status      string   `json:"status"`
+	ETag        string   `json:"-"` // set by GetUser
 }
 
 //
@@ -156,22 +186,26 @@ type Transaction struct {
 	ID                    string           `json:"id"`
 	AccountName           string           `json:"account_name,omitempty"`
 	Database              string           `json:"database_name,omitempty"`
+	Engine                string           `json:"engine_name,omitempty"`
 	Query                 string           `json:"query,omitempty"`
 	State                 TransactionState `json:"state"`
 	AbortReason           string           `json:"abort_reason,omitempty"`
 	ReadOnly              bool             `json:"read_only,omitempty"`
 	CreatedBy             string           `json:"created_by,omitempty"`
-	CreatedOn             int64            `json:"created_on,omitempty"`
-	FinishedAt            int64            `json:"finished_at,omitempty"`
+	CreatedOn             int64            `json:"created_on,omitempty"`  // epoch millis
+	FinishedAt            int64            `json:"finished_at,omitempty"` // epoch millis
+	Duration              int64            `json:"duration,omitempty"`    // millis
 	LastRequestedInterval int64            `json:"last_requested_interval,omitempty"`
 }
 
 type TransactionRequest struct {
+	Region   string   `json:"region,omitempty"`
 	Database string   `json:"dbname"`
 	Engine   string   `json:"engine_name"`
 	Query    string   `json:"query"`
 	ReadOnly bool     `json:"readonly"`
 	Inputs   []any    `json:"v1_inputs"`
+	Persist  []string `json:"persist,omitempty"`
 	Tags     []string `json:"tags"`
 }
 
@@ -202,6 +236,7 @@ type TransactionResponse struct {
 	Metadata    *TransactionMetadata
 	Partitions  map[string]*Partition
 	Problems    []Problem // todo: move to relational rep
+	RolledBack  bool      // executed with Abort, so nothing was persisted
 	relations   RelationCollection
 }
 
@@ -218,10 +253,34 @@ type createDatabaseResponse struct {
 	Database Database `json:"database"`
 }
 
+type getAccessTokenRequest struct {
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	Audience     string `json:"audience"`
+	Scope        string `json:"scope,omitempty"`
+	GrantType    string `json:"grant_type"`
+}
+
+type refreshAccessTokenRequest struct {
+	ClientID     string `json:"client_id"`
+	RefreshToken string `json:"refresh_token"`
+	GrantType    string `json:"grant_type"`
+}
+
+type deviceCodeResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationUri         string `json:"verification_uri"`
+	VerificationUriComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int    `json:"expires_in"` // seconds
+	Interval                int    `json:"interval"`   // seconds
+}
+
 type createEngineRequest struct {
-	Name   string `json:"name"`
-	Size   string `json:"size"`
-	Region string `json:"region"` // todo: isnt region part of the context?
+	Name   string            `json:"name"`
+	Size   string            `json:"size"`
+	Region string            `json:"region"` // todo: isnt region part of the context?
+	Tags   map[string]string `json:"tags,omitempty"`
 }
 
 type createEngineResponse struct {
@@ -306,6 +365,16 @@ type listEDBsResponse struct {
 	} `json:"actions"`
 }
 
+type describeDatabaseResponse struct {
+	Actions []struct {
+		Name   string `json:"name"`
+		Result struct {
+			Models []Model `json:"sources"`
+			Rels   []EDB   `json:"rels"`
+		} `json:"result"`
+	} `json:"actions"`
+}
+
 type listEnginesResponse struct {
 	Engines []Engine `json:"computes"`
 }
@@ -356,6 +425,7 @@ type Integration struct {
 	Snowflake  struct {
 		Account string `json:"account"`
 	} `json:"snowflake"`
+	ETag string `json:"-"` // set by GetSnowflakeIntegration
 }
 
 type SnowflakeCredentials struct {
@@ -0,0 +1,135 @@
+// Copyright 2022 RelationalAI, Inc.
+
+package rai
+
+// Support for generating Rel queries for common relational operations.
+
+// Queries are built against relations in the form produced by `LoadCSV`,
+// where each tuple has the form (:column, row, value). For example:
+//
+//     NewQuery("people").Where("age", ">", 21).Select("name", "age").Build()
+//
+// generates:
+//
+//     def _query_rows(row) = people(:age, row, w1) and w1 > 21
+//     def output(x1, x2) = _query_rows(row) and people(:name, row, x1) and people(:age, row, x2)
+//
+// The generated source can be passed to `Execute`, or combined with other Rel.
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var queryOperators = map[string]string{
+	"=":  "=",
+	"==": "=",
+	"!=": "!=",
+	"<":  "<",
+	"<=": "<=",
+	">":  ">",
+	">=": ">=",
+}
+
+type queryFilter struct {
+	column string
+	op     string
+	value  any
+}
+
+// QueryBuilder generates Rel source that selects rows of a relation.
+type QueryBuilder struct {
+	relation string
+	filters  []queryFilter
+	columns  []string
+	limit    int
+}
+
+// Returns a query builder that selects the rows of the given relation.
+func NewQuery(relation string) *QueryBuilder {
+	return &QueryBuilder{relation: relation}
+}
+
+// Restrict the query to rows where the value of the given column compares to
+// the given value using op, which is one of =, !=, <, <=, > or >=. Multiple
+// filters are combined with `and`.
+func (q *QueryBuilder) Where(column, op string, value any) *QueryBuilder {
+	q.filters = append(q.filters, queryFilter{column, op, value})
+	return q
+}
+
+// Project the query result onto the given columns, in the given order. If no
+// columns are selected, the result has the same (:column, row, value) form
+// as the queried relation. Note that projected results are sets, so rows
+// with equal values for the selected columns are returned once.
+func (q *QueryBuilder) Select(columns ...string) *QueryBuilder {
+	q.columns = append(q.columns, columns...)
+	return q
+}
+
+// Restrict the query to at most n rows, taken in row order.
+func (q *QueryBuilder) Limit(n int) *QueryBuilder {
+	q.limit = n
+	return q
+}
+
+// Returns the Rel source for the query, which defines `output`.
+func (q *QueryBuilder) Build() (string, error) {
+	if err := checkRelationName(q.relation); err != nil {
+		return "", err
+	}
+	if q.limit < 0 {
+		return "", errors.Errorf("invalid query limit %d", q.limit)
+	}
+	var b strings.Builder
+
+	// rows matching the filters
+	terms := []string{}
+	for i, f := range q.filters {
+		if err := checkRelationName(f.column); err != nil {
+			return "", err
+		}
+		op, ok := queryOperators[f.op]
+		if !ok {
+			return "", errors.Errorf("unknown query operator '%s'", f.op)
+		}
+		value, err := RelLiteral(f.value)
+		if err != nil {
+			return "", err
+		}
+		v := fmt.Sprintf("w%d", i+1)
+		terms = append(terms,
+			fmt.Sprintf("%s(:%s, row, %s)", q.relation, f.column, v),
+			fmt.Sprintf("%s %s %s", v, op, value))
+	}
+	if len(terms) == 0 {
+		terms = append(terms, fmt.Sprintf("%s(_, row, _)", q.relation))
+	}
+	rows := "_query_rows"
+	fmt.Fprintf(&b, "def %s(row) = %s\n", rows, strings.Join(terms, " and "))
+	if q.limit > 0 {
+		fmt.Fprintf(&b, "def _query_limit(row) = top[%d, %s](_, row)\n", q.limit, rows)
+		rows = "_query_limit"
+	}
+
+	// projection of the selected rows
+	if len(q.columns) == 0 {
+		fmt.Fprintf(&b, "def output(col, row, v) = %s(row) and %s(col, row, v)",
+			rows, q.relation)
+		return b.String(), nil
+	}
+	vars := make([]string, len(q.columns))
+	terms = []string{rows + "(row)"}
+	for i, col := range q.columns {
+		if err := checkRelationName(col); err != nil {
+			return "", err
+		}
+		vars[i] = fmt.Sprintf("x%d", i+1)
+		terms = append(terms, fmt.Sprintf("%s(:%s, row, %s)", q.relation, col, vars[i]))
+	}
+	fmt.Fprintf(&b, "def output(%s) = %s",
+		strings.Join(vars, ", "), strings.Join(terms, " and "))
+	return b.String(), nil
+}
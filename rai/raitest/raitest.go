@@ -0,0 +1,173 @@
+// Copyright 2022 RelationalAI, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package raitest provides utilities for testing code that uses the rai
+// client, without access to a live RAI endpoint.
+package raitest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"net/url"
+
+	"github.com/apache/arrow/go/v7/arrow"
+	"github.com/apache/arrow/go/v7/arrow/ipc"
+	"github.com/relationalai/rai-sdk-go/rai"
+	"github.com/relationalai/rai-sdk-go/rai/pb"
+	"google.golang.org/protobuf/proto"
+)
+
+// Returns a client that sends all requests to a test server that serves
+// them with the given handler. The caller is responsible for closing the
+// server.
+func NewTestClient(handler http.Handler) (*rai.Client, *httptest.Server) {
+	server := httptest.NewServer(handler)
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		panic(err) // test server URLs are well formed
+	}
+	opts := &rai.ClientOptions{AccessTokenHandler: rai.NewNopAccessTokenHandler()}
+	opts.Scheme, opts.Host, opts.Port = u.Scheme, u.Hostname(), u.Port()
+	return rai.NewClient(context.Background(), opts), server
+}
+
+//
+// Metadata
+//
+
+// Returns the metadata type of the given primitive type.
+func Primitive(t pb.PrimitiveType) *pb.RelType {
+	return &pb.RelType{Tag: pb.Kind_PRIMITIVE_TYPE, PrimitiveType: t}
+}
+
+// Returns the metadata type of the given symbol, eg `Symbol("output")` for
+// the relation name :output.
+func Symbol(name string) *pb.RelType {
+	return &pb.RelType{
+		Tag: pb.Kind_CONSTANT_TYPE,
+		ConstantType: &pb.ConstantType{
+			RelType: Primitive(pb.PrimitiveType_STRING),
+			Value: &pb.RelTuple{Arguments: []*pb.PrimitiveValue{{
+				Tag:   pb.PrimitiveType_STRING,
+				Value: &pb.PrimitiveValue_StringVal{StringVal: []byte(name)}}}}}}
+}
+
+//
+// Transaction responses
+//
+
+// Relation is one relation of a fake transaction response. The record holds
+// the data of the non-constant columns of the signature, in order.
+type Relation struct {
+	ID        string // eg "0.arrow"
+	Signature []*pb.RelType
+	Record    arrow.Record
+}
+
+// TransactionResponse describes the contents of a fake transaction response.
+type TransactionResponse struct {
+	Transaction rai.Transaction
+	Problems    []rai.Problem
+	Relations   []Relation
+}
+
+// Returns the protobuf metadata describing the response's relations.
+func (rsp *TransactionResponse) Metadata() *pb.MetadataInfo {
+	info := &pb.MetadataInfo{}
+	for _, r := range rsp.Relations {
+		info.Relations = append(info.Relations, &pb.RelationMetadata{
+			RelationId: &pb.RelationId{Arguments: r.Signature},
+			FileName:   r.ID})
+	}
+	return info
+}
+
+func createPart(w *multipart.Writer, name, filename, ctype string) (io.Writer, error) {
+	h := textproto.MIMEHeader{}
+	disposition := fmt.Sprintf("form-data; name=%q", name)
+	if filename != "" {
+		disposition += fmt.Sprintf("; filename=%q", filename)
+	}
+	h.Set("Content-Disposition", disposition)
+	h.Set("Content-Type", ctype)
+	return w.CreatePart(h)
+}
+
+// Writes the given response as a multipart transaction response, in the
+// form returned for transactions that complete on the fast path.
+func WriteTransactionResponse(w http.ResponseWriter, rsp *TransactionResponse) error {
+	mw := multipart.NewWriter(w)
+	w.Header().Set("Content-Type", mw.FormDataContentType())
+	w.WriteHeader(http.StatusOK)
+
+	part, err := mw.CreateFormField("transaction")
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(part).Encode(rsp.Transaction); err != nil {
+		return err
+	}
+
+	problems := rsp.Problems
+	if problems == nil {
+		problems = []rai.Problem{}
+	}
+	part, err = mw.CreateFormField("problems")
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(part).Encode(problems); err != nil {
+		return err
+	}
+
+	data, err := proto.Marshal(rsp.Metadata())
+	if err != nil {
+		return err
+	}
+	part, err = mw.CreateFormField("metadata.proto")
+	if err != nil {
+		return err
+	}
+	if _, err := part.Write(data); err != nil {
+		return err
+	}
+
+	for _, r := range rsp.Relations {
+		part, err := createPart(mw, r.ID, r.ID, "application/vnd.apache.arrow.stream")
+		if err != nil {
+			return err
+		}
+		iw := ipc.NewWriter(part, ipc.WithSchema(r.Record.Schema()))
+		if err := iw.Write(r.Record); err != nil {
+			_ = iw.Close()
+			return err
+		}
+		if err := iw.Close(); err != nil {
+			return err
+		}
+	}
+	return mw.Close()
+}
+
+// Writes the given v1 transaction result as a JSON response.
+func WriteTransactionResult(w http.ResponseWriter, rsp *rai.TransactionResult) error {
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(rsp)
+}
@@ -0,0 +1,126 @@
+// Copyright 2022 RelationalAI, Inc.
+
+package raitest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/apache/arrow/go/v7/arrow"
+	"github.com/apache/arrow/go/v7/arrow/array"
+	"github.com/apache/arrow/go/v7/arrow/memory"
+	"github.com/pkg/errors"
+	"github.com/relationalai/rai-sdk-go/rai"
+	"github.com/relationalai/rai-sdk-go/rai/pb"
+	"github.com/stretchr/testify/assert"
+)
+
+// Returns a fake response with a single output relation.
+func newOutputResponse() *TransactionResponse {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "v1", Type: arrow.PrimitiveTypes.Int64}}, nil)
+	b := array.NewRecordBuilder(memory.NewGoAllocator(), schema)
+	defer b.Release()
+	b.Field(0).(*array.Int64Builder).AppendValues([]int64{1, 2}, nil)
+	rec := b.NewRecord()
+
+	return &TransactionResponse{
+		Transaction: rai.Transaction{ID: "tx", State: rai.Completed},
+		Relations: []Relation{{
+			ID:        "0.arrow",
+			Signature: []*pb.RelType{Symbol("output"), Primitive(pb.PrimitiveType_INT_64)},
+			Record:    rec}}}
+}
+
+func TestFakeTransactionResponse(t *testing.T) {
+	rsp := newOutputResponse()
+	client, server := NewTestClient(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, rai.PathTransactions, r.URL.Path)
+		assert.Nil(t, WriteTransactionResponse(w, rsp))
+	}))
+	defer server.Close()
+
+	result, err := client.Execute("db", "engine", "def output = {1; 2}", nil, true)
+	assert.Nil(t, err)
+	assert.Equal(t, "tx", result.Transaction.ID)
+	assert.Equal(t, []rai.Problem{}, result.Problems)
+	rel := result.Relation("0.arrow")
+	assert.Equal(t, rai.Signature{"output", rai.Int64Type}, rel.Signature())
+	assert.Equal(t, []any{"output", int64(2)}, rel.Row(1))
+}
+
+func TestRecordReplay(t *testing.T) {
+	dir := t.TempDir()
+	rsp := newOutputResponse()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Nil(t, WriteTransactionResponse(w, rsp))
+	}))
+	defer server.Close()
+
+	newClient := func(rawurl string, transport http.RoundTripper) *rai.Client {
+		u, err := url.Parse(rawurl)
+		assert.Nil(t, err)
+		opts := &rai.ClientOptions{HTTPClient: &http.Client{Transport: transport}}
+		opts.Scheme, opts.Host, opts.Port = u.Scheme, u.Hostname(), u.Port()
+		return rai.NewClient(context.Background(), opts)
+	}
+
+	const query = "def output = {1; 2}"
+	client := newClient(server.URL, NewRecorder(dir, nil))
+	_, err := client.Execute("db", "engine", query, nil, true)
+	assert.Nil(t, err)
+
+	// replay without the server
+	client = newClient("http://localhost:1", NewReplayer(dir))
+	result, err := client.Execute("db", "engine", query, nil, true)
+	assert.Nil(t, err)
+	assert.Equal(t, []any{"output", int64(2)}, result.Relation("0.arrow").Row(1))
+
+	_, err = client.Execute("db", "engine", "def output = 3", nil, true)
+	assert.True(t, errors.Is(err, ErrNoFixture))
+}
+
+func TestRecordRedactsTokens(t *testing.T) {
+	dir := t.TempDir()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Set-Cookie", "session=secret-cookie")
+		fmt.Fprint(w, `{"access_token": "secret-access", "refresh_token": "secret-refresh",`+
+			` "expires_in": 3600, "token_type": "Bearer"}`)
+	}))
+	defer server.Close()
+
+	req, err := http.NewRequest(http.MethodPost, server.URL+"/oauth2/token",
+		strings.NewReader(`{"client_secret": "secret-client"}`))
+	assert.Nil(t, err)
+	rsp, err := NewRecorder(dir, nil).RoundTrip(req)
+	assert.Nil(t, err)
+	body, err := io.ReadAll(rsp.Body)
+	assert.Nil(t, err)
+	assert.Contains(t, string(body), "secret-access") // the caller sees the real response
+
+	files, err := os.ReadDir(dir)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(files))
+	data, err := os.ReadFile(filepath.Join(dir, files[0].Name()))
+	assert.Nil(t, err)
+	assert.NotContains(t, string(data), "secret")
+	fixtures, err := readFixtures(filepath.Join(dir, files[0].Name()))
+	assert.Nil(t, err)
+	var token map[string]any
+	assert.Nil(t, json.Unmarshal(fixtures[0].Body, &token))
+	assert.Equal(t, RedactedValue, token["access_token"])
+	assert.Equal(t, RedactedValue, token["refresh_token"])
+	assert.Equal(t, float64(3600), token["expires_in"])
+
+	// non-JSON bodies are recorded as is
+	assert.Equal(t, []byte("plain"), redactBody([]byte("plain")))
+}
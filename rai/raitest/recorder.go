@@ -0,0 +1,224 @@
+// Copyright 2022 RelationalAI, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package raitest
+
+// Transports that record HTTP interactions to fixture files, and replay them
+// later without access to the original endpoint. Fixtures are keyed by the
+// request's method, path, query and a hash of its body, and each fixture
+// file holds the sequence of responses seen for that key, so that repeated
+// requests, eg polling a transaction, replay in order.
+//
+// Use with a client by setting ClientOptions.HTTPClient, eg:
+//
+//     opts.HTTPClient = &http.Client{Transport: raitest.NewRecorder(dir, nil)}
+//
+// Fixtures are meant to be committed, so credentials are not recorded: the
+// values of token fields in JSON responses, eg from the OAuth token endpoint,
+// are replaced with RedactedValue, and authorization and cookie headers are
+// dropped. Request bodies are only recorded as part of the fixture hash.
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+type fixture struct {
+	Method     string      `json:"method"`
+	URL        string      `json:"url"`
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header"`
+	Body       []byte      `json:"body"`
+}
+
+// The value recorded in place of credentials in response bodies.
+const RedactedValue = "REDACTED"
+
+// Names of the JSON response fields whose values are redacted.
+var redactedFields = []string{"access_token", "refresh_token", "id_token", "client_secret"}
+
+// Returns the given response body with the values of any token fields
+// redacted. Bodies that are not JSON objects are returned unchanged.
+func redactBody(data []byte) []byte {
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return data
+	}
+	redacted := false
+	for _, name := range redactedFields {
+		if _, ok := obj[name]; ok {
+			obj[name] = json.RawMessage(`"` + RedactedValue + `"`)
+			redacted = true
+		}
+	}
+	if !redacted {
+		return data
+	}
+	result, err := json.Marshal(obj)
+	if err != nil {
+		return data
+	}
+	return result
+}
+
+// Reads the request body, restoring it so that the request can still be sent.
+func readRequestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil {
+		return nil, nil
+	}
+	data, err := io.ReadAll(req.Body)
+	if err != nil {
+		return nil, err
+	}
+	_ = req.Body.Close()
+	req.Body = io.NopCloser(bytes.NewReader(data))
+	return data, nil
+}
+
+// Returns the fixture file name for the given request.
+func fixtureName(req *http.Request, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(req.Method + " " + req.URL.Path + "?" + req.URL.RawQuery + "\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil)) + ".json"
+}
+
+func readFixtures(path string) ([]fixture, error) {
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, err
+	}
+	var result []fixture
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Recorder is an http.RoundTripper that sends requests using the underlying
+// transport and records each request and response to a fixture file.
+type Recorder struct {
+	mu        sync.Mutex
+	dir       string
+	transport http.RoundTripper
+	fixtures  map[string][]fixture // file name => recorded responses
+}
+
+// Returns a recorder that writes fixtures to the given directory, using the
+// given transport, or http.DefaultTransport if nil, to send requests.
+func NewRecorder(dir string, transport http.RoundTripper) *Recorder {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	return &Recorder{dir: dir, transport: transport, fixtures: map[string][]fixture{}}
+}
+
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+	rsp, err := r.transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(rsp.Body)
+	_ = rsp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	rsp.Body = io.NopCloser(bytes.NewReader(data))
+
+	header := rsp.Header.Clone()
+	header.Del("Set-Cookie")
+	header.Del("Authorization")
+	f := fixture{req.Method, req.URL.String(), rsp.StatusCode, header, redactBody(data)}
+	if err := r.save(fixtureName(req, body), f); err != nil {
+		return nil, err
+	}
+	return rsp, nil
+}
+
+// Append the given fixture to those recorded for the named file, and write
+// the file.
+func (r *Recorder) save(name string, f fixture) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.fixtures[name] = append(r.fixtures[name], f)
+	data, err := json.MarshalIndent(r.fixtures[name], "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(r.dir, 0o750); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(r.dir, name), data, 0o600)
+}
+
+// ErrNoFixture is returned by a Replayer for requests that were not recorded.
+var ErrNoFixture = errors.New("no recorded fixture for request")
+
+// Replayer is an http.RoundTripper that serves responses from the fixture
+// files written by a Recorder. Responses recorded for the same request are
+// served in order, and the last one is repeated once they are exhausted.
+type Replayer struct {
+	mu   sync.Mutex
+	dir  string
+	seen map[string]int // file name => number of responses served
+}
+
+// Returns a replayer that serves the fixtures in the given directory.
+func NewReplayer(dir string) *Replayer {
+	return &Replayer{dir: dir, seen: map[string]int{}}
+}
+
+func (r *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+	name := fixtureName(req, body)
+	fixtures, err := readFixtures(filepath.Join(r.dir, name))
+	if err != nil || len(fixtures) == 0 {
+		return nil, errors.Wrapf(ErrNoFixture, "%s %s", req.Method, req.URL.String())
+	}
+	r.mu.Lock()
+	n := r.seen[name]
+	r.seen[name] = n + 1
+	r.mu.Unlock()
+	if n >= len(fixtures) {
+		n = len(fixtures) - 1
+	}
+	f := fixtures[n]
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", f.StatusCode, http.StatusText(f.StatusCode)),
+		StatusCode:    f.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        f.Header,
+		Body:          io.NopCloser(bytes.NewReader(f.Body)),
+		ContentLength: int64(len(f.Body)),
+		Request:       req}, nil
+}
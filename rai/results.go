@@ -31,9 +31,14 @@ package rai
 // relations.
 
 import (
+	"bytes"
 	"fmt"
+	"io"
+	"math"
 	"math/big"
+	"math/rand"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -41,6 +46,9 @@ import (
 	"github.com/apache/arrow/go/v7/arrow"
 	"github.com/apache/arrow/go/v7/arrow/array"
 	"github.com/apache/arrow/go/v7/arrow/float16"
+	"github.com/apache/arrow/go/v7/arrow/ipc"
+	"github.com/apache/arrow/go/v7/arrow/memory"
+	"github.com/pkg/errors"
 	"github.com/shopspring/decimal"
 )
 
@@ -114,7 +122,146 @@ type TabularSlice interface {
 type Relation interface {
 	Tabular
 	Showable
+	DecodeValueTypes(int) ([]any, error)
+	RowMap(int) map[string]any
+	Schema() []ColumnSchema
+	IsEmpty() bool
+	Cast(int, reflect.Type, func(any) (any, error)) (Relation, error)
+	Nullify(...string) Relation
+	WithComputedColumn(string, reflect.Type, func([]any) any) (Relation, error)
+	Rename(int, string) (Relation, error)
+	Sample(int, int64) Relation
 	Slice(int, ...int) Relation
+	WriteJSONL(io.Writer, *JSONLWriteOptions) error
+}
+
+// Calls `fn` with the row number and value of each row in the given column.
+// Go interfaces cannot provide default method implementations, so iteration
+// is provided by functions that work with any column.
+func ForEach(c Column, fn func(rnum int, v any)) {
+	nrows := c.NumRows()
+	for rnum := 0; rnum < nrows; rnum++ {
+		fn(rnum, c.Value(rnum))
+	}
+}
+
+// Calls `fn` with the row number and typed item of each row in the given
+// column, avoiding the boxing of values returned by `Value`.
+func ForEachTyped[T any](c DataColumn[T], fn func(rnum int, v T)) {
+	nrows := c.NumRows()
+	for rnum := 0; rnum < nrows; rnum++ {
+		fn(rnum, c.Item(rnum))
+	}
+}
+
+// Calls `fn` with the row number and row values of each row of the given
+// tabular, stopping when fn returns false. The row slice is reused between
+// calls, so fn must copy it to retain the values.
+func ForEachRow(t Tabular, fn func(rnum int, row []any) bool) {
+	nrows := t.NumRows()
+	row := make([]any, t.NumCols())
+	for rnum := 0; rnum < nrows; rnum++ {
+		t.GetRow(rnum, row)
+		if !fn(rnum, row) {
+			return
+		}
+	}
+}
+
+// Returns the given column as a DataColumn of the given item type, if it is
+// one.
+func AsDataColumn[T any](c Column) (DataColumn[T], bool) {
+	dc, ok := c.(DataColumn[T])
+	return dc, ok
+}
+
+// Returns the given column of the tabular as a DataColumn of the given item
+// type, or false if there is no such column or it has a different item type.
+func GetDataColumn[T any](t Tabular, cnum int) (DataColumn[T], bool) {
+	if cnum < 0 || cnum >= t.NumCols() {
+		return nil, false
+	}
+	return AsDataColumn[T](t.Column(cnum))
+}
+
+// Typed column accessors, eg:
+//
+//     if c, ok := rai.GetInt64Column(rel, 1); ok {
+//         n := c.Item(0)
+//     }
+
+func GetBoolColumn(t Tabular, cnum int) (DataColumn[bool], bool) {
+	return GetDataColumn[bool](t, cnum)
+}
+
+func GetCharColumn(t Tabular, cnum int) (DataColumn[rune], bool) {
+	return GetDataColumn[rune](t, cnum)
+}
+
+func GetFloat16Column(t Tabular, cnum int) (DataColumn[float16.Num], bool) {
+	return GetDataColumn[float16.Num](t, cnum)
+}
+
+func GetFloat32Column(t Tabular, cnum int) (DataColumn[float32], bool) {
+	return GetDataColumn[float32](t, cnum)
+}
+
+func GetFloat64Column(t Tabular, cnum int) (DataColumn[float64], bool) {
+	return GetDataColumn[float64](t, cnum)
+}
+
+func GetInt8Column(t Tabular, cnum int) (DataColumn[int8], bool) {
+	return GetDataColumn[int8](t, cnum)
+}
+
+func GetInt16Column(t Tabular, cnum int) (DataColumn[int16], bool) {
+	return GetDataColumn[int16](t, cnum)
+}
+
+func GetInt32Column(t Tabular, cnum int) (DataColumn[int32], bool) {
+	return GetDataColumn[int32](t, cnum)
+}
+
+func GetInt64Column(t Tabular, cnum int) (DataColumn[int64], bool) {
+	return GetDataColumn[int64](t, cnum)
+}
+
+func GetUint8Column(t Tabular, cnum int) (DataColumn[uint8], bool) {
+	return GetDataColumn[uint8](t, cnum)
+}
+
+func GetUint16Column(t Tabular, cnum int) (DataColumn[uint16], bool) {
+	return GetDataColumn[uint16](t, cnum)
+}
+
+func GetUint32Column(t Tabular, cnum int) (DataColumn[uint32], bool) {
+	return GetDataColumn[uint32](t, cnum)
+}
+
+func GetUint64Column(t Tabular, cnum int) (DataColumn[uint64], bool) {
+	return GetDataColumn[uint64](t, cnum)
+}
+
+func GetStringColumn(t Tabular, cnum int) (DataColumn[string], bool) {
+	return GetDataColumn[string](t, cnum)
+}
+
+// Returns Int128, UInt128 and Hash columns.
+func GetBigIntColumn(t Tabular, cnum int) (DataColumn[*big.Int], bool) {
+	return GetDataColumn[*big.Int](t, cnum)
+}
+
+func GetDecimalColumn(t Tabular, cnum int) (DataColumn[decimal.Decimal], bool) {
+	return GetDataColumn[decimal.Decimal](t, cnum)
+}
+
+func GetRationalColumn(t Tabular, cnum int) (DataColumn[*big.Rat], bool) {
+	return GetDataColumn[*big.Rat](t, cnum)
+}
+
+// Returns Date and DateTime columns.
+func GetTimeColumn(t Tabular, cnum int) (DataColumn[time.Time], bool) {
+	return GetDataColumn[time.Time](t, cnum)
 }
 
 func asString(v any) string {
@@ -242,6 +389,13 @@ func newFloat64Column(data []float64) SimpleColumn[float64] {
 	return primitiveColumn[float64]{data}
 }
 
+// StringColumn is a column of strings that can also return all of its
+// values at once.
+type StringColumn interface {
+	SimpleColumn[string]
+	AllStrings() []string
+}
+
 // Sadly, the `array.String“ type does not have a `Values` accessor.
 type stringColumn struct {
 	data *array.String
@@ -251,6 +405,25 @@ func newStringColumn(data *array.String) SimpleColumn[string] {
 	return stringColumn{data}
 }
 
+// Returns the values of the column. The column's string data is copied once,
+// and the values are substrings of the copy, indexed by the arrow offsets,
+// which avoids the per row overhead of `Item` for large columns. Unlike the
+// values returned by `Item`, they remain valid after the partition's arrow
+// data is released.
+func (c stringColumn) AllStrings() []string {
+	offsets := c.data.ValueOffsets()
+	result := make([]string, c.data.Len())
+	if len(result) == 0 {
+		return result
+	}
+	data := string(c.data.ValueBytes())
+	base := offsets[0]
+	for i := range result {
+		result[i] = data[offsets[i]-base : offsets[i+1]-base]
+	}
+	return result
+}
+
 func (c stringColumn) GetItem(rnum int, out *string) {
 	*out = c.data.Value(rnum)
 }
@@ -368,6 +541,15 @@ func (c listColumn[T]) Value(rnum int) any {
 	return c.Item(rnum)
 }
 
+// Note, `array.Boolean` is bit packed, so the values are unpacked on load.
+func newBoolListColumn(c *array.Boolean, ncols int) TabularColumn[bool] {
+	data := make([]bool, c.Len())
+	for i := range data {
+		data[i] = c.Value(i)
+	}
+	return listColumn[bool]{data, ncols, nil}
+}
+
 func newFloat64ListColumn(v []float64, ncols int) TabularColumn[float64] {
 	return listColumn[float64]{v, ncols, nil}
 }
@@ -398,6 +580,8 @@ func newListColumn(c *array.FixedSizeList) Column {
 	nvals := col.Len()
 	ncols := nvals / nrows
 	switch cc := col.(type) {
+	case *array.Boolean:
+		return newBoolListColumn(cc, ncols)
 	case *array.Float64:
 		return newFloat64ListColumn(cc.Float64Values(), ncols)
 	case *array.Int8:
@@ -417,6 +601,61 @@ func newListColumn(c *array.FixedSizeList) Column {
 	return newUnknownColumn(nrows)
 }
 
+// Represents a column of variable length lists, eg set valued columns, where
+// each value is the slice of the underlying values between a pair of offsets.
+type varListColumn struct {
+	offsets []int32
+	offset  int // offset of the first row in `offsets`
+	nrows   int
+	values  Column
+}
+
+func newVarListColumn(c *array.List) DataColumn[[]any] {
+	values := c.ListValues()
+	col := newPartitionColumn(values, values.Len())
+	return varListColumn{c.Offsets(), c.Data().Offset(), c.Len(), col}
+}
+
+func (c varListColumn) GetItem(rnum int, out []any) {
+	lo := int(c.offsets[c.offset+rnum])
+	for i := range out {
+		out[i] = c.values.Value(lo + i)
+	}
+}
+
+func (c varListColumn) Item(rnum int) []any {
+	result := make([]any, c.Len(rnum))
+	c.GetItem(rnum, result)
+	return result
+}
+
+// Returns the length of the list at the given row.
+func (c varListColumn) Len(rnum int) int {
+	return int(c.offsets[c.offset+rnum+1] - c.offsets[c.offset+rnum])
+}
+
+func (c varListColumn) NumRows() int {
+	return c.nrows
+}
+
+func (c varListColumn) String(rnum int) string {
+	lo := int(c.offsets[c.offset+rnum])
+	n := c.Len(rnum)
+	items := make([]string, n)
+	for i := 0; i < n; i++ {
+		items[i] = asString(c.values.Value(lo + i))
+	}
+	return "(" + strings.Join(items, ", ") + ")"
+}
+
+func (c varListColumn) Type() any {
+	return AnyListType
+}
+
+func (c varListColumn) Value(rnum int) any {
+	return c.Item(rnum)
+}
+
 // Represents one sub-column of a `listColumn`
 type listItemColumn[T any] struct {
 	data  []T
@@ -651,8 +890,12 @@ func columnType(c arrow.Array) reflect.Type {
 		return Uint32Type
 	case *array.Uint64:
 		return Uint64Type
+	case *array.Decimal128:
+		return DecimalType
 	case *array.FixedSizeList:
 		switch cc.ListValues().(type) {
+		case *array.Boolean:
+			return BoolListType
 		case *array.Float32:
 			return Float32ListType
 		case *array.Float64:
@@ -672,6 +915,8 @@ func columnType(c arrow.Array) reflect.Type {
 		default:
 			return UnknownType
 		}
+	case *array.List:
+		return AnyListType
 	default:
 		// case *array.Struct:
 		return reflect.TypeOf(c).Elem()
@@ -689,6 +934,45 @@ func (p *Partition) init() *Partition {
 	return p
 }
 
+// Returns a single record with the rows of all the given records, which must
+// share a schema. The result is a new reference that the caller owns.
+func concatRecords(records []arrow.Record) (arrow.Record, error) {
+	if len(records) == 1 {
+		records[0].Retain()
+		return records[0], nil
+	}
+	schema := records[0].Schema()
+	mem := memory.NewGoAllocator()
+	ncols := int(records[0].NumCols())
+	cols := make([]arrow.Array, ncols)
+	defer func() {
+		for _, col := range cols {
+			if col != nil {
+				col.Release()
+			}
+		}
+	}()
+	var nrows int64
+	for _, record := range records {
+		if !record.Schema().Equal(schema) {
+			return nil, errors.New("partition records have different schemas")
+		}
+		nrows += record.NumRows()
+	}
+	for cnum := 0; cnum < ncols; cnum++ {
+		chunks := make([]arrow.Array, len(records))
+		for i, record := range records {
+			chunks[i] = record.Column(cnum)
+		}
+		col, err := array.Concatenate(chunks, mem)
+		if err != nil {
+			return nil, err
+		}
+		cols[cnum] = col
+	}
+	return array.NewRecord(schema, cols, nrows), nil
+}
+
 // Partition is the physical representation of relation data. Partitions may
 // be shared by relations in the case where they only differ by constant values
 // in the relation signature.
@@ -756,6 +1040,20 @@ func (p *Partition) Record() arrow.Record {
 	return p.record
 }
 
+// Returns the partition's arrow record encoded as an arrow IPC stream.
+func (p *Partition) ArrowIPC() ([]byte, error) {
+	var b bytes.Buffer
+	w := ipc.NewWriter(&b, ipc.WithSchema(p.record.Schema()))
+	if err := w.Write(p.record); err != nil {
+		_ = w.Close()
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
 func (p *Partition) String(rnum int) string {
 	return "(" + strings.Join(p.Strings(rnum), ", ") + ")"
 }
@@ -797,8 +1095,12 @@ func newPartitionColumn(a arrow.Array, nrows int) Column {
 		return newPrimitiveColumn(aa.Uint32Values())
 	case *array.Uint64:
 		return newPrimitiveColumn(aa.Uint64Values())
+	case *array.Decimal128:
+		return newArrowDecimalColumn(aa)
 	case *array.FixedSizeList:
 		return newListColumn(aa)
+	case *array.List:
+		return newVarListColumn(aa)
 	case *array.Struct:
 		return newStructColumn(aa)
 	}
@@ -839,6 +1141,10 @@ func (c charColumn) Type() any {
 	return RuneType
 }
 
+func (c charColumn) relType() any {
+	return CharType
+}
+
 func (c charColumn) Value(rnum int) any {
 	return rune(c.col.Item(rnum))
 }
@@ -872,6 +1178,10 @@ func (c dateColumn) Type() any {
 	return TimeType
 }
 
+func (c dateColumn) relType() any {
+	return ValueType{"rel", "base", "Date", Int64Type}
+}
+
 func (c dateColumn) Value(rnum int) any {
 	return c.Item(rnum)
 }
@@ -905,10 +1215,62 @@ func (c dateTimeColumn) Type() any {
 	return TimeType
 }
 
+func (c dateTimeColumn) relType() any {
+	return ValueType{"rel", "base", "DateTime", Int64Type}
+}
+
 func (c dateTimeColumn) Value(rnum int) any {
 	return c.Item(rnum)
 }
 
+// DecimalColumn is a column of fixed point decimal values that also provides
+// the precision and scale of the underlying FixedDecimal type.
+type DecimalColumn interface {
+	SimpleColumn[decimal.Decimal]
+	Precision() int32
+	Scale() int32
+}
+
+// DecimalFormat selects how decimal values are written by
+// `WriteRelationCSV` and `WriteJSONL`.
+type DecimalFormat int32
+
+const (
+	// Render decimals without trailing fractional zeros, eg 12.3
+	DecimalShortest DecimalFormat = iota
+	// Render decimals with the number of fractional digits of their column's
+	// scale, eg 12.30, as is usual for monetary values
+	DecimalFixed
+)
+
+// Returns the given decimal formatted according to the given DecimalFormat.
+// Decimal column values carry their column's scale as their exponent, so the
+// scale is recovered from the value.
+func formatDecimal(d decimal.Decimal, f DecimalFormat) string {
+	if f == DecimalFixed && d.Exponent() < 0 {
+		return d.StringFixed(-d.Exponent())
+	}
+	return d.String()
+}
+
+// Returns the maximum number of decimal digits that can be represented by a
+// signed integer of the given bit width.
+func decimalPrecision(bits int) int32 {
+	switch bits {
+	case 8:
+		return 2
+	case 16:
+		return 4
+	case 32:
+		return 9
+	case 64:
+		return 18
+	case 128:
+		return 38
+	}
+	return 0
+}
+
 // decimalColumn projects the underlying pair of values as a decimal.
 type decimalColumn[T int8 | int16 | int32 | int64] struct {
 	col    DataColumn[T]
@@ -919,15 +1281,40 @@ func (c decimalColumn[T]) NumRows() int {
 	return c.col.NumRows()
 }
 
+// Returns the number of decimal digits that can be represented by the
+// column's underlying integer type.
+func (c decimalColumn[T]) Precision() int32 {
+	var v T
+	switch any(v).(type) {
+	case int8:
+		return decimalPrecision(8)
+	case int16:
+		return decimalPrecision(16)
+	case int32:
+		return decimalPrecision(32)
+	}
+	return decimalPrecision(64)
+}
+
+// Returns the number of digits to the right of the decimal point.
+func (c decimalColumn[T]) Scale() int32 {
+	return -c.digits
+}
+
 func (c decimalColumn[T]) Type() any {
 	return DecimalType
 }
 
+func (c decimalColumn[T]) relType() any {
+	bits := int64(typeOf[T]().Bits())
+	return ValueType{"rel", "base", "FixedDecimal", bits, int64(c.Scale()), typeOf[T]()}
+}
+
 type decimal8Column struct {
 	decimalColumn[int8]
 }
 
-func newDecimal8Column(col DataColumn[int8], digits int32) SimpleColumn[decimal.Decimal] {
+func newDecimal8Column(col DataColumn[int8], digits int32) DecimalColumn {
 	return decimal8Column{decimalColumn[int8]{col, digits}}
 }
 
@@ -951,7 +1338,7 @@ type decimal16Column struct {
 	decimalColumn[int16]
 }
 
-func newDecimal16Column(col DataColumn[int16], digits int32) SimpleColumn[decimal.Decimal] {
+func newDecimal16Column(col DataColumn[int16], digits int32) DecimalColumn {
 	return decimal16Column{decimalColumn[int16]{col, digits}}
 }
 
@@ -976,7 +1363,7 @@ type decimal32Column struct {
 	decimalColumn[int32]
 }
 
-func newDecimal32Column(col DataColumn[int32], digits int32) SimpleColumn[decimal.Decimal] {
+func newDecimal32Column(col DataColumn[int32], digits int32) DecimalColumn {
 	return decimal32Column{decimalColumn[int32]{col, digits}}
 }
 
@@ -1001,7 +1388,7 @@ type decimal64Column struct {
 	decimalColumn[int64]
 }
 
-func newDecimal64Column(col DataColumn[int64], digits int32) SimpleColumn[decimal.Decimal] {
+func newDecimal64Column(col DataColumn[int64], digits int32) DecimalColumn {
 	return decimal64Column{decimalColumn[int64]{col, digits}}
 }
 
@@ -1027,7 +1414,7 @@ type decimal128Column struct {
 	digits int32
 }
 
-func newDecimal128Column(col TabularColumn[uint64], digits int32) SimpleColumn[decimal.Decimal] {
+func newDecimal128Column(col TabularColumn[uint64], digits int32) DecimalColumn {
 	return decimal128Column{col, digits}
 }
 
@@ -1045,6 +1432,14 @@ func (c decimal128Column) NumRows() int {
 	return c.col.NumRows()
 }
 
+func (c decimal128Column) Precision() int32 {
+	return decimalPrecision(128)
+}
+
+func (c decimal128Column) Scale() int32 {
+	return -c.digits
+}
+
 func (c decimal128Column) String(rnum int) string {
 	return c.Item(rnum).String()
 }
@@ -1053,11 +1448,63 @@ func (c decimal128Column) Type() any {
 	return DecimalType
 }
 
+func (c decimal128Column) relType() any {
+	return ValueType{"rel", "base", "FixedDecimal", int64(128), int64(c.Scale()), Int128Type}
+}
+
 func (c decimal128Column) Value(rnum int) any {
 	return c.Item(rnum)
 }
 
+// arrowDecimalColumn projects the values of a native arrow decimal array,
+// whose scale is given by the array's data type.
+type arrowDecimalColumn struct {
+	data   *array.Decimal128
+	digits int32
+}
+
+func newArrowDecimalColumn(data *array.Decimal128) DecimalColumn {
+	dt := data.DataType().(*arrow.Decimal128Type)
+	return arrowDecimalColumn{data, -dt.Scale}
+}
+
+func (c arrowDecimalColumn) GetItem(rnum int, out *decimal.Decimal) {
+	*out = c.Item(rnum)
+}
+
+func (c arrowDecimalColumn) Item(rnum int) decimal.Decimal {
+	v := c.data.Value(rnum)
+	return NewDecimal128(v.LowBits(), uint64(v.HighBits()), c.digits)
+}
+
+func (c arrowDecimalColumn) NumRows() int {
+	return c.data.Len()
+}
+
+func (c arrowDecimalColumn) Precision() int32 {
+	return c.data.DataType().(*arrow.Decimal128Type).Precision
+}
+
+func (c arrowDecimalColumn) Scale() int32 {
+	return -c.digits
+}
+
+func (c arrowDecimalColumn) String(rnum int) string {
+	return c.Item(rnum).String()
+}
+
+func (c arrowDecimalColumn) Type() any {
+	return DecimalType
+}
+
+func (c arrowDecimalColumn) Value(rnum int) any {
+	return c.Item(rnum)
+}
+
 func newDecimalColumn(vt ValueType, c Column) Column {
+	if dc, ok := c.(DecimalColumn); ok {
+		return dc // native arrow decimal, already scaled
+	}
 	digits := -int32(vt[4].(int64))
 	switch vt[3].(int64) {
 	case 8:
@@ -1079,10 +1526,29 @@ type int128Column struct {
 	col TabularColumn[uint64]
 }
 
-func newInt128Column(c TabularColumn[uint64]) SimpleColumn[*big.Int] {
+// Int128Column is a column of 128 bit signed integers, which are returned as
+// big.Int values, that can also return values as int64 when they fit.
+type Int128Column interface {
+	SimpleColumn[*big.Int]
+	Int64(int) (int64, bool)
+}
+
+func newInt128Column(c TabularColumn[uint64]) Int128Column {
 	return int128Column{c}
 }
 
+// Returns the value of the given row as an int64, and false if the value
+// does not fit, without allocating a big.Int.
+func (c int128Column) Int64(rnum int) (int64, bool) {
+	var v [2]uint64
+	c.col.GetItem(rnum, v[:])
+	lo, hi := v[0], v[1]
+	if (hi == 0 && int64(lo) >= 0) || (hi == math.MaxUint64 && int64(lo) < 0) {
+		return int64(lo), true
+	}
+	return 0, false
+}
+
 func (c int128Column) GetItem(rnum int, out **big.Int) {
 	*out = c.Item(rnum)
 }
@@ -1105,6 +1571,10 @@ func (c int128Column) Type() any {
 	return BigIntType
 }
 
+func (c int128Column) relType() any {
+	return Int128Type
+}
+
 func (c int128Column) Value(rnum int) any {
 	return c.Item(rnum)
 }
@@ -1114,10 +1584,28 @@ type uint128Column struct {
 	col TabularColumn[uint64]
 }
 
-func newUint128Column(c TabularColumn[uint64]) SimpleColumn[*big.Int] {
+// Uint128Column is a column of 128 bit unsigned integers, which are returned
+// as big.Int values, that can also return values as uint64 when they fit.
+type Uint128Column interface {
+	SimpleColumn[*big.Int]
+	Uint64(int) (uint64, bool)
+}
+
+func newUint128Column(c TabularColumn[uint64]) Uint128Column {
 	return uint128Column{c}
 }
 
+// Returns the value of the given row as a uint64, and false if the value
+// does not fit, without allocating a big.Int.
+func (c uint128Column) Uint64(rnum int) (uint64, bool) {
+	var v [2]uint64
+	c.col.GetItem(rnum, v[:])
+	if v[1] != 0 {
+		return 0, false
+	}
+	return v[0], true
+}
+
 func (c uint128Column) GetItem(rnum int, out **big.Int) {
 	*out = c.Item(rnum)
 }
@@ -1140,6 +1628,10 @@ func (c uint128Column) Type() any {
 	return BigIntType
 }
 
+func (c uint128Column) relType() any {
+	return Uint128Type
+}
+
 func (c uint128Column) Value(rnum int) any {
 	return c.Item(rnum)
 }
@@ -1150,10 +1642,16 @@ func (c uint128Column) Value(rnum int) any {
 type literalColumn[T any] struct {
 	value T
 	nrows int
+	t     ConstType // builtin const type of the value, if any
 }
 
 func newLiteralColumn[T any](v T, nrows int) Column {
-	return literalColumn[T]{v, nrows}
+	return literalColumn[T]{v, nrows, nil}
+}
+
+// Returns a literalColumn of the given value of the given builtin const type.
+func newBuiltinLiteralColumn[T any](v T, t ConstType, nrows int) Column {
+	return literalColumn[T]{v, nrows, t}
 }
 
 func (c literalColumn[T]) GetItem(rnum int, out *T) {
@@ -1176,6 +1674,13 @@ func (c literalColumn[T]) Type() any {
 	return c.value
 }
 
+func (c literalColumn[T]) relType() any {
+	if c.t != nil {
+		return c.t
+	}
+	return c.value
+}
+
 func (c literalColumn[T]) Value(_ int) any {
 	return c.value
 }
@@ -1193,6 +1698,11 @@ func (c rationalColumn[T]) Type() any {
 	return RationalType
 }
 
+func (c rationalColumn[T]) relType() any {
+	bits := int64(typeOf[T]().Bits())
+	return ValueType{"rel", "base", "Rational", bits, typeOf[T](), typeOf[T]()}
+}
+
 type rational8Column struct {
 	rationalColumn[int8]
 }
@@ -1332,6 +1842,10 @@ func (c rational128Column) Type() any {
 	return RationalType
 }
 
+func (c rational128Column) relType() any {
+	return ValueType{"rel", "base", "Rational", int64(128), Int128Type, Int128Type}
+}
+
 func (c rational128Column) Value(rnum int) any {
 	return c.Item(rnum)
 }
@@ -1444,7 +1958,7 @@ func newConstDecimalColumn(ct ConstType, nrows int) Column {
 	default:
 		return newUnknownColumn(nrows)
 	}
-	return newLiteralColumn(newConstDecimalValue(ct), nrows)
+	return newBuiltinLiteralColumn(newConstDecimalValue(ct), ct, nrows)
 }
 
 // ["rel", "base", "Decimal", <bits>, <num>, <denom>]
@@ -1476,7 +1990,7 @@ func newConstRationalColumn(ct ConstType, nrows int) Column {
 	default:
 		return newUnknownColumn(nrows)
 	}
-	return newLiteralColumn(newConstRationalValue(ct), nrows)
+	return newBuiltinLiteralColumn(newConstRationalValue(ct), ct, nrows)
 }
 
 type constColumn struct {
@@ -1489,26 +2003,26 @@ func newConstColumn(t ConstType, nrows int) Column {
 	if matchPrefix(t, "rel", "base", "_") {
 		switch t[2].(string) {
 		case "AutoNumber":
-			return newLiteralColumn(t[3].(uint64), nrows)
+			return newBuiltinLiteralColumn(t[3].(uint64), t, nrows)
 		case "Date":
 			d := DateFromRataDie(t[3].(int64))
-			return newLiteralColumn(d, nrows)
+			return newBuiltinLiteralColumn(d, t, nrows)
 		case "DateTime":
 			d := DateFromRataMillis(t[3].(int64))
-			return newLiteralColumn(d, nrows)
+			return newBuiltinLiteralColumn(d, t, nrows)
 		case "FilePos":
-			return newLiteralColumn(t[3].(int64), nrows)
+			return newBuiltinLiteralColumn(t[3].(int64), t, nrows)
 		case "FixedDecimal":
 			return newConstDecimalColumn(t, nrows)
 		case "Hash":
-			return newLiteralColumn(t[3].(*big.Int), nrows)
+			return newBuiltinLiteralColumn(t[3].(*big.Int), t, nrows)
 		case "Rational":
 			return newConstRationalColumn(t, nrows)
 		case "Missing":
 			return newMissingColumn(nrows)
 		case "Year", "Month", "Week", "Day", "Hour", "Minute",
 			"Second", "Millisecond", "Microsecond", "Nanosecond":
-			return newLiteralColumn(t[3].(int64), nrows)
+			return newBuiltinLiteralColumn(t[3].(int64), t, nrows)
 		}
 	}
 	cols := make([]Column, len(t))
@@ -1591,6 +2105,10 @@ func (c constColumn) Type() any {
 	return AnyListType
 }
 
+func (c constColumn) relType() any {
+	return ConstType(relTypesOf(c.cols))
+}
+
 func (c constColumn) Value(rnum int) any {
 	return c.Item(rnum)
 }
@@ -1603,29 +2121,56 @@ func newBuiltinValueColumn(vt ValueType, c Column, nrows int) Column {
 	if matchPrefix(vt, "rel", "base", "_") {
 		switch vt[2].(string) {
 		case "AutoNumber":
-			return c // primitiveColumn[uint64]
+			return newBuiltinColumn[uint64](vt, c)
 		case "Date":
 			return newDateColumn(c.(DataColumn[int64]))
 		case "DateTime":
 			return newDateTimeColumn(c.(DataColumn[int64]))
 		case "FilePos":
-			return c // primitiveColumn[int64]
+			return newBuiltinColumn[int64](vt, c)
 		case "FixedDecimal":
 			return newDecimalColumn(vt, c)
 		case "Hash":
-			return newUint128Column(c.(TabularColumn[uint64]))
+			return hashColumn{uint128Column{c.(TabularColumn[uint64])}}
 		case "Rational":
 			return newRationalColumn(c)
 		case "Missing":
 			return newMissingColumn(nrows)
 		case "Year", "Month", "Week", "Day", "Hour", "Minute",
 			"Second", "Millisecond", "Microsecond", "Nanosecond":
-			return c
+			return newBuiltinColumn[int64](vt, c)
 		}
 	}
 	return nil // not a recognized builtin value type
 }
 
+// builtinColumn is a builtin value type column, eg FilePos, whose values
+// are those of the underlying primitive column.
+type builtinColumn[T SimpleTypes] struct {
+	SimpleColumn[T]
+	vt ValueType
+}
+
+func newBuiltinColumn[T SimpleTypes](vt ValueType, c Column) Column {
+	if cc, ok := c.(SimpleColumn[T]); ok {
+		return builtinColumn[T]{cc, vt}
+	}
+	return c
+}
+
+func (c builtinColumn[T]) relType() any {
+	return c.vt
+}
+
+// hashColumn is a column of Hash values, which are 128 bit unsigned integers.
+type hashColumn struct {
+	uint128Column
+}
+
+func (c hashColumn) relType() any {
+	return ValueType{"rel", "base", "Hash", Uint128Type}
+}
+
 // Projects a valueColumn from an underlying simple column.
 func newSimpleValueColumn(vt ValueType, c Column, nrows int) Column {
 	ncols := len(vt)
@@ -1784,6 +2329,10 @@ func (c valueColumn) Type() any {
 	return AnyListType
 }
 
+func (c valueColumn) relType() any {
+	return ValueType(relTypesOf(c.cols))
+}
+
 func (c valueColumn) Value(rnum int) any {
 	return c.Item(rnum)
 }
@@ -1846,6 +2395,12 @@ func newBaseRelation(p *Partition, meta Signature) Relation {
 	return (&baseRelation{part: p, meta: meta}).init()
 }
 
+// Returns a relation whose signature and columns are taken directly from the
+// given partition, for use when the transaction metadata is not available.
+func newRawRelation(p *Partition) Relation {
+	return newDerivedRelation(p.Signature(), p.Columns())
+}
+
 func (r *baseRelation) Metadata() Signature {
 	return r.meta
 }
@@ -1866,6 +2421,15 @@ func (r *baseRelation) NumRows() int {
 	return r.nrows
 }
 
+// Answers if the relation has no rows. A fully specialized relation, eg the
+// result of `def output = :foo`, has no partition data but a single row made
+// up of its constants, so it is not empty. Note that the service does not
+// return relations that have no tuples, eg the result of `def output = {}`,
+// so base relations are only empty if their partition is.
+func (r *baseRelation) IsEmpty() bool {
+	return r.nrows == 0
+}
+
 func (r *baseRelation) String(rnum int) string {
 	return "(" + strings.Join(r.Strings(rnum), ", ") + ")"
 }
@@ -2059,6 +2623,217 @@ func newRelationColumn(t any, col Column, nrows int) Column {
 	}
 }
 
+// Returns a relation whose symbol at the given column is replaced by the
+// given name, eg to rename the leading `output` symbol of a relation before
+// it is exported. Only symbol columns can be renamed.
+func renameColumn(r Relation, cnum int, name string) (Relation, error) {
+	sig := r.Signature()
+	if cnum < 0 || cnum >= len(sig) {
+		return nil, errors.Errorf("column %d out of range", cnum)
+	}
+	if _, ok := sig[cnum].(string); !ok {
+		return nil, errors.Errorf("column %d is not a symbol", cnum)
+	}
+	sig = append(Signature{}, sig...)
+	sig[cnum] = name
+	cols := append([]Column{}, r.Columns()...)
+	cols[cnum] = newSymbolColumn(name, r.NumRows())
+	return newDerivedRelation(sig, cols), nil
+}
+
+// Represents a column whose null rows have a nil value and an empty string.
+type nullColumn struct {
+	col       Column
+	sentinels map[string]bool // string values that are null
+}
+
+func (c nullColumn) isNull(rnum int) bool {
+	switch c.col.(type) {
+	case missingColumn, unknownColumn:
+		return true
+	}
+	s, ok := c.col.Value(rnum).(string)
+	return ok && c.sentinels[s]
+}
+
+func (c nullColumn) NumRows() int {
+	return c.col.NumRows()
+}
+
+func (c nullColumn) String(rnum int) string {
+	if c.isNull(rnum) {
+		return ""
+	}
+	return c.col.String(rnum)
+}
+
+func (c nullColumn) Type() any {
+	return c.col.Type()
+}
+
+func (c nullColumn) Value(rnum int) any {
+	if c.isNull(rnum) {
+		return nil
+	}
+	return c.col.Value(rnum)
+}
+
+// Returns a relation whose missing and unknown values, and the values of its
+// String columns that equal one of the given sentinels, are nil, and render
+// as empty strings. The signature of the relation is unchanged.
+func nullifyRelation(r Relation, sentinels ...string) Relation {
+	set := map[string]bool{}
+	for _, s := range sentinels {
+		set[s] = true
+	}
+	cols := append([]Column{}, r.Columns()...)
+	for cnum, c := range cols {
+		switch c.(type) {
+		case missingColumn, unknownColumn:
+			cols[cnum] = nullColumn{c, set}
+		default:
+			if len(set) > 0 && c.Type() == StringType {
+				cols[cnum] = nullColumn{c, set}
+			}
+		}
+	}
+	return newDerivedRelation(r.Signature(), cols)
+}
+
+// CastError is the value of a row of a column cast by `Cast` when the
+// conversion of its value failed.
+type CastError struct {
+	Row int
+	Err error
+}
+
+func (e CastError) Error() string {
+	return fmt.Sprintf("cast of row %d failed: %s", e.Row, e.Err.Error())
+}
+
+func (e CastError) Unwrap() error {
+	return e.Err
+}
+
+// Represents a column whose values are converted from another column as they
+// are accessed.
+type castColumn struct {
+	col  Column
+	t    reflect.Type
+	conv func(any) (any, error)
+}
+
+func (c castColumn) NumRows() int {
+	return c.col.NumRows()
+}
+
+func (c castColumn) String(rnum int) string {
+	return asString(c.Value(rnum))
+}
+
+func (c castColumn) Type() any {
+	return c.t
+}
+
+func (c castColumn) Value(rnum int) any {
+	v, err := c.conv(c.col.Value(rnum))
+	if err != nil {
+		return CastError{rnum, err}
+	}
+	return v
+}
+
+// Returns a relation whose given column is converted to type t by calling
+// conv with each of its values. Values are converted each time they are
+// accessed, and a value that fails to convert is returned as a CastError,
+// so callers that may see conversion failures should check row values for
+// errors.
+func castRelation(
+	r Relation, cnum int, t reflect.Type, conv func(any) (any, error),
+) (Relation, error) {
+	sig := r.Signature()
+	if cnum < 0 || cnum >= len(sig) {
+		return nil, errors.Errorf("column %d out of range", cnum)
+	}
+	sig = append(Signature{}, sig...)
+	sig[cnum] = t
+	cols := append([]Column{}, r.Columns()...)
+	cols[cnum] = castColumn{cols[cnum], t, conv}
+	return newDerivedRelation(sig, cols), nil
+}
+
+func (r *baseRelation) Cast(
+	cnum int, t reflect.Type, conv func(any) (any, error),
+) (Relation, error) {
+	return castRelation(r, cnum, t, conv)
+}
+
+// Represents a column of values computed by `WithComputedColumn`.
+type computedColumn struct {
+	values []any
+	t      reflect.Type
+}
+
+func (c computedColumn) NumRows() int {
+	return len(c.values)
+}
+
+func (c computedColumn) String(rnum int) string {
+	return asString(c.values[rnum])
+}
+
+func (c computedColumn) Type() any {
+	return c.t
+}
+
+func (c computedColumn) Value(rnum int) any {
+	return c.values[rnum]
+}
+
+// Returns a relation with the columns of the given relation followed by the
+// given name, as a symbol, and a column of type t whose values are computed
+// by calling fn with each row, which is reused between calls. Values are
+// computed once, when the relation is created, and each must be of type t
+// or nil.
+func withComputedColumn(
+	r Relation, name string, t reflect.Type, fn func([]any) any,
+) (Relation, error) {
+	nrows := r.NumRows()
+	values := make([]any, nrows)
+	row := make([]any, r.NumCols())
+	for rnum := 0; rnum < nrows; rnum++ {
+		r.GetRow(rnum, row)
+		v := fn(row)
+		if v != nil && reflect.TypeOf(v) != t {
+			return nil, errors.Errorf(
+				"computed value of type '%T' in row %d, expected '%v'", v, rnum, t)
+		}
+		values[rnum] = v
+	}
+	sig := append(append(Signature{}, r.Signature()...), name, t)
+	cols := append(append([]Column{}, r.Columns()...),
+		newSymbolColumn(name, nrows), computedColumn{values, t})
+	return newDerivedRelation(sig, cols), nil
+}
+
+func (r *baseRelation) WithComputedColumn(
+	name string, t reflect.Type, fn func([]any) any,
+) (Relation, error) {
+	return withComputedColumn(r, name, t, fn)
+}
+
+func (r *baseRelation) Nullify(sentinels ...string) Relation {
+	return nullifyRelation(r, sentinels...)
+}
+
+func (r *baseRelation) Rename(cnum int, name string) (Relation, error) {
+	return renameColumn(r, cnum, name)
+}
+
+func (r *baseRelation) Sample(n int, seed int64) Relation {
+	return sampleRows(r, n, seed)
+}
+
 func (r baseRelation) Slice(lo int, hi ...int) Relation {
 	var c []Column
 	var s Signature
@@ -2205,6 +2980,321 @@ func newUnionRelation(rs []Relation) Relation {
 	return newDerivedRelation(sig, cols)
 }
 
+// Returns a relation that contains the rows of each of the given relations,
+// in order. The relations must have identical signatures, and because they do,
+// the resulting columns retain the type of the corresponding input columns.
+func Concat(rs ...Relation) (Relation, error) {
+	if len(rs) == 0 {
+		return nil, errors.New("no relations to concatenate")
+	}
+	if len(rs) == 1 {
+		return rs[0], nil
+	}
+	sig := rs[0].Signature()
+	for _, r := range rs[1:] {
+		if !reflect.DeepEqual(sig, r.Signature()) {
+			return nil, errors.Errorf(
+				"signature mismatch: %s != %s", sig.String(), r.Signature().String())
+		}
+	}
+	ncols := len(sig)
+	cols := make([]Column, ncols)
+	for cnum := 0; cnum < ncols; cnum++ {
+		cc := make([]Column, len(rs))
+		nrows := 0
+		for i, r := range rs {
+			cc[i] = r.Column(cnum)
+			nrows += cc[i].NumRows()
+		}
+		cols[cnum] = unionColumn{cc, nrows, cc[0].Type()}
+	}
+	return newDerivedRelation(sig, cols), nil
+}
+
+// Represents the selected rows of another column.
+type selectColumn struct {
+	col  Column
+	rows []int
+}
+
+func (c selectColumn) NumRows() int {
+	return len(c.rows)
+}
+
+func (c selectColumn) String(rnum int) string {
+	return c.col.String(c.rows[rnum])
+}
+
+func (c selectColumn) Type() any {
+	return c.col.Type()
+}
+
+func (c selectColumn) Value(rnum int) any {
+	return c.col.Value(c.rows[rnum])
+}
+
+// Returns a relation containing the given rows of the given relation.
+func selectRows(r Relation, rows []int) Relation {
+	cols := make([]Column, r.NumCols())
+	for cnum := range cols {
+		cols[cnum] = selectColumn{r.Column(cnum), rows}
+	}
+	return newDerivedRelation(r.Signature(), cols)
+}
+
+// Returns a relation containing up to n rows of the given relation, chosen at
+// random by reservoir sampling, so that every row is equally likely to be
+// chosen. The same seed always chooses the same rows, and the chosen rows
+// are returned in their original order. The sample is a view of the given
+// relation's columns, which are not copied.
+func sampleRows(r Relation, n int, seed int64) Relation {
+	nrows := r.NumRows()
+	if n < 0 {
+		n = 0
+	}
+	if n > nrows {
+		n = nrows
+	}
+	rows := make([]int, n)
+	for rnum := range rows {
+		rows[rnum] = rnum
+	}
+	rnd := rand.New(rand.NewSource(seed)) // #nosec G404
+	for rnum := n; rnum < nrows; rnum++ {
+		if i := rnd.Intn(rnum + 1); i < n {
+			rows[i] = rnum
+		}
+	}
+	sort.Ints(rows)
+	return selectRows(r, rows)
+}
+
+// Write a canonical representation of the given row value to b. Distinct
+// values of the same type have distinct representations, and each is
+// length prefixed so that the concatenation of several values is
+// unambiguous.
+func writeValueKey(b *strings.Builder, v any) {
+	var s string
+	switch vv := v.(type) {
+	case []any: // value type
+		b.WriteString("[")
+		for _, item := range vv {
+			writeValueKey(b, item)
+		}
+		b.WriteString("]")
+		return
+	case string:
+		s = strconv.Quote(vv)
+	case time.Time:
+		s = strconv.FormatInt(vv.UnixNano(), 10)
+	case *big.Int:
+		s = vv.String()
+	case *big.Rat:
+		s = vv.RatString()
+	case decimal.Decimal:
+		s = vv.String()
+	default:
+		s = fmt.Sprintf("%v", vv)
+	}
+	fmt.Fprintf(b, "%d:%s", len(s), s)
+}
+
+// Returns a key identifying the given row of the relation, such that two
+// rows of relations with the same signature have the same key exactly when
+// their values are equal.
+func rowKey(r Relation, rnum int) string {
+	var b strings.Builder
+	for _, v := range r.Row(rnum) {
+		writeValueKey(&b, v)
+	}
+	return b.String()
+}
+
+// Compares two versions of a relation, returning the rows of `new` that are
+// not in `old` and the rows of `old` that are not in `new`. The relations
+// must have identical signatures. Rows are compared by value, using the key
+// computed by `rowKey`, and the result collections are empty if no rows were
+// added or removed, and otherwise contain a single relation with the same
+// signature as the inputs.
+func RelationDiff(old, new Relation) (added, removed RelationCollection, err error) {
+	if !reflect.DeepEqual(old.Signature(), new.Signature()) {
+		return nil, nil, errors.Errorf(
+			"signature mismatch: %s != %s", old.Signature().String(), new.Signature().String())
+	}
+	// Returns the rows of a that are not in b.
+	diff := func(a, b Relation) RelationCollection {
+		keys := map[string]struct{}{}
+		for rnum := 0; rnum < b.NumRows(); rnum++ {
+			keys[rowKey(b, rnum)] = struct{}{}
+		}
+		var rows []int
+		for rnum := 0; rnum < a.NumRows(); rnum++ {
+			if _, ok := keys[rowKey(a, rnum)]; !ok {
+				rows = append(rows, rnum)
+			}
+		}
+		if len(rows) == 0 {
+			return RelationCollection{}
+		}
+		return RelationCollection{selectRows(a, rows)}
+	}
+	return diff(new, old), diff(old, new), nil
+}
+
+// Returns the value of the given float or exact fractional value as a
+// big.Rat, and whether it has one. Floats are converted exactly, and NaN or
+// infinite floats have no big.Rat value.
+func approxRat(v any) (*big.Rat, bool) {
+	switch vv := v.(type) {
+	case float64:
+		if math.IsNaN(vv) || math.IsInf(vv, 0) {
+			return nil, false
+		}
+		return new(big.Rat).SetFloat64(vv), true
+	case float32:
+		return approxRat(float64(vv))
+	case float16.Num:
+		return approxRat(float64(vv.Float32()))
+	case decimal.Decimal:
+		return vv.Rat(), true
+	case *big.Rat:
+		return vv, true
+	}
+	return nil, false
+}
+
+// Answers if the given values are equal within the given tolerance, see
+// `RelationsApproxEqual`.
+func approxEqual(a, b any, tol *big.Rat) bool {
+	if av, ok := a.([]any); ok { // value type
+		bv, ok := b.([]any)
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for i := range av {
+			if !approxEqual(av[i], bv[i], tol) {
+				return false
+			}
+		}
+		return true
+	}
+	if reflect.TypeOf(a) != reflect.TypeOf(b) {
+		return false
+	}
+	if ar, ok := approxRat(a); ok {
+		br, ok := approxRat(b)
+		if !ok {
+			return false
+		}
+		d := new(big.Rat).Sub(ar, br)
+		return d.Abs(d).Cmp(tol) <= 0
+	}
+	switch av := a.(type) {
+	case float64, float32, float16.Num:
+		// NaN and infinite values only equal themselves
+		return fmt.Sprint(a) == fmt.Sprint(b)
+	case *big.Int:
+		return av.Cmp(b.(*big.Int)) == 0
+	case time.Time:
+		return av.Equal(b.(time.Time))
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// Answers if the given relations have the same signature and the same rows,
+// in the same order, where float values are equal if they differ by at most
+// epsilon, and all other values must be exactly equal. Decimal and rational
+// values are also compared within epsilon, with the difference computed
+// exactly as a big.Rat. Values must have the same type to be equal, so a
+// float never equals a decimal, and in mixed columns each pair of values is
+// compared according to their type. Values of value types are compared
+// element by element. NaN values equal each other, as do infinite values of
+// the same sign, so that relations compare equal to themselves.
+func RelationsApproxEqual(a, b Relation, epsilon float64) bool {
+	if !reflect.DeepEqual(a.Signature(), b.Signature()) || a.NumRows() != b.NumRows() {
+		return false
+	}
+	tol := new(big.Rat).SetFloat64(math.Abs(epsilon))
+	if tol == nil {
+		return false // epsilon is NaN or infinite
+	}
+	for rnum := 0; rnum < a.NumRows(); rnum++ {
+		arow, brow := a.Row(rnum), b.Row(rnum)
+		for i := range arow {
+			if !approxEqual(arow[i], brow[i], tol) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Returns the equi-join of the given relations on the given key columns,
+// whose rows are the left row followed by the right row for each pair of
+// rows with equal key values, omitting the right key column, which is a
+// duplicate of the left key column. Key values are compared by value, and
+// the key columns must have the same type. Rows are in left row order, and
+// rows matching the same left row are in right row order.
+//
+// The right relation is hashed, so its keys are held in memory while the
+// join is computed, and the result refers to the rows of both relations
+// rather than copying their values.
+func Join(left, right Relation, leftCol, rightCol int) (Relation, error) {
+	return join(left, right, leftCol, rightCol, false)
+}
+
+// Returns the equi-join of the given relations as `Join` does, but keeping
+// the right key column, so that the result has all of the columns of both
+// relations.
+func JoinKeepKeys(left, right Relation, leftCol, rightCol int) (Relation, error) {
+	return join(left, right, leftCol, rightCol, true)
+}
+
+func join(left, right Relation, leftCol, rightCol int, keepKeys bool) (Relation, error) {
+	if leftCol < 0 || leftCol >= left.NumCols() {
+		return nil, errors.Errorf("join column %d out of range", leftCol)
+	}
+	if rightCol < 0 || rightCol >= right.NumCols() {
+		return nil, errors.Errorf("join column %d out of range", rightCol)
+	}
+	lkey, rkey := left.Column(leftCol), right.Column(rightCol)
+	if !reflect.DeepEqual(lkey.Type(), rkey.Type()) {
+		return nil, errors.Errorf(
+			"join column type mismatch: %s != %s", asTypeString(lkey.Type()), asTypeString(rkey.Type()))
+	}
+	keyOf := func(c Column, rnum int) string {
+		var b strings.Builder
+		writeValueKey(&b, c.Value(rnum))
+		return b.String()
+	}
+	index := map[string][]int{}
+	for rnum := 0; rnum < rkey.NumRows(); rnum++ {
+		k := keyOf(rkey, rnum)
+		index[k] = append(index[k], rnum)
+	}
+	var lrows, rrows []int
+	for rnum := 0; rnum < lkey.NumRows(); rnum++ {
+		for _, match := range index[keyOf(lkey, rnum)] {
+			lrows = append(lrows, rnum)
+			rrows = append(rrows, match)
+		}
+	}
+	sig := append(Signature{}, left.Signature()...)
+	cols := make([]Column, 0, left.NumCols()+right.NumCols())
+	for cnum := 0; cnum < left.NumCols(); cnum++ {
+		cols = append(cols, selectColumn{left.Column(cnum), lrows})
+	}
+	rsig := right.Signature()
+	for cnum := 0; cnum < right.NumCols(); cnum++ {
+		if cnum == rightCol && !keepKeys {
+			continue
+		}
+		sig = append(sig, rsig[cnum])
+		cols = append(cols, selectColumn{right.Column(cnum), rrows})
+	}
+	return newDerivedRelation(sig, cols), nil
+}
+
 //
 // derivedRealtion
 //
@@ -2230,6 +3320,10 @@ func (r derivedRelation) NumRows() int {
 	return r.cols[0].NumRows()
 }
 
+func (r derivedRelation) IsEmpty() bool {
+	return len(r.cols) == 0 || r.cols[0].NumRows() == 0
+}
+
 func (r derivedRelation) String(rnum int) string {
 	return "(" + strings.Join(r.Strings(rnum), ", ") + ")"
 }
@@ -2270,6 +3364,30 @@ func (r derivedRelation) Signature() Signature {
 	return r.sig
 }
 
+func (r derivedRelation) Cast(
+	cnum int, t reflect.Type, conv func(any) (any, error),
+) (Relation, error) {
+	return castRelation(r, cnum, t, conv)
+}
+
+func (r derivedRelation) WithComputedColumn(
+	name string, t reflect.Type, fn func([]any) any,
+) (Relation, error) {
+	return withComputedColumn(r, name, t, fn)
+}
+
+func (r derivedRelation) Nullify(sentinels ...string) Relation {
+	return nullifyRelation(r, sentinels...)
+}
+
+func (r derivedRelation) Rename(cnum int, name string) (Relation, error) {
+	return renameColumn(r, cnum, name)
+}
+
+func (r derivedRelation) Sample(n int, seed int64) Relation {
+	return sampleRows(r, n, seed)
+}
+
 func (r derivedRelation) Slice(lo int, hi ...int) Relation {
 	var c []Column
 	var s Signature
@@ -2318,3 +3436,9 @@ func (c RelationCollection) Select(args ...any) RelationCollection {
 func (c RelationCollection) Union() Relation {
 	return newUnionRelation(c)
 }
+
+// Returns the concatenation of the relations in the collection, which must
+// all have the same signature.
+func (c RelationCollection) Concat() (Relation, error) {
+	return Concat(c...)
+}
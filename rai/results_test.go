@@ -3,13 +3,28 @@
 package rai
 
 import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
 	"fmt"
+	"io"
+	"math"
 	"math/big"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"runtime"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/apache/arrow/go/v7/arrow"
+	"github.com/apache/arrow/go/v7/arrow/array"
+	"github.com/apache/arrow/go/v7/arrow/decimal128"
 	"github.com/apache/arrow/go/v7/arrow/float16"
+	"github.com/apache/arrow/go/v7/arrow/ipc"
+	"github.com/apache/arrow/go/v7/arrow/memory"
+	"github.com/pkg/errors"
 	"github.com/shopspring/decimal"
 	"github.com/stretchr/testify/assert"
 )
@@ -1960,18 +1975,23 @@ func TestInterfaceTypes(t *testing.T) {
 
 	c = decimal8Column{}
 	_ = c.(SimpleColumn[decimal.Decimal])
+	_ = c.(DecimalColumn)
 
 	c = decimal16Column{}
 	_ = c.(SimpleColumn[decimal.Decimal])
+	_ = c.(DecimalColumn)
 
 	c = decimal32Column{}
 	_ = c.(SimpleColumn[decimal.Decimal])
+	_ = c.(DecimalColumn)
 
 	c = decimal64Column{}
 	_ = c.(SimpleColumn[decimal.Decimal])
+	_ = c.(DecimalColumn)
 
 	c = decimal128Column{}
 	_ = c.(SimpleColumn[decimal.Decimal])
+	_ = c.(DecimalColumn)
 
 	c = int128Column{}
 	_ = c.(SimpleColumn[*big.Int])
@@ -2031,6 +2051,1132 @@ func TestInterfaceTypes(t *testing.T) {
 	_ = r.(Tabular)
 }
 
+func TestDecimalScale(t *testing.T) {
+	tests := []struct {
+		col       Column
+		precision int32
+		scale     int32
+		value     string
+	}{
+		{newDecimalColumn(vtype("rel:base:FixedDecimal", int64(8), int64(1), Int8Type),
+			newPrimitiveColumn([]int8{-12})), 2, 1, "-1.2"},
+		{newDecimalColumn(vtype("rel:base:FixedDecimal", int64(16), int64(2), Int16Type),
+			newPrimitiveColumn([]int16{1234})), 4, 2, "12.34"},
+		{newDecimalColumn(vtype("rel:base:FixedDecimal", int64(32), int64(3), Int32Type),
+			newPrimitiveColumn([]int32{1234})), 9, 3, "1.234"},
+		{newDecimalColumn(vtype("rel:base:FixedDecimal", int64(64), int64(0), Int64Type),
+			newPrimitiveColumn([]int64{1234})), 18, 0, "1234"},
+		{newDecimalColumn(vtype("rel:base:FixedDecimal", int64(128), int64(2), Int128Type),
+			newUint64ListColumn([]uint64{1234, 0}, 2)), 38, 2, "12.34"},
+	}
+	for _, tt := range tests {
+		c, ok := tt.col.(DecimalColumn)
+		assert.True(t, ok)
+		if !ok {
+			continue
+		}
+		assert.Equal(t, tt.precision, c.Precision())
+		assert.Equal(t, tt.scale, c.Scale())
+		assert.Equal(t, tt.value, c.String(0))
+	}
+}
+
+type testInner struct {
+	A int64
+	B string
+}
+
+type testOuter struct {
+	N     int32
+	Inner *testInner
+}
+
+func TestDecimalFormat(t *testing.T) {
+	rel := newDerivedRelation(
+		sig("output", DecimalType),
+		[]Column{
+			newSymbolColumn("output", 2),
+			newDecimalColumn(vtype("rel:base:FixedDecimal", int64(64), int64(2), Int64Type),
+				newPrimitiveColumn([]int64{1230, 500}))})
+
+	var b bytes.Buffer
+	assert.Equal(t, "12.3", rel.Column(1).String(0))
+	assert.Nil(t, rel.WriteJSONL(&b, nil))
+	assert.Equal(t, `{"col1":"12.3","output":"output"}`+"\n"+`{"col1":"5","output":"output"}`+"\n", b.String())
+	b.Reset()
+	assert.Nil(t, WriteRelationCSV(rel, &b, nil))
+	assert.Equal(t, "output,12.3\noutput,5\n", b.String())
+
+	b.Reset()
+	jopts := NewJSONLWriteOptions().WithDecimalFormat(DecimalFixed)
+	assert.Nil(t, rel.WriteJSONL(&b, jopts))
+	assert.Equal(t, `{"col1":"12.30","output":"output"}`+"\n"+`{"col1":"5.00","output":"output"}`+"\n", b.String())
+	b.Reset()
+	copts := NewCSVWriteOptions().WithDecimalFormat(DecimalFixed)
+	assert.Nil(t, WriteRelationCSV(rel, &b, copts))
+	assert.Equal(t, "output,12.30\noutput,5.00\n", b.String())
+
+	// the format is an option of each write, the column is unchanged
+	assert.Equal(t, "12.3", rel.Column(1).String(0))
+}
+
+func TestDecodeValueTypes(t *testing.T) {
+	RegisterValueType("TestInner", &testInner{})
+	RegisterValueType("TestOuter", testOuter{})
+
+	inner := valueColumn{[]Column{
+		newSymbolColumn("TestInner", 1),
+		newPrimitiveColumn([]int64{42}),
+		newSymbolColumn("a", 1)}}
+	outer := valueColumn{[]Column{
+		newSymbolColumn("TestOuter", 1),
+		newPrimitiveColumn([]int64{7}),
+		inner}}
+	innerType := vtype("TestInner", Int64Type, StringType)
+	rel := newDerivedRelation(
+		sig("output", vtype("TestOuter", Int64Type, innerType)),
+		[]Column{newSymbolColumn("output", 1), outer})
+
+	row, err := rel.DecodeValueTypes(0)
+	assert.Nil(t, err)
+	assert.Equal(t, []any{"output", testOuter{7, &testInner{42, "a"}}}, row)
+
+	// unregistered value type
+	rel = newDerivedRelation(
+		sig("output", vtype("TestMissing", Int64Type)),
+		[]Column{newSymbolColumn("output", 1), valueColumn{[]Column{
+			newSymbolColumn("TestMissing", 1), newPrimitiveColumn([]int64{1})}}})
+	_, err = rel.DecodeValueTypes(0)
+	assert.NotNil(t, err)
+
+	// arity mismatch
+	rel = newDerivedRelation(
+		sig("output", vtype("TestInner", Int64Type)),
+		[]Column{newSymbolColumn("output", 1), valueColumn{[]Column{
+			newSymbolColumn("TestInner", 1), newPrimitiveColumn([]int64{1})}}})
+	_, err = rel.DecodeValueTypes(0)
+	assert.NotNil(t, err)
+}
+
+func TestConcat(t *testing.T) {
+	r1 := newDerivedRelation(sig("output", Int64Type), []Column{
+		newSymbolColumn("output", 2), newPrimitiveColumn([]int64{1, 2})})
+	r2 := newDerivedRelation(sig("output", Int64Type), []Column{
+		newSymbolColumn("output", 1), newPrimitiveColumn([]int64{3})})
+	r3 := newDerivedRelation(sig("output", Float64Type), []Column{
+		newSymbolColumn("output", 1), newPrimitiveColumn([]float64{3.14})})
+
+	rel, err := Concat(r1, r2)
+	assert.Nil(t, err)
+	assert.Equal(t, sig("output", Int64Type), rel.Signature())
+	assert.Equal(t, 3, rel.NumRows())
+	assert.Equal(t, Int64Type, rel.Column(1).Type())
+	assert.Equal(t, []any{"output", int64(3)}, rel.Row(2))
+
+	rel, err = RelationCollection{r1, r2}.Concat()
+	assert.Nil(t, err)
+	assert.Equal(t, 3, rel.NumRows())
+
+	_, err = Concat(r1, r3)
+	assert.NotNil(t, err)
+
+	_, err = Concat()
+	assert.NotNil(t, err)
+}
+
+func TestListColumns(t *testing.T) {
+	mem := memory.NewGoAllocator()
+
+	// variable length lists, including an empty list
+	lb := array.NewListBuilder(mem, arrow.PrimitiveTypes.Int64)
+	vb := lb.ValueBuilder().(*array.Int64Builder)
+	lb.Append(true)
+	vb.AppendValues([]int64{1, 2, 3}, nil)
+	lb.Append(true)
+	lb.Append(true)
+	vb.Append(4)
+	la := lb.NewListArray()
+	defer la.Release()
+
+	assert.Equal(t, AnyListType, columnType(la))
+	c := newPartitionColumn(la, la.Len())
+	assert.Equal(t, AnyListType, c.Type())
+	assert.Equal(t, 3, c.NumRows())
+	assert.Equal(t, []any{int64(1), int64(2), int64(3)}, c.Value(0))
+	assert.Equal(t, []any{}, c.Value(1))
+	assert.Equal(t, []any{int64(4)}, c.Value(2))
+	assert.Equal(t, "(1, 2, 3)", c.String(0))
+
+	// sliced list arrays start at an offset
+	sa := array.NewSlice(la, 1, 3).(*array.List)
+	defer sa.Release()
+	c = newPartitionColumn(sa, sa.Len())
+	assert.Equal(t, 2, c.NumRows())
+	assert.Equal(t, []any{int64(4)}, c.Value(1))
+
+	// and may end before the last row of the underlying array
+	sa = array.NewSlice(la, 0, 2).(*array.List)
+	defer sa.Release()
+	c = newPartitionColumn(sa, sa.Len())
+	assert.Equal(t, 2, c.NumRows())
+	assert.Equal(t, []any{int64(1), int64(2), int64(3)}, c.Value(0))
+	assert.Equal(t, []any{}, c.Value(1))
+	rel := newDerivedRelation(sig(AnyListType), []Column{c})
+	assert.Equal(t, [][]any{{[]any{int64(1), int64(2), int64(3)}}, {[]any{}}}, rowsOf(rel))
+
+	// fixed size boolean lists
+	fb := array.NewFixedSizeListBuilder(mem, 2, arrow.FixedWidthTypes.Boolean)
+	bb := fb.ValueBuilder().(*array.BooleanBuilder)
+	fb.Append(true)
+	bb.AppendValues([]bool{true, false}, nil)
+	fb.Append(true)
+	bb.AppendValues([]bool{false, true}, nil)
+	fa := fb.NewArray().(*array.FixedSizeList)
+	defer fa.Release()
+
+	assert.Equal(t, BoolListType, columnType(fa))
+	c = newPartitionColumn(fa, fa.Len())
+	assert.Equal(t, BoolListType, c.Type())
+	assert.Equal(t, []bool{true, false}, c.Value(0))
+	assert.Equal(t, []bool{false, true}, c.Value(1))
+	assert.Equal(t, "(false, true)", c.String(1))
+}
+
+func TestRawRelations(t *testing.T) {
+	mem := memory.NewGoAllocator()
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "v1", Type: arrow.PrimitiveTypes.Int64},
+		{Name: "v2", Type: arrow.BinaryTypes.String}}, nil)
+	b := array.NewRecordBuilder(mem, schema)
+	defer b.Release()
+	b.Field(0).(*array.Int64Builder).AppendValues([]int64{1, 2}, nil)
+	b.Field(1).(*array.StringBuilder).AppendValues([]string{"a", "b"}, nil)
+	rec := b.NewRecord()
+	defer rec.Release()
+
+	schema = arrow.NewSchema([]arrow.Field{
+		{Name: "v1", Type: arrow.PrimitiveTypes.Float64}}, nil)
+	b2 := array.NewRecordBuilder(mem, schema)
+	defer b2.Release()
+	b2.Field(0).(*array.Float64Builder).Append(3.14)
+	rec2 := b2.NewRecord()
+	defer rec2.Release()
+
+	rsp := &TransactionResponse{Partitions: map[string]*Partition{
+		"1.arrow": newPartition(rec2),
+		"0.arrow": newPartition(rec)}}
+	assert.Equal(t, 0, len(rsp.Relations()))
+
+	rs := rsp.RawRelations()
+	assert.Equal(t, 2, len(rs))
+	assert.Equal(t, sig(Int64Type, StringType), rs[0].Signature())
+	assert.Equal(t, []any{int64(2), "b"}, rs[0].Row(1))
+	assert.Equal(t, sig(Float64Type), rs[1].Signature())
+
+	rs = rsp.RawRelations(Float64Type)
+	assert.Equal(t, 1, len(rs))
+	assert.Equal(t, []any{3.14}, rs[0].Row(0))
+}
+
+func TestArrowIPC(t *testing.T) {
+	mem := memory.NewGoAllocator()
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "v1", Type: arrow.PrimitiveTypes.Int64}}, nil)
+	b := array.NewRecordBuilder(mem, schema)
+	defer b.Release()
+	b.Field(0).(*array.Int64Builder).AppendValues([]int64{1, 2, 3}, nil)
+	rec := b.NewRecord()
+	defer rec.Release()
+
+	rsp := &TransactionResponse{Partitions: map[string]*Partition{"0.arrow": newPartition(rec)}}
+	data, err := rsp.ArrowIPC("0.arrow")
+	assert.Nil(t, err)
+
+	r, err := ipc.NewReader(bytes.NewReader(data))
+	assert.Nil(t, err)
+	defer r.Release()
+	assert.True(t, r.Next())
+	assert.True(t, array.RecordEqual(rec, r.Record()))
+	assert.False(t, r.Next())
+
+	all, err := rsp.ArrowIPCAll()
+	assert.Nil(t, err)
+	assert.Equal(t, map[string][]byte{"0.arrow": data}, all)
+
+	_, err = rsp.ArrowIPC("1.arrow")
+	assert.NotNil(t, err)
+}
+
+func TestMultiBatchPartition(t *testing.T) {
+	mem := memory.NewGoAllocator()
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "v1", Type: arrow.PrimitiveTypes.Int64},
+		{Name: "v2", Type: arrow.BinaryTypes.String}}, nil)
+	var data bytes.Buffer
+	w := ipc.NewWriter(&data, ipc.WithSchema(schema))
+	for batch := 0; batch < 3; batch++ {
+		b := array.NewRecordBuilder(mem, schema)
+		for i := 0; i < 2; i++ {
+			n := int64(batch*2 + i)
+			b.Field(0).(*array.Int64Builder).Append(n)
+			b.Field(1).(*array.StringBuilder).Append(fmt.Sprintf("s%d", n))
+		}
+		rec := b.NewRecord()
+		assert.Nil(t, w.Write(rec))
+		rec.Release()
+		b.Release()
+	}
+	assert.Nil(t, w.Close())
+
+	rec, err := readPartitionRecord(&data)
+	assert.Nil(t, err)
+	p := newPartition(rec)
+	assert.Equal(t, 6, p.NumRows())
+	for rnum := 0; rnum < 6; rnum++ {
+		assert.Equal(t, []any{int64(rnum), fmt.Sprintf("s%d", rnum)}, p.Row(rnum))
+	}
+
+	_, err = readPartitionRecord(bytes.NewReader(nil))
+	assert.NotNil(t, err)
+}
+
+// Returns an arrow IPC stream of the given batches of int64 values.
+func newInt64Stream(t *testing.T, batches ...[]int64) []byte {
+	mem := memory.NewGoAllocator()
+	schema := arrow.NewSchema([]arrow.Field{{Name: "v1", Type: arrow.PrimitiveTypes.Int64}}, nil)
+	var data bytes.Buffer
+	w := ipc.NewWriter(&data, ipc.WithSchema(schema))
+	for _, batch := range batches {
+		b := array.NewRecordBuilder(mem, schema)
+		b.Field(0).(*array.Int64Builder).AppendValues(batch, nil)
+		rec := b.NewRecord()
+		assert.Nil(t, w.Write(rec))
+		rec.Release()
+		b.Release()
+	}
+	assert.Nil(t, w.Close())
+	return data.Bytes()
+}
+
+// Test reading a multipart transaction response whose partitions are arrow
+// streams of one or more record batches.
+func TestReadMultipartResults(t *testing.T) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	writePart := func(ctype, disposition string, data []byte) {
+		h := textproto.MIMEHeader{}
+		h.Set("Content-Type", ctype)
+		h.Set("Content-Disposition", disposition)
+		pw, err := mw.CreatePart(h)
+		assert.Nil(t, err)
+		_, err = pw.Write(data)
+		assert.Nil(t, err)
+	}
+	writePart("application/json", `form-data; name="transaction"`,
+		[]byte(`{"id": "tx", "state": "COMPLETED"}`))
+	writePart("application/json", `form-data; name="problems"`,
+		[]byte(`[{"type": "ClientProblem", "message": "warning"}]`))
+	writePart("text/plain", `form-data; name="relation-count"`, []byte("2"))
+	writePart("application/vnd.apache.arrow.stream", `form-data; name="0.arrow"; filename="0.arrow"`,
+		newInt64Stream(t, []int64{1, 2}, []int64{3}))
+	writePart("application/vnd.apache.arrow.stream", `form-data; name="1.arrow"`,
+		newInt64Stream(t, []int64{42}))
+	assert.Nil(t, mw.Close())
+	newResponse := func() *http.Response {
+		return &http.Response{
+			Header: http.Header{"Content-Type": {mw.FormDataContentType()}},
+			Body:   io.NopCloser(bytes.NewReader(body.Bytes()))}
+	}
+
+	rsp, err := ReadTransactionResponse(newResponse())
+	assert.Nil(t, err)
+	assert.Equal(t, "tx", rsp.Transaction.ID)
+	assert.Equal(t, Completed, rsp.Transaction.State)
+	assert.Equal(t, "warning", rsp.Problems[0].Message)
+	assert.Equal(t, 2, len(rsp.Partitions))
+	p := rsp.Partitions["0.arrow"]
+	assert.Equal(t, 3, p.NumRows())
+	assert.Equal(t, Int64Type, p.Column(0).Type())
+	assert.Equal(t, []any{int64(3)}, p.Row(2))
+	assert.Equal(t, []any{int64(42)}, rsp.Partitions["1.arrow"].Row(0))
+
+	results, err := readTransactionResults(newResponse())
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(results))
+	assert.Equal(t, 3, results["0.arrow"].NumRows())
+
+	bad := newResponse()
+	bad.Header.Set("Content-Type", "application/json")
+	_, err = ReadTransactionResponse(bad)
+	assert.NotNil(t, err)
+}
+
+func TestWritePartitionCSV(t *testing.T) {
+	mem := memory.NewGoAllocator()
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "v1", Type: arrow.PrimitiveTypes.Int64},
+		{Name: "v2", Type: arrow.BinaryTypes.String}}, nil)
+	var data bytes.Buffer
+	w := ipc.NewWriter(&data, ipc.WithSchema(schema))
+	for _, batch := range [][]string{{"a", "b,c"}, {`d"e`}} {
+		b := array.NewRecordBuilder(mem, schema)
+		for _, v := range batch {
+			b.Field(0).(*array.Int64Builder).Append(int64(len(v)))
+			b.Field(1).(*array.StringBuilder).Append(v)
+		}
+		rec := b.NewRecord()
+		assert.Nil(t, w.Write(rec))
+		rec.Release()
+		b.Release()
+	}
+	assert.Nil(t, w.Close())
+	msig := sig("output", "name", Int64Type, StringType)
+	stream := data.Bytes()
+
+	var out strings.Builder
+	err := writePartitionCSV(bytes.NewReader(stream), msig, &out, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "output,name,1,a\noutput,name,3,\"b,c\"\noutput,name,3,\"d\"\"e\"\n", out.String())
+
+	out.Reset()
+	opts := NewCSVWriteOptions().WithDelim('\t').WithHeader(true)
+	err = writePartitionCSV(bytes.NewReader(stream), msig, &out, opts)
+	assert.Nil(t, err)
+	lines := strings.Split(out.String(), "\n")
+	assert.Equal(t, "output\tname\tcol2\tcol3", lines[0])
+	assert.Equal(t, "output\tname\t3\tb,c", lines[2])
+
+	// the streamed output is the same as writing the decoded relation
+	rec, err := readPartitionRecord(bytes.NewReader(stream))
+	assert.Nil(t, err)
+	var expected strings.Builder
+	err = WriteRelationCSV(newBaseRelation(newPartition(rec), msig), &expected, opts)
+	assert.Nil(t, err)
+	assert.Equal(t, expected.String(), out.String())
+}
+
+func newStringArray(vals []string) *array.String {
+	b := array.NewStringBuilder(memory.NewGoAllocator())
+	defer b.Release()
+	b.AppendValues(vals, nil)
+	return b.NewStringArray()
+}
+
+func TestAllStrings(t *testing.T) {
+	data := newStringArray([]string{"a", "", "bcd", "é"})
+	defer data.Release()
+	c, ok := newStringColumn(data).(StringColumn)
+	assert.True(t, ok)
+	assert.Equal(t, []string{"a", "", "bcd", "é"}, c.AllStrings())
+
+	// slices of the array are offset into the underlying data
+	slice := array.NewSlice(data, 2, 4).(*array.String)
+	defer slice.Release()
+	assert.Equal(t, []string{"bcd", "é"}, newStringColumn(slice).(StringColumn).AllStrings())
+
+	empty := newStringArray(nil)
+	defer empty.Release()
+	assert.Equal(t, []string{}, newStringColumn(empty).(StringColumn).AllStrings())
+}
+
+func benchmarkStrings(b *testing.B, fn func(StringColumn) []string) {
+	vals := make([]string, 1000000)
+	for i := range vals {
+		vals[i] = fmt.Sprintf("s%d", i)
+	}
+	data := newStringArray(vals)
+	defer data.Release()
+	c := newStringColumn(data).(StringColumn)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		fn(c)
+	}
+}
+
+func BenchmarkAllStrings(b *testing.B) {
+	benchmarkStrings(b, StringColumn.AllStrings)
+}
+
+func BenchmarkStringItems(b *testing.B) {
+	benchmarkStrings(b, func(c StringColumn) []string {
+		result := make([]string, c.NumRows())
+		for rnum := range result {
+			result[rnum] = c.Item(rnum)
+		}
+		return result
+	})
+}
+
+func benchmarkWriteCSV(b *testing.B, write func(Relation, *bytes.Buffer) error) {
+	rsp := newPartitionedResponse(1, 100000)
+	r := rsp.Relations()[0]
+	var out bytes.Buffer
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		out.Reset()
+		if err := write(r, &out); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkWriteCSVColumns(b *testing.B) {
+	benchmarkWriteCSV(b, func(r Relation, out *bytes.Buffer) error {
+		return WriteRelationCSV(r, out, nil)
+	})
+}
+
+// Writes the same CSV as WriteRelationCSV, by way of boxed row values.
+func BenchmarkWriteCSVRows(b *testing.B) {
+	benchmarkWriteCSV(b, func(r Relation, out *bytes.Buffer) error {
+		cw := csv.NewWriter(out)
+		record := make([]string, r.NumCols())
+		for rnum := 0; rnum < r.NumRows(); rnum++ {
+			for cnum, v := range r.Row(rnum) {
+				record[cnum] = fmt.Sprintf("%v", v)
+			}
+			if err := cw.Write(record); err != nil {
+				return err
+			}
+		}
+		cw.Flush()
+		return cw.Error()
+	})
+}
+
+func TestArrowDecimalColumn(t *testing.T) {
+	mem := memory.NewGoAllocator()
+	dt := &arrow.Decimal128Type{Precision: 38, Scale: 2}
+	b := array.NewDecimal128Builder(mem, dt)
+	defer b.Release()
+	b.Append(decimal128.FromI64(1234))
+	b.Append(decimal128.FromI64(-5))
+	b.Append(decimal128.New(1, 0)) // 2^64
+	data := b.NewDecimal128Array()
+	defer data.Release()
+	schema := arrow.NewSchema([]arrow.Field{{Name: "v1", Type: dt}}, nil)
+	rec := array.NewRecord(schema, []arrow.Array{data}, 3)
+	defer rec.Release()
+
+	p := newPartition(rec)
+	assert.Equal(t, sig(DecimalType), p.Signature())
+	c, ok := p.Column(0).(DecimalColumn)
+	assert.True(t, ok)
+	assert.Equal(t, int32(38), c.Precision())
+	assert.Equal(t, int32(2), c.Scale())
+	assert.Equal(t, decimal.New(1234, -2), c.Item(0))
+	assert.Equal(t, "-0.05", c.String(1))
+	assert.Equal(t, "184467440737095516.16", c.String(2))
+
+	// the native decimal is used as is for FixedDecimal value types
+	r := newBaseRelation(p, sig("output", vtype("rel:base:FixedDecimal",
+		int64(128), int64(2), Int128Type)))
+	assert.Equal(t, sig("output", DecimalType), r.Signature())
+	assert.Equal(t, []any{"output", decimal.New(-5, -2)}, r.Row(1))
+}
+
+// Returns a response with the given number of single column partitions.
+func newPartitionedResponse(npart, nrows int) *TransactionResponse {
+	mem := memory.NewGoAllocator()
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "v1", Type: arrow.PrimitiveTypes.Int64}}, nil)
+	rsp := &TransactionResponse{
+		Metadata:   &TransactionMetadata{sigMap: map[string]Signature{}},
+		Partitions: map[string]*Partition{}}
+	vals := make([]int64, nrows)
+	for i := range vals {
+		vals[i] = int64(i)
+	}
+	for i := 0; i < npart; i++ {
+		b := array.NewRecordBuilder(mem, schema)
+		b.Field(0).(*array.Int64Builder).AppendValues(vals, nil)
+		id := fmt.Sprintf("%d.arrow", i)
+		rsp.Partitions[id] = newPartition(b.NewRecord())
+		rsp.Metadata.sigMap[id] = sig("output", fmt.Sprintf("r%d", i), Int64Type)
+		b.Release()
+	}
+	return rsp
+}
+
+func TestRows(t *testing.T) {
+	collect := func(rows func(yield func([]any) bool)) [][]any {
+		result := [][]any{}
+		rows(func(row []any) bool {
+			result = append(result, row)
+			return true
+		})
+		return result
+	}
+	rsp := newPartitionedResponse(3, 2)
+	rows := collect(rsp.Rows())
+	assert.Equal(t, 6, len(rows))
+	assert.Equal(t, []any{"output", "r0", int64(0)}, rows[0])
+	assert.Equal(t, []any{"output", "r2", int64(1)}, rows[5])
+	assert.Equal(t, rowsOf(rsp.Relations().Union()), rows)
+
+	rows = collect(rsp.Rows("output", "r1"))
+	assert.Equal(t, [][]any{{"output", "r1", int64(0)}, {"output", "r1", int64(1)}}, rows)
+	assert.Empty(t, collect(rsp.Rows("missing")))
+
+	// the iterator stops when yield returns false
+	n := 0
+	rsp.Rows()(func(row []any) bool {
+		n++
+		return n < 3
+	})
+	assert.Equal(t, 3, n)
+
+	assert.Empty(t, collect((&TransactionResponse{}).Rows()))
+}
+
+func TestOutputNames(t *testing.T) {
+	rsp := newPartitionedResponse(2, 1)
+	rsp.Metadata.sigMap["2.arrow"] = sig("rel", "catalog", "diagnostic", Int64Type)
+	rsp.Metadata.sigMap["3.arrow"] = sig(Int64Type, "foo")
+	rsp.Metadata.sigMap["4.arrow"] = sig()
+	assert.Equal(t, []string{"output", "rel"}, rsp.OutputNames())
+
+	assert.Nil(t, TransactionResponse{}.OutputNames())
+	rsp = &TransactionResponse{Metadata: &TransactionMetadata{}}
+	assert.Equal(t, []string{}, rsp.OutputNames())
+}
+
+func TestOrderedRelationIDs(t *testing.T) {
+	rsp := newPartitionedResponse(12, 1)
+	rsp.Partitions["x.arrow"] = rsp.Partitions["0.arrow"]
+	rsp.Metadata.sigMap["x.arrow"] = sig("output", "x", Int64Type)
+	ids := rsp.OrderedRelationIDs()
+	assert.Equal(t, []string{
+		"0.arrow", "1.arrow", "2.arrow", "3.arrow", "4.arrow", "5.arrow", "6.arrow",
+		"7.arrow", "8.arrow", "9.arrow", "10.arrow", "11.arrow", "x.arrow"}, ids)
+
+	rc := rsp.Relations()
+	assert.Equal(t, sig("output", "r2", Int64Type), rc[2].Signature())
+	assert.Equal(t, sig("output", "r10", Int64Type), rc[10].Signature())
+	assert.Equal(t, sig("output", "x", Int64Type), rc[12].Signature())
+	raw := rsp.RawRelations()
+	assert.Equal(t, 13, len(raw))
+}
+
+func TestDiagnostics(t *testing.T) {
+	rsp := newPartitionedResponse(4, 1)
+	rsp.Metadata.sigMap["1.arrow"] = sig("rel", "catalog", "diagnostic", "message", Int64Type)
+	rsp.Metadata.sigMap["2.arrow"] = sig("rel", "catalog", "ic_violation", "c1", Int64Type)
+	rsp.Metadata.sigMap["3.arrow"] = sig("warnings", Int64Type)
+
+	names := func(rc RelationCollection) []string {
+		result := []string{}
+		for _, r := range rc {
+			result = append(result, r.Signature()[0].(string)+":"+r.Signature()[2].(string))
+		}
+		return result
+	}
+	diags := rsp.Diagnostics()
+	assert.Equal(t, 2, len(diags))
+	assert.Equal(t, []string{"rel:diagnostic", "rel:ic_violation"}, names(diags))
+	assert.Equal(t, 2, len(rsp.UserRelations()))
+
+	prefixes := append(DefaultDiagnosticPrefixes, Signature{"warnings"})
+	assert.Equal(t, 3, len(rsp.Diagnostics(prefixes...)))
+	users := rsp.UserRelations(prefixes...)
+	assert.Equal(t, 1, len(users))
+	assert.Equal(t, sig("output", "r0", Int64Type), users[0].Signature())
+}
+
+func TestRelationsParallel(t *testing.T) {
+	serial := newPartitionedResponse(50, 10).Relations()
+	parallel := newPartitionedResponse(50, 10).RelationsParallel(8)
+	assert.Equal(t, 50, len(parallel))
+	for i := range serial {
+		assert.Equal(t, serial[i].Signature(), parallel[i].Signature())
+		assert.Equal(t, serial[i].Row(9), parallel[i].Row(9))
+	}
+	assert.Equal(t, sig("output", "r0", Int64Type), parallel[0].Signature())
+	assert.Equal(t, sig("output", "r1", Int64Type), parallel[1].Signature())
+	assert.Equal(t, sig("output", "r2", Int64Type), parallel[2].Signature())
+}
+
+func benchmarkRelations(b *testing.B, concurrency int) {
+	rsp := newPartitionedResponse(200, 1000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rsp.relations = nil
+		rsp.RelationsParallel(concurrency)
+	}
+}
+
+func BenchmarkRelationsSerial(b *testing.B) {
+	benchmarkRelations(b, 1)
+}
+
+func BenchmarkRelationsParallel(b *testing.B) {
+	benchmarkRelations(b, runtime.GOMAXPROCS(0))
+}
+
+func TestScalar(t *testing.T) {
+	mem := memory.NewGoAllocator()
+	newRecord := func(vals ...int64) arrow.Record {
+		schema := arrow.NewSchema([]arrow.Field{
+			{Name: "v1", Type: arrow.PrimitiveTypes.Int64}}, nil)
+		b := array.NewRecordBuilder(mem, schema)
+		defer b.Release()
+		b.Field(0).(*array.Int64Builder).AppendValues(vals, nil)
+		return b.NewRecord()
+	}
+	rsp := &TransactionResponse{
+		Metadata: &TransactionMetadata{sigMap: map[string]Signature{
+			"0.arrow": sig("output", Int64Type),
+			"1.arrow": sig("output", Int64Type)}},
+		Partitions: map[string]*Partition{
+			"0.arrow": newPartition(newRecord(42)),
+			"1.arrow": newPartition(newRecord(1, 2))}}
+
+	v, err := rsp.Scalar("0.arrow")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(42), v)
+
+	n, err := rsp.Int64Scalar("0.arrow")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(42), n)
+
+	_, err = rsp.StringScalar("0.arrow")
+	assert.NotNil(t, err)
+
+	_, err = rsp.Scalar("1.arrow")
+	assert.NotNil(t, err)
+
+	_, err = rsp.Scalar("2.arrow")
+	assert.NotNil(t, err)
+}
+
+func TestForEach(t *testing.T) {
+	c := newPrimitiveColumn([]int64{1, 2, 3})
+
+	var values []any
+	ForEach(c, func(rnum int, v any) {
+		assert.Equal(t, len(values), rnum)
+		values = append(values, v)
+	})
+	assert.Equal(t, []any{int64(1), int64(2), int64(3)}, values)
+
+	var sum int64
+	ForEachTyped[int64](c, func(rnum int, v int64) {
+		sum += v
+	})
+	assert.Equal(t, int64(6), sum)
+}
+
+func TestSchema(t *testing.T) {
+	rel := newDerivedRelation(
+		sig("output", "a", "a", Int64Type, int64(42), vtype("Point", Float64Type, Float64Type)),
+		make([]Column, 6))
+	expected := []ColumnSchema{
+		{Name: "output", TypeName: "Symbol", Value: "output"},
+		{Name: "col1", TypeName: "Symbol", Value: "a"},
+		{Name: "col2", TypeName: "Symbol", Value: "a"},
+		{Name: "col3", TypeName: "Int64"},
+		{Name: "col4", TypeName: "Int64", Value: int64(42)},
+		{Name: "col5", TypeName: "Point", Fields: []ColumnSchema{
+			{Name: "col0", TypeName: "Float64"},
+			{Name: "col1", TypeName: "Float64"}}}}
+	assert.Equal(t, expected, rel.Schema())
+
+	data, err := json.Marshal(rel.Schema()[:2])
+	assert.Nil(t, err)
+	assert.Equal(t,
+		`[{"name":"output","type":"Symbol","value":"output"},`+
+			`{"name":"col1","type":"Symbol","value":"a"}]`,
+		string(data))
+}
+
+func TestRowMap(t *testing.T) {
+	rel := newDerivedRelation(
+		sig("output", "x", Int64Type, vtype("Point", Int64Type)),
+		[]Column{
+			newSymbolColumn("output", 1),
+			newSymbolColumn("x", 1),
+			newPrimitiveColumn([]int64{42}),
+			valueColumn{[]Column{newSymbolColumn("Point", 1), newPrimitiveColumn([]int64{7})}}})
+	assert.Equal(t, map[string]any{
+		"output": "output",
+		"x":      "x",
+		"col2":   int64(42),
+		"col3":   []any{"Point", int64(7)}},
+		rel.RowMap(0))
+
+	// positional names do not collide with symbols
+	rel = newDerivedRelation(
+		sig("col1", Int64Type, "col1_1"),
+		[]Column{
+			newSymbolColumn("col1", 1),
+			newPrimitiveColumn([]int64{42}),
+			newSymbolColumn("col1_1", 1)})
+	assert.Equal(t, map[string]any{
+		"col1":   "col1",
+		"col1_2": int64(42),
+		"col1_1": "col1_1"},
+		rel.RowMap(0))
+}
+
+func TestWriteJSONL(t *testing.T) {
+	rel := newDerivedRelation(
+		sig("output", Int64Type, BigIntType, TimeType, MissingType, RuneType),
+		[]Column{
+			newSymbolColumn("output", 2),
+			newPrimitiveColumn([]int64{1, 2}),
+			newInt128Column(newUint64ListColumn([]uint64{3, 0, 4, 0}, 2)),
+			newDateTimeColumn(newPrimitiveColumn([]int64{
+				time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC).UnixMilli() + epochStartMillis,
+				time.Date(2022, 6, 7, 8, 9, 10, 0, time.UTC).UnixMilli() + epochStartMillis})),
+			newMissingColumn(2),
+			newCharColumn(newPrimitiveColumn([]uint32{'a', 'b'}))})
+	var b bytes.Buffer
+	assert.Nil(t, rel.WriteJSONL(&b, nil))
+	assert.Equal(t,
+		`{"col1":1,"col2":"3","col3":"2022-01-02T03:04:05Z","col4":null,"col5":"a","output":"output"}`+"\n"+
+			`{"col1":2,"col2":"4","col3":"2022-06-07T08:09:10Z","col4":null,"col5":"b","output":"output"}`+"\n",
+		b.String())
+
+	// non-finite floats have no JSON number
+	rel = newDerivedRelation(
+		sig(Float64Type, Float32Type),
+		[]Column{
+			newPrimitiveColumn([]float64{math.NaN(), 1.5, math.Inf(-1)}),
+			newPrimitiveColumn([]float32{float32(math.Inf(1)), 2, float32(math.NaN())})})
+	b.Reset()
+	assert.Nil(t, rel.WriteJSONL(&b, nil))
+	assert.Equal(t,
+		`{"col0":"NaN","col1":"+Inf"}`+"\n"+
+			`{"col0":1.5,"col1":2}`+"\n"+
+			`{"col0":"-Inf","col1":"NaN"}`+"\n",
+		b.String())
+}
+
+func TestTypedColumns(t *testing.T) {
+	rel := newDerivedRelation(
+		sig("output", Int64Type, BigIntType, TimeType, RuneType),
+		[]Column{
+			newSymbolColumn("output", 2),
+			newPrimitiveColumn([]int64{1, 2}),
+			newInt128Column(newUint64ListColumn([]uint64{3, 0, 4, 0}, 2)),
+			newDateTimeColumn(newPrimitiveColumn([]int64{
+				time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC).UnixMilli() + epochStartMillis,
+				time.Date(2022, 6, 7, 8, 9, 10, 0, time.UTC).UnixMilli() + epochStartMillis})),
+			newCharColumn(newPrimitiveColumn([]uint32{'a', 'b'}))})
+
+	sc, ok := GetStringColumn(rel, 0)
+	assert.True(t, ok)
+	assert.Equal(t, "output", sc.Item(1))
+
+	ic, ok := GetInt64Column(rel, 1)
+	assert.True(t, ok)
+	assert.Equal(t, int64(2), ic.Item(1))
+	_, ok = GetInt32Column(rel, 1)
+	assert.False(t, ok)
+	_, ok = GetInt64Column(rel, 5)
+	assert.False(t, ok)
+
+	bc, ok := GetBigIntColumn(rel, 2)
+	assert.True(t, ok)
+	assert.Equal(t, big.NewInt(4), bc.Item(1))
+
+	tc, ok := GetTimeColumn(rel, 3)
+	assert.True(t, ok)
+	assert.Equal(t, 2022, tc.Item(0).Year())
+
+	cc, ok := GetCharColumn(rel, 4)
+	assert.True(t, ok)
+	assert.Equal(t, 'b', cc.Item(1))
+
+	dc, ok := AsDataColumn[rune](rel.Column(4))
+	assert.True(t, ok)
+	assert.Equal(t, 'a', dc.Item(0))
+}
+
+func TestRelationDiff(t *testing.T) {
+	old := newDerivedRelation(
+		sig("output", Int64Type, StringType),
+		[]Column{
+			newSymbolColumn("output", 3),
+			newPrimitiveColumn([]int64{1, 2, 3}),
+			newPrimitiveColumn([]string{"a", "b", "c"})})
+	new := newDerivedRelation(
+		sig("output", Int64Type, StringType),
+		[]Column{
+			newSymbolColumn("output", 3),
+			newPrimitiveColumn([]int64{1, 2, 4}),
+			newPrimitiveColumn([]string{"a", "x", "d"})})
+
+	added, removed, err := RelationDiff(old, new)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(added))
+	assert.Equal(t, 2, added[0].NumRows())
+	assert.Equal(t, []any{"output", int64(2), "x"}, added[0].Row(0))
+	assert.Equal(t, []any{"output", int64(4), "d"}, added[0].Row(1))
+	assert.Equal(t, 1, len(removed))
+	assert.Equal(t, 2, removed[0].NumRows())
+	assert.Equal(t, []any{"output", int64(2), "b"}, removed[0].Row(0))
+	assert.Equal(t, []any{"output", int64(3), "c"}, removed[0].Row(1))
+
+	added, removed, err = RelationDiff(old, old)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(added))
+	assert.Equal(t, 0, len(removed))
+
+	_, _, err = RelationDiff(old, old.Slice(1))
+	assert.NotNil(t, err)
+}
+
+func TestForEachRow(t *testing.T) {
+	r := newDerivedRelation(
+		sig("output", Int64Type),
+		[]Column{
+			newSymbolColumn("output", 4),
+			newPrimitiveColumn([]int64{3, 8, 5, 9})})
+
+	var visited []int
+	found := -1
+	ForEachRow(r, func(rnum int, row []any) bool {
+		visited = append(visited, rnum)
+		if row[1].(int64) > 4 {
+			found = rnum
+			return false
+		}
+		return true
+	})
+	assert.Equal(t, 1, found)
+	assert.Equal(t, []int{0, 1}, visited)
+
+	var sum int64
+	ForEachRow(r, func(_ int, row []any) bool {
+		sum += row[1].(int64)
+		return true
+	})
+	assert.Equal(t, int64(25), sum)
+}
+
+func TestCast(t *testing.T) {
+	r := newDerivedRelation(
+		sig("output", Uint64Type),
+		[]Column{
+			newSymbolColumn("output", 2),
+			newPrimitiveColumn([]uint64{1672531200, 0})})
+
+	toTime := func(v any) (any, error) {
+		secs := v.(uint64)
+		if secs == 0 {
+			return nil, errors.New("no timestamp")
+		}
+		return time.Unix(int64(secs), 0).UTC(), nil
+	}
+	rr, err := r.Cast(1, TimeType, toTime)
+	assert.Nil(t, err)
+	assert.Equal(t, sig("output", TimeType), rr.Signature())
+	assert.Equal(t, time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC), rr.Row(0)[1])
+	assert.Equal(t, "2023-01-01T00:00:00Z", rr.Column(1).String(0))
+
+	v := rr.Column(1).Value(1)
+	cerr, ok := v.(CastError)
+	assert.True(t, ok)
+	assert.Equal(t, 1, cerr.Row)
+	assert.Equal(t, "no timestamp", errors.Unwrap(cerr).Error())
+
+	// the original relation is unchanged
+	assert.Equal(t, uint64(0), r.Row(1)[1])
+
+	// column out of range
+	_, err = r.Cast(2, TimeType, toTime)
+	assert.NotNil(t, err)
+	_, err = r.Cast(-1, TimeType, toTime)
+	assert.NotNil(t, err)
+}
+
+func TestWithComputedColumn(t *testing.T) {
+	r := newDerivedRelation(
+		sig("output", Int64Type, Int64Type),
+		[]Column{
+			newSymbolColumn("output", 3),
+			newPrimitiveColumn([]int64{1, 3, 5}),
+			newPrimitiveColumn([]int64{2, 4, 0})})
+
+	ratio := func(row []any) any {
+		if row[2].(int64) == 0 {
+			return nil
+		}
+		return float64(row[1].(int64)) / float64(row[2].(int64))
+	}
+	rr, err := r.WithComputedColumn("ratio", Float64Type, ratio)
+	assert.Nil(t, err)
+	assert.Equal(t, sig("output", Int64Type, Int64Type, "ratio", Float64Type), rr.Signature())
+	assert.Equal(t, []any{"output", int64(3), int64(4), "ratio", 0.75}, rr.Row(1))
+	assert.Equal(t, []any{"output", int64(5), int64(0), "ratio", nil}, rr.Row(2))
+	assert.Equal(t, "0.5", rr.Column(4).String(0))
+	assert.Equal(t, 0.75, rr.RowMap(1)["col4"])
+
+	_, err = r.WithComputedColumn("ratio", Int64Type, ratio)
+	assert.NotNil(t, err)
+}
+
+func TestNullify(t *testing.T) {
+	r := newDerivedRelation(
+		sig("output", Int64Type, MissingType, StringType, StringType),
+		[]Column{
+			newSymbolColumn("output", 2),
+			newPrimitiveColumn([]int64{1, 2}),
+			newMissingColumn(2),
+			newUnknownColumn(2),
+			newPrimitiveColumn([]string{"a", "N/A"})})
+
+	nr := r.Nullify()
+	assert.Equal(t, r.Signature(), nr.Signature())
+	assert.Equal(t, []any{"output", int64(1), nil, nil, "a"}, nr.Row(0))
+	assert.Equal(t, []string{"output", "2", "", "", "N/A"}, nr.Strings(1))
+
+	nr = r.Nullify("N/A", "output")
+	assert.Equal(t, []any{"output", int64(2), nil, nil, nil}, nr.Row(1))
+	assert.Equal(t, "", nr.Column(4).String(1))
+	assert.Equal(t, "a", nr.Column(4).String(0))
+
+	// the original relation is unchanged
+	assert.Equal(t, []any{"output", int64(2), "missing", "unknown", "N/A"}, r.Row(1))
+}
+
+func TestRename(t *testing.T) {
+	r := newDerivedRelation(
+		sig("output", Int64Type, "name", StringType),
+		[]Column{
+			newSymbolColumn("output", 2),
+			newPrimitiveColumn([]int64{1, 2}),
+			newSymbolColumn("name", 2),
+			newPrimitiveColumn([]string{"a", "b"})})
+
+	rr, err := r.Rename(0, "people")
+	assert.Nil(t, err)
+	assert.Equal(t, sig("people", Int64Type, "name", StringType), rr.Signature())
+	assert.Equal(t, []any{"people", int64(2), "name", "b"}, rr.Row(1))
+	assert.Equal(t, "people", rr.Schema()[0].Name)
+	assert.Equal(t, "b", rr.RowMap(1)["col3"])
+
+	// the original relation is unchanged
+	assert.Equal(t, sig("output", Int64Type, "name", StringType), r.Signature())
+	assert.Equal(t, "output", r.Row(0)[0])
+
+	_, err = r.Rename(1, "id")
+	assert.NotNil(t, err)
+	_, err = r.Rename(4, "id")
+	assert.NotNil(t, err)
+}
+
+func TestJoin(t *testing.T) {
+	people := newDerivedRelation(
+		sig(Int64Type, StringType),
+		[]Column{
+			newPrimitiveColumn([]int64{1, 2, 3}),
+			newPrimitiveColumn([]string{"ann", "bob", "cat"})})
+	orders := newDerivedRelation(
+		sig(StringType, Int64Type),
+		[]Column{
+			newPrimitiveColumn([]string{"x", "y", "z", "w"}),
+			newPrimitiveColumn([]int64{2, 1, 2, 4})})
+
+	r, err := Join(people, orders, 0, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, sig(Int64Type, StringType, StringType), r.Signature())
+	assert.Equal(t, 3, r.NumRows())
+	assert.Equal(t, []any{int64(1), "ann", "y"}, r.Row(0))
+	assert.Equal(t, []any{int64(2), "bob", "x"}, r.Row(1))
+	assert.Equal(t, []any{int64(2), "bob", "z"}, r.Row(2))
+
+	r, err = JoinKeepKeys(people, orders, 0, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, sig(Int64Type, StringType, StringType, Int64Type), r.Signature())
+	assert.Equal(t, []any{int64(1), "ann", "y", int64(1)}, r.Row(0))
+
+	none := newDerivedRelation(
+		sig(Int64Type), []Column{newPrimitiveColumn([]int64{})})
+	r, err = Join(people, none, 0, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, r.NumRows())
+
+	_, err = Join(people, orders, 0, 0)
+	assert.NotNil(t, err)
+	_, err = Join(people, orders, 2, 1)
+	assert.NotNil(t, err)
+}
+
+func TestTypeWildcards(t *testing.T) {
+	rel := func(t any) Relation {
+		return newDerivedRelation(sig("output", t), []Column{newSymbolColumn("output", 0), newNilColumn(0)})
+	}
+	rs := RelationCollection{
+		rel(Int32Type), rel(Int64Type), rel(Float64Type), rel(DecimalType), rel(StringType)}
+
+	assert.Equal(t, RelationCollection{rs[0], rs[1]}, rs.Select("output", AnyInteger))
+	assert.Equal(t, RelationCollection{rs[2]}, rs.Select("output", AnyFloat))
+	assert.Equal(t, rs[:4], rs.Select("output", AnyNumeric))
+	assert.Equal(t, RelationCollection{rs[1]}, rs.Select("_", Int64Type))
+	assert.Equal(t, 0, len(rs.Select(AnyNumeric)))
+}
+
+func TestInt128Conversion(t *testing.T) {
+	max := uint64(math.MaxUint64)
+	ic := newInt128Column(newUint64ListColumn([]uint64{
+		42, 0, // 42
+		max, max, // -1
+		1 << 63, max, // min int64
+		1 << 63, 0, // max int64 + 1
+		0, 1}, 2)) // 2^64
+	for rnum, expected := range []struct {
+		v  int64
+		ok bool
+	}{{42, true}, {-1, true}, {math.MinInt64, true}, {0, false}, {0, false}} {
+		v, ok := ic.Int64(rnum)
+		assert.Equal(t, expected.ok, ok)
+		assert.Equal(t, expected.v, v)
+		if ok {
+			assert.Equal(t, big.NewInt(v), ic.Value(rnum))
+		}
+	}
+
+	uc := newUint128Column(newUint64ListColumn([]uint64{max, 0, 0, 1}, 2))
+	v, ok := uc.Uint64(0)
+	assert.True(t, ok)
+	assert.Equal(t, max, v)
+	_, ok = uc.Uint64(1)
+	assert.False(t, ok)
+}
+
+func TestIsEmpty(t *testing.T) {
+	// fully specialized, no partition data
+	rel := newBaseRelation(nil, sig("output", "foo"))
+	assert.Equal(t, 1, rel.NumRows())
+	assert.False(t, rel.IsEmpty())
+
+	rsp := newPartitionedResponse(1, 0)
+	rel = rsp.Relation("0.arrow")
+	assert.Equal(t, 0, rel.NumRows())
+	assert.True(t, rel.IsEmpty())
+
+	rel = newPartitionedResponse(1, 3).Relation("0.arrow")
+	assert.False(t, rel.IsEmpty())
+	assert.True(t, selectRows(rel, nil).IsEmpty())
+}
+
+func TestEmptyResults(t *testing.T) {
+	rsp, err := test.client.Execute(
+		test.databaseName, test.engineName, "def output = :foo", nil, true, o11yTag)
+	assert.Nil(t, err)
+	rs := rsp.Relations("output")
+	assert.Equal(t, 1, len(rs))
+	assert.Equal(t, 1, rs[0].NumRows())
+	assert.False(t, rs[0].IsEmpty())
+
+	rsp, err = test.client.Execute(
+		test.databaseName, test.engineName, "def output = {}", nil, true, o11yTag)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(rsp.Relations("output")))
+}
+
 func TestPrefixMatch(t *testing.T) {
 	query := `def output {(1, :foo, "a"); (42, :bar, "c")}`
 
@@ -2246,3 +3392,226 @@ func TestRelationUnion(t *testing.T) {
 	assert.Equal(t, 5, len(r))
 	assert.Equal(t, []any{"output", int64(6), "zip", "missing", "pip"}, r)
 }
+
+// Test that times rendered as Rel literals read back as the same instant.
+func TestDateTimeRoundTrip(t *testing.T) {
+	times := []time.Time{
+		time.Date(2021, 10, 12, 1, 22, 31, 0, time.FixedZone("", 10*60*60)),
+		time.Date(1969, 7, 20, 20, 17, 40, 123e6, time.UTC),
+		time.Date(2022, 3, 4, 5, 6, 7, 8e6, time.FixedZone("", -(3*60+30)*60)),
+	}
+	millis := make([]int64, len(times))
+	for i, tm := range times {
+		lit := RelDateTimeLiteral(tm)
+		parsed, err := time.Parse(time.RFC3339, lit)
+		assert.Nil(t, err)
+		assert.True(t, tm.Equal(parsed), lit)
+		millis[i] = RataMillisFromDateTime(tm)
+	}
+	dtc := newDateTimeColumn(newPrimitiveColumn(millis))
+	for i, tm := range times {
+		assert.True(t, tm.Equal(dtc.Item(i)))
+	}
+
+	d := time.Date(2021, 10, 12, 23, 30, 0, 0, time.FixedZone("", 10*60*60))
+	dc := newDateColumn(newPrimitiveColumn([]int64{RataDieFromDate(d)}))
+	assert.Equal(t, RelDateLiteral(d), dc.String(0))
+	assert.Equal(t, time.Date(2021, 10, 12, 0, 0, 0, 0, time.UTC), dc.Item(0))
+	assert.Equal(t, int64(epochStartDays), RataDieFromDate(time.Unix(0, 0).UTC()))
+}
+
+func TestSignatureByName(t *testing.T) {
+	rsp := &TransactionResponse{
+		Metadata: &TransactionMetadata{sigMap: map[string]Signature{
+			"0.arrow": sig("output", Int64Type),
+			"1.arrow": sig("output", "name", StringType),
+			"2.arrow": sig("rel", "catalog", "diagnostic", "message", StringType),
+			"3.arrow": sig(Int64Type, "output")}}}
+	assert.Equal(t, map[string]Signature{
+		"0.arrow": sig("output", Int64Type),
+		"1.arrow": sig("output", "name", StringType)}, rsp.SignatureByName("output"))
+	assert.Len(t, rsp.SignatureByName("rel"), 1)
+	assert.Empty(t, rsp.SignatureByName("other"))
+	assert.Nil(t, rsp.Partitions) // no results needed
+
+	rsp = &TransactionResponse{}
+	assert.Empty(t, rsp.SignatureByName("output"))
+}
+
+func TestTypeName(t *testing.T) {
+	tests := []struct {
+		typ      any
+		expected string
+	}{
+		{BoolType, "Bool"},
+		{CharType, "Char"},
+		{DecimalType, "FixedDecimal"},
+		{Float16Type, "Float16"},
+		{Float32Type, "Float32"},
+		{Float64Type, "Float64"},
+		{Int8Type, "Int8"},
+		{Int16Type, "Int16"},
+		{Int32Type, "Int32"},
+		{Int64Type, "Int64"},
+		{Int128Type, "Int128"},
+		{BigIntType, "BigInt"},
+		{Uint8Type, "UInt8"},
+		{Uint16Type, "UInt16"},
+		{Uint32Type, "UInt32"},
+		{Uint64Type, "UInt64"},
+		{Uint128Type, "UInt128"},
+		{RationalType, "Rational"},
+		{StringType, "String"},
+		{TimeType, "DateTime"},
+		{MissingType, "Missing"},
+		{MixedType, "Mixed"},
+		{UnknownType, "Unknown"},
+		{nil, "Unknown"},
+		{"output", ":output"},
+		{int64(42), "42"},
+		{vtype("Point", Float64Type, Float64Type), "ValueType(:Point, Float64, Float64)"},
+		{vtype("rel:base:Date", Int64Type), "ValueType(:rel, :base, :Date, Int64)"},
+		{vtype("Outer", vtype("Inner", StringType)), "ValueType(:Outer, ValueType(:Inner, String))"},
+		{ctype("Const", "a", int64(1)), "Const(:Const, :a, 1)"},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.expected, RelTypeName(test.typ))
+	}
+
+	assert.Equal(t, "Int64", TypeName(newPrimitiveColumn([]int64{1})))
+	assert.Equal(t, "String", TypeName(newPrimitiveColumn([]string{"a"})))
+	assert.Equal(t, "Missing", TypeName(newMissingColumn(1)))
+
+	// relation columns are named as their metadata signature element
+	int64s := newPrimitiveColumn([]int64{1})
+	uint128s := newUint64ListColumn([]uint64{1, 0}, 2)
+	columnTests := []struct {
+		typ      any
+		col      Column
+		expected string
+	}{
+		{CharType, newPrimitiveColumn([]uint32{65}), "Char"},
+		{Int128Type, uint128s, "Int128"},
+		{Uint128Type, uint128s, "UInt128"},
+		{vtype("rel:base:Date", Int64Type), int64s,
+			"ValueType(:rel, :base, :Date, Int64)"},
+		{vtype("rel:base:DateTime", Int64Type), int64s,
+			"ValueType(:rel, :base, :DateTime, Int64)"},
+		{vtype("rel:base:FilePos", Int64Type), int64s,
+			"ValueType(:rel, :base, :FilePos, Int64)"},
+		{vtype("rel:base:Hash", Uint128Type), uint128s,
+			"ValueType(:rel, :base, :Hash, UInt128)"},
+		{vtype("rel:base:FixedDecimal", int64(64), int64(2), Int64Type), int64s,
+			"ValueType(:rel, :base, :FixedDecimal, 64, 2, Int64)"},
+		{vtype("rel:base:FixedDecimal", int64(128), int64(2), Int128Type), uint128s,
+			"ValueType(:rel, :base, :FixedDecimal, 128, 2, Int128)"},
+		{vtype("rel:base:Rational", int64(64), Int64Type, Int64Type),
+			newInt64ListColumn([]int64{1, 2}, 2),
+			"ValueType(:rel, :base, :Rational, 64, Int64, Int64)"},
+		{vtype("Point", Int64Type), int64s, "ValueType(:Point, Int64)"},
+		{ctype("rel:base:Date", int64(738075)), nil,
+			"Const(:rel, :base, :Date, 738075)"},
+		{ctype("Const", "a", int64(1)), nil, "Const(:Const, :a, 1)"},
+		{"output", nil, ":output"},
+	}
+	for _, test := range columnTests {
+		c := newRelationColumn(test.typ, test.col, 1)
+		assert.Equal(t, test.expected, RelTypeName(test.typ))
+		assert.Equal(t, test.expected, TypeName(c))
+	}
+}
+
+func TestSample(t *testing.T) {
+	vals := make([]int64, 1000)
+	for i := range vals {
+		vals[i] = int64(i)
+	}
+	rel := newDerivedRelation(
+		sig("output", Int64Type), []Column{newSymbolColumn("output", 1000), newPrimitiveColumn(vals)})
+
+	s := rel.Sample(10, 42)
+	assert.Equal(t, 10, s.NumRows())
+	assert.Equal(t, rel.Signature(), s.Signature())
+	prev := int64(-1)
+	for rnum := 0; rnum < s.NumRows(); rnum++ {
+		v := s.Row(rnum)[1].(int64)
+		assert.True(t, v > prev) // distinct rows, in their original order
+		prev = v
+	}
+	assert.Equal(t, s.Row(0), rel.Sample(10, 42).Row(0))
+	assert.NotEqual(t, rowsOf(s), rowsOf(rel.Sample(10, 43)))
+	assert.True(t, prev >= 10, "sample is not just the leading rows")
+
+	assert.Equal(t, 1000, rel.Sample(2000, 1).NumRows())
+	assert.Equal(t, 0, rel.Sample(0, 1).NumRows())
+	assert.Equal(t, 0, rel.Sample(-1, 1).NumRows())
+
+	// every row is about equally likely to be sampled
+	counts := make([]int, 4)
+	for seed := int64(0); seed < 4000; seed++ {
+		s := rel.Slice(0).Sample(1, seed)
+		counts[s.Row(0)[1].(int64)*4/1000]++
+	}
+	for _, n := range counts {
+		assert.InDelta(t, 1000, n, 150)
+	}
+}
+
+func rowsOf(r Relation) [][]any {
+	result := make([][]any, r.NumRows())
+	for rnum := range result {
+		result[rnum] = r.Row(rnum)
+	}
+	return result
+}
+
+func TestRelationsApproxEqual(t *testing.T) {
+	newRel := func(floats []float64, decs []any, names []string) Relation {
+		return newDerivedRelation(
+			sig("output", Float64Type, DecimalType, StringType),
+			[]Column{
+				newSymbolColumn("output", len(floats)),
+				newPrimitiveColumn(floats),
+				computedColumn{decs, DecimalType},
+				newPrimitiveColumn(names)})
+	}
+	dec := decimal.RequireFromString
+	a := newRel(
+		[]float64{0.1 + 0.2, 1e6, math.NaN()},
+		[]any{dec("1.005"), dec("2"), dec("3")},
+		[]string{"a", "b", "c"})
+	b := newRel(
+		[]float64{0.3, 1e6 + 1e-9, math.NaN()},
+		[]any{dec("1.0049"), dec("2"), dec("3")},
+		[]string{"a", "b", "c"})
+	assert.True(t, RelationsApproxEqual(a, a, 0))
+	assert.False(t, RelationsApproxEqual(a, b, 0))
+	assert.True(t, RelationsApproxEqual(a, b, 1e-3))
+	assert.True(t, RelationsApproxEqual(b, a, -1e-3))
+	assert.False(t, RelationsApproxEqual(a, b, 1e-5)) // decimals differ by 1e-4
+	assert.False(t, RelationsApproxEqual(a, b, math.NaN()))
+
+	c := newRel(
+		[]float64{0.3, 1e6, math.NaN()},
+		[]any{dec("1.005"), dec("2"), dec("3")},
+		[]string{"a", "b", "C"})
+	assert.False(t, RelationsApproxEqual(a, c, 1))
+	assert.False(t, RelationsApproxEqual(a, a.Slice(0, 2), 1))
+	assert.False(t, RelationsApproxEqual(a, a.Sample(2, 1), 1))
+
+	// mixed and value type values
+	tol := new(big.Rat).SetFloat64(0.01)
+	assert.True(t, approxEqual([]any{"Point", 1.0, 2.0}, []any{"Point", 1.001, 2.0}, tol))
+	assert.False(t, approxEqual([]any{"Point", 1.0, 2.0}, []any{"Point", 1.1, 2.0}, tol))
+	assert.False(t, approxEqual(1.0, int64(1), tol))
+	assert.False(t, approxEqual(1.0, dec("1"), tol))
+	assert.True(t, approxEqual(big.NewRat(1, 3), big.NewRat(333, 1000), tol))
+	assert.True(t, approxEqual(float32(0.5), float32(0.505), tol))
+	assert.True(t, approxEqual(math.Inf(1), math.Inf(1), tol))
+	assert.False(t, approxEqual(math.Inf(1), math.Inf(-1), tol))
+	assert.False(t, approxEqual(math.NaN(), 1.0, tol))
+	assert.True(t, approxEqual(big.NewInt(7), big.NewInt(7), tol))
+	assert.True(t, approxEqual(
+		time.Date(2022, 1, 2, 0, 0, 0, 0, time.UTC),
+		time.Date(2022, 1, 2, 10, 0, 0, 0, time.FixedZone("", 10*60*60)), tol))
+}
@@ -0,0 +1,220 @@
+// Copyright 2022 RelationalAI, Inc.
+
+package rai
+
+// Support for presenting the results of the v1 `/transaction` endpoint as a
+// TransactionResponse, so that code written against `Execute` works with
+// either endpoint.
+
+// Each v1 output relation is described by a RelKey naming its key and value
+// types, eg {name: "output", keys: [":a", "Int64"], values: ["String"]}, and
+// has one column of JSON values per non-symbol type. Each relation becomes a
+// single partition whose signature is the relation name followed by the key
+// and value types. The v1 endpoint encodes all numbers as JSON numbers, so
+// integer values beyond 2^53 may have lost precision, and types that are not
+// primitive, eg dates or decimals, are returned as the JSON values the
+// endpoint encodes them as.
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+
+	"github.com/apache/arrow/go/v7/arrow"
+	"github.com/apache/arrow/go/v7/arrow/array"
+	"github.com/apache/arrow/go/v7/arrow/memory"
+	"github.com/pkg/errors"
+)
+
+// ResultsAPI selects the endpoint used to execute transactions.
+type ResultsAPI int
+
+const (
+	ResultsAPIV2 ResultsAPI = iota // async `/transactions` endpoint, the default
+	ResultsAPIV1                   // sync `/transaction` endpoint
+)
+
+type v1Type struct {
+	typ reflect.Type
+	dt  arrow.DataType
+}
+
+// v1 primitive type names and their corresponding relation and arrow types.
+var v1Types = map[string]v1Type{
+	"Bool":    {BoolType, arrow.FixedWidthTypes.Boolean},
+	"Float32": {Float32Type, arrow.PrimitiveTypes.Float32},
+	"Float64": {Float64Type, arrow.PrimitiveTypes.Float64},
+	"Int8":    {Int8Type, arrow.PrimitiveTypes.Int8},
+	"Int16":   {Int16Type, arrow.PrimitiveTypes.Int16},
+	"Int32":   {Int32Type, arrow.PrimitiveTypes.Int32},
+	"Int64":   {Int64Type, arrow.PrimitiveTypes.Int64},
+	"String":  {StringType, arrow.BinaryTypes.String},
+	"UInt8":   {Uint8Type, arrow.PrimitiveTypes.Uint8},
+	"UInt16":  {Uint16Type, arrow.PrimitiveTypes.Uint16},
+	"UInt32":  {Uint32Type, arrow.PrimitiveTypes.Uint32},
+	"UInt64":  {Uint64Type, arrow.PrimitiveTypes.Uint64},
+}
+
+// Returns the type of a column whose v1 type name is not a known primitive,
+// inferred from its JSON values.
+func inferV1Type(col []any) v1Type {
+	integral := true
+	for _, v := range col {
+		switch vv := v.(type) {
+		case bool:
+			return v1Types["Bool"]
+		case float64:
+			if vv != math.Trunc(vv) {
+				integral = false
+			}
+		default:
+			return v1Types["String"]
+		}
+	}
+	if len(col) == 0 {
+		return v1Types["String"]
+	}
+	if integral {
+		return v1Types["Int64"]
+	}
+	return v1Types["Float64"]
+}
+
+func appendV1Numbers[T intTypes | float32 | float64](b interface{ Append(T) }, col []any) error {
+	for _, v := range col {
+		f, ok := v.(float64)
+		if !ok {
+			return errors.Errorf("expected a number, found '%v'", v)
+		}
+		b.Append(T(f))
+	}
+	return nil
+}
+
+// Append the given column of JSON values to the given arrow builder.
+func appendV1Column(b array.Builder, col []any) error {
+	switch bb := b.(type) {
+	case *array.BooleanBuilder:
+		for _, v := range col {
+			bv, ok := v.(bool)
+			if !ok {
+				return errors.Errorf("expected a bool, found '%v'", v)
+			}
+			bb.Append(bv)
+		}
+		return nil
+	case *array.StringBuilder:
+		for _, v := range col {
+			if s, ok := v.(string); ok {
+				bb.Append(s)
+			} else {
+				bb.Append(fmt.Sprintf("%v", v))
+			}
+		}
+		return nil
+	case *array.Float32Builder:
+		return appendV1Numbers[float32](bb, col)
+	case *array.Float64Builder:
+		return appendV1Numbers[float64](bb, col)
+	case *array.Int8Builder:
+		return appendV1Numbers[int8](bb, col)
+	case *array.Int16Builder:
+		return appendV1Numbers[int16](bb, col)
+	case *array.Int32Builder:
+		return appendV1Numbers[int32](bb, col)
+	case *array.Int64Builder:
+		return appendV1Numbers[int64](bb, col)
+	case *array.Uint8Builder:
+		return appendV1Numbers[uint8](bb, col)
+	case *array.Uint16Builder:
+		return appendV1Numbers[uint16](bb, col)
+	case *array.Uint32Builder:
+		return appendV1Numbers[uint32](bb, col)
+	case *array.Uint64Builder:
+		return appendV1Numbers[uint64](bb, col)
+	}
+	return errors.Errorf("unexpected builder type '%T'", b)
+}
+
+// Returns the relation ID, signature and partition for the given v1 relation.
+func newV1Partition(mem memory.Allocator, r *RelationV1) (string, Signature, *Partition, error) {
+	names := append(append([]string{}, r.RelKey.Keys...), r.RelKey.Values...)
+	sig := Signature{r.RelKey.Name}
+	var fields []arrow.Field
+	var cols []arrow.Array
+	defer func() {
+		for _, c := range cols {
+			c.Release()
+		}
+	}()
+	nrows := 1 // fully specialized relations have a single row
+	for _, name := range names {
+		if strings.HasPrefix(name, ":") {
+			sig = append(sig, name[1:]) // symbol
+			continue
+		}
+		cnum := len(cols)
+		if cnum >= len(r.Columns) {
+			return "", nil, nil, errors.Errorf(
+				"relation '%s' has %d columns, expected more", r.RelKey.Name, len(r.Columns))
+		}
+		col := r.Columns[cnum]
+		t, ok := v1Types[name]
+		if !ok {
+			t = inferV1Type(col)
+		}
+		b := array.NewBuilder(mem, t.dt)
+		err := appendV1Column(b, col)
+		if err == nil {
+			cols = append(cols, b.NewArray())
+		}
+		b.Release()
+		if err != nil {
+			return "", nil, nil, errors.Wrapf(err, "relation '%s'", r.RelKey.Name)
+		}
+		sig = append(sig, t.typ)
+		fields = append(fields, arrow.Field{Name: fmt.Sprintf("v%d", cnum+1), Type: t.dt})
+		nrows = len(col)
+	}
+	if len(cols) != len(r.Columns) {
+		return "", nil, nil, errors.Errorf(
+			"relation '%s' has %d columns, expected %d", r.RelKey.Name, len(r.Columns), len(cols))
+	}
+	id := "/:" + strings.Join(append([]string{r.RelKey.Name}, names...), "/")
+	record := array.NewRecord(arrow.NewSchema(fields, nil), cols, int64(nrows))
+	return id, sig, newPartition(record), nil
+}
+
+// Returns the given v1 transaction result as a TransactionResponse whose
+// transaction, metadata, results and problems are all populated, so that the
+// `Ensure*` methods do not need to fetch anything.
+func newTransactionResponseV1(result *TransactionResult) (*TransactionResponse, error) {
+	mem := memory.NewGoAllocator()
+	rsp := &TransactionResponse{
+		Metadata:   &TransactionMetadata{sigMap: map[string]Signature{}},
+		Partitions: map[string]*Partition{},
+		Problems:   make([]Problem, len(result.Problems))}
+	rsp.Transaction.State = Completed
+	if result.Aborted {
+		rsp.Transaction.State = Aborted
+	}
+	for i := range result.Output {
+		id, sig, p, err := newV1Partition(mem, &result.Output[i])
+		if err != nil {
+			return nil, err
+		}
+		rsp.Metadata.sigMap[id] = sig
+		rsp.Partitions[id] = p
+	}
+	for i, p := range result.Problems {
+		rsp.Problems[i] = Problem{
+			Type:        p.Type,
+			ErrorCode:   p.ErrorCode,
+			Message:     p.Message,
+			Report:      p.Report,
+			IsError:     p.IsError,
+			IsException: p.IsException}
+	}
+	return rsp, nil
+}
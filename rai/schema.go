@@ -0,0 +1,323 @@
+// Copyright 2022 RelationalAI, Inc.
+
+package rai
+
+// Support for describing relations with a serializable schema, as an
+// alternative to the reflect based relation signature, and for accessing
+// relation rows by column name.
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apache/arrow/go/v7/arrow/float16"
+	"github.com/shopspring/decimal"
+)
+
+// ColumnSchema describes a single relation column, or an element of a const
+// or value type. Symbols and other constants are described by their type
+// name and value, and value types by their name and their element fields.
+type ColumnSchema struct {
+	Name     string         `json:"name"`
+	TypeName string         `json:"type"`
+	Value    any            `json:"value,omitempty"`
+	Fields   []ColumnSchema `json:"fields,omitempty"`
+}
+
+// Rel type names of the relation primitive types.
+var typeNames = map[reflect.Type]string{
+	AnyType:      "Any",
+	BigIntType:   "BigInt",
+	BoolType:     "Bool",
+	CharType:     "Char",
+	DecimalType:  "FixedDecimal",
+	Float16Type:  "Float16",
+	Float32Type:  "Float32",
+	Float64Type:  "Float64",
+	Int8Type:     "Int8",
+	Int16Type:    "Int16",
+	Int32Type:    "Int32",
+	Int64Type:    "Int64",
+	Int128Type:   "Int128",
+	MissingType:  "Missing",
+	MixedType:    "Mixed",
+	RationalType: "Rational",
+	StringType:   "String",
+	TimeType:     "DateTime",
+	Uint8Type:    "UInt8",
+	Uint16Type:   "UInt16",
+	Uint32Type:   "UInt32",
+	Uint64Type:   "UInt64",
+	Uint128Type:  "UInt128",
+	UnknownType:  "Unknown",
+}
+
+// Returns the name of the given primitive type.
+func typeName(t reflect.Type) string {
+	if name, ok := typeNames[t]; ok {
+		return name
+	}
+	return t.String()
+}
+
+// Returns the Rel name of the given relation type, as it appears in a
+// relation signature. Primitive types are named as in Rel, eg Int64 or
+// FixedDecimal, symbols as :name and other constants by their value. Value
+// types are rendered as ValueType(...) and const types as Const(...) of
+// their elements, eg ValueType(:Point, Float64, Float64).
+func RelTypeName(t any) string {
+	switch tt := t.(type) {
+	case reflect.Type:
+		return typeName(tt)
+	case ValueType:
+		return "ValueType(" + strings.Join(relTypeNames(tt), ", ") + ")"
+	case ConstType:
+		return "Const(" + strings.Join(relTypeNames(tt), ", ") + ")"
+	case string:
+		return ":" + tt
+	case nil:
+		return typeName(UnknownType)
+	}
+	if lit, err := RelLiteral(t); err == nil {
+		return lit
+	}
+	return fmt.Sprintf("%v", t)
+}
+
+func relTypeNames(ts []any) []string {
+	result := make([]string, len(ts))
+	for i, t := range ts {
+		result[i] = RelTypeName(t)
+	}
+	return result
+}
+
+// Implemented by columns whose Rel type is not identified by their Type, eg
+// Char columns, which have rune items, or value type columns.
+type relTyped interface {
+	relType() any
+}
+
+// Returns the Rel type of the given column, as it appears in the relation
+// metadata signature.
+func relTypeOf(c Column) any {
+	if cc, ok := c.(relTyped); ok {
+		return cc.relType()
+	}
+	return c.Type()
+}
+
+func relTypesOf(cols []Column) []any {
+	result := make([]any, len(cols))
+	for i, c := range cols {
+		result[i] = relTypeOf(c)
+	}
+	return result
+}
+
+// Returns the Rel name of the type of the given column, which is the
+// `RelTypeName` of its element of the relation metadata signature, eg Char,
+// Int128 or ValueType(:rel, :base, :Date, Int64).
+func TypeName(c Column) string {
+	return RelTypeName(relTypeOf(c))
+}
+
+// Returns column names for the given signature. Symbol columns are named
+// after their symbol and all others by position, eg "col2". If a name would
+// not be unique, the positional name is used instead. A positional name that
+// is also the name of a symbol column is given a suffix, eg "col2_1".
+func columnNames(sig Signature) []string {
+	result := make([]string, len(sig))
+	count := map[string]int{}
+	for i, t := range sig {
+		if s, ok := t.(string); ok {
+			result[i] = s
+			count[s]++
+		}
+	}
+	taken := map[string]bool{}
+	for i, name := range result {
+		if name == "" || count[name] > 1 {
+			result[i] = ""
+		} else {
+			taken[name] = true
+		}
+	}
+	for i, name := range result {
+		if name != "" {
+			continue
+		}
+		name = fmt.Sprintf("col%d", i)
+		for n := 1; taken[name]; n++ {
+			name = fmt.Sprintf("col%d_%d", i, n)
+		}
+		taken[name] = true
+		result[i] = name
+	}
+	return result
+}
+
+// Returns the schema of each element of the given signature.
+func signatureSchema(sig []any) []ColumnSchema {
+	names := columnNames(sig)
+	result := make([]ColumnSchema, len(sig))
+	for i, t := range sig {
+		result[i] = typeSchema(names[i], t)
+	}
+	return result
+}
+
+// Returns the schema describing the given relation type.
+func typeSchema(name string, t any) ColumnSchema {
+	switch tt := t.(type) {
+	case reflect.Type:
+		return ColumnSchema{Name: name, TypeName: typeName(tt)}
+	case ConstType:
+		return ColumnSchema{Name: name, TypeName: "Const", Fields: signatureSchema(tt)}
+	case ValueType:
+		n := valueTypeNameLen(tt)
+		return ColumnSchema{
+			Name:     name,
+			TypeName: strings.Join(asStrings(tt[:n]), ":"),
+			Fields:   signatureSchema(tt[n:])}
+	case string:
+		return ColumnSchema{Name: name, TypeName: "Symbol", Value: tt}
+	default: // constant value
+		return ColumnSchema{Name: name, TypeName: typeName(reflect.TypeOf(tt)), Value: tt}
+	}
+}
+
+func (r *baseRelation) Schema() []ColumnSchema {
+	return signatureSchema(r.Signature())
+}
+
+func (r derivedRelation) Schema() []ColumnSchema {
+	return signatureSchema(r.Signature())
+}
+
+// Returns the given row of the relation as a map from column name to value,
+// where column names are derived from the signature as described by
+// `columnNames`. Values are the same as those returned by `Row`, so value
+// type instances are represented by a []any of their elements, including the
+// value type's name symbols, and values of mixed columns are whatever their
+// row holds.
+func rowMap(r Relation, rnum int) map[string]any {
+	names := columnNames(r.Signature())
+	row := r.Row(rnum)
+	result := make(map[string]any, len(row))
+	for i, v := range row {
+		result[names[i]] = v
+	}
+	return result
+}
+
+func (r *baseRelation) RowMap(rnum int) map[string]any {
+	return rowMap(r, rnum)
+}
+
+func (r derivedRelation) RowMap(rnum int) map[string]any {
+	return rowMap(r, rnum)
+}
+
+// Returns the given relation value converted to a form that encodes as JSON
+// without loss, according to its relation type. Times are formatted as
+// RFC3339, numbers that do not fit a JSON number as strings, eg "NaN" or
+// "+Inf", and missing values as null. Decimals are formatted according to the
+// given format.
+func jsonValue(t any, v any, f DecimalFormat) any {
+	switch t {
+	case MissingType:
+		return nil
+	case RuneType:
+		if r, ok := v.(rune); ok {
+			return string(r)
+		}
+	}
+	if vt, ok := t.(ValueType); ok {
+		if vals, ok := v.([]any); ok && len(vals) == len(vt) {
+			result := make([]any, len(vals))
+			for i, ev := range vals {
+				result[i] = jsonValue(vt[i], ev, f)
+			}
+			return result
+		}
+	}
+	switch vv := v.(type) {
+	case time.Time:
+		return vv.Format(time.RFC3339Nano)
+	case *big.Int:
+		return vv.String()
+	case *big.Rat:
+		return vv.RatString()
+	case decimal.Decimal:
+		return formatDecimal(vv, f)
+	case float16.Num:
+		return jsonFloat(float64(vv.Float32()), vv.Float32())
+	case float32:
+		return jsonFloat(float64(vv), vv)
+	case float64:
+		return jsonFloat(vv, vv)
+	}
+	return v
+}
+
+// Returns the given float value, or a string if it is NaN or infinite, which
+// have no JSON number.
+func jsonFloat(f float64, v any) any {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	}
+	return v
+}
+
+type JSONLWriteOptions struct {
+	DecimalFormat DecimalFormat // default DecimalShortest
+}
+
+func NewJSONLWriteOptions() *JSONLWriteOptions {
+	return &JSONLWriteOptions{}
+}
+
+func (opts *JSONLWriteOptions) WithDecimalFormat(f DecimalFormat) *JSONLWriteOptions {
+	opts.DecimalFormat = f
+	return opts
+}
+
+// Write the rows of the given relation to w as newline delimited JSON, one
+// object per row keyed by column name, as returned by `RowMap`.
+func writeJSONL(r Relation, w io.Writer, opts *JSONLWriteOptions) error {
+	var f DecimalFormat
+	if opts != nil {
+		f = opts.DecimalFormat
+	}
+	sig := r.Signature()
+	names := columnNames(sig)
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	nrows := r.NumRows()
+	for rnum := 0; rnum < nrows; rnum++ {
+		row := rowMap(r, rnum)
+		for i, name := range names {
+			row[name] = jsonValue(sig[i], row[name], f)
+		}
+		if err := enc.Encode(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *baseRelation) WriteJSONL(w io.Writer, opts *JSONLWriteOptions) error {
+	return writeJSONL(r, w, opts)
+}
+
+func (r derivedRelation) WriteJSONL(w io.Writer, opts *JSONLWriteOptions) error {
+	return writeJSONL(r, w, opts)
+}
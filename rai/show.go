@@ -295,7 +295,7 @@ func (rsp *TransactionResponse) Show() {
 		fmt.Println()
 		rc.Show()
 	}
-	rc = rsp.Relations("rel", "catalog", "diagnostic")
+	rc = rsp.Diagnostics()
 	if len(rc) > 0 {
 		fmt.Printf("\nProblems:\n")
 		ShowTabularData(rc.Union())
@@ -0,0 +1,185 @@
+// Copyright 2022 RelationalAI, Inc.
+
+package rai
+
+// Support for decoding user defined value types into Go structs.
+
+// A value type such as:
+//
+//     value type MyType {(Int, String)}
+//
+// is returned in relation rows as a slice of the form ["MyType", 1, "a"]. By
+// registering a Go struct under the value type name, eg:
+//
+//     type MyType struct {
+//         N int64
+//         S string
+//     }
+//
+//     rai.RegisterValueType("MyType", MyType{})
+//
+// rows can be decoded so that the value is returned as a `MyType` instead.
+// The exported fields of the struct are matched positionally to the elements
+// of the value type, nested value types are decoded recursively.
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+var valueTypes = struct {
+	sync.RWMutex
+	m map[string]reflect.Type
+}{m: map[string]reflect.Type{}}
+
+// Register the Go type of the given prototype value as the type to decode
+// instances of the named value type into. The prototype must be a struct or a
+// pointer to a struct, and if it is a pointer, decoded values are also
+// pointers. Panics if the prototype is not a struct.
+func RegisterValueType(name string, proto any) {
+	t := reflect.TypeOf(proto)
+	st := t
+	if st != nil && st.Kind() == reflect.Pointer {
+		st = st.Elem()
+	}
+	if st == nil || st.Kind() != reflect.Struct {
+		panic(errors.Errorf("value type '%s' must be registered with a struct", name))
+	}
+	valueTypes.Lock()
+	defer valueTypes.Unlock()
+	valueTypes.m[name] = t
+}
+
+// Returns the Go type registered for the named value type, if any.
+func lookupValueType(name string) (reflect.Type, bool) {
+	valueTypes.RLock()
+	defer valueTypes.RUnlock()
+	t, ok := valueTypes.m[name]
+	return t, ok
+}
+
+// Returns the number of leading symbols in the given value type, which
+// together form the value type's name.
+func valueTypeNameLen(vt ValueType) int {
+	n := 0
+	for _, t := range vt {
+		if _, ok := t.(string); !ok {
+			break
+		}
+		n++
+	}
+	return n
+}
+
+// Answers if the given kind is one of the numeric kinds.
+func isNumericKind(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// Store the given value in the given struct field, converting between numeric
+// types as needed.
+func setField(f reflect.Value, v any) bool {
+	if v == nil {
+		f.Set(reflect.Zero(f.Type()))
+		return true
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Type().AssignableTo(f.Type()) {
+		f.Set(rv)
+		return true
+	}
+	if isNumericKind(rv.Kind()) && isNumericKind(f.Kind()) {
+		f.Set(rv.Convert(f.Type()))
+		return true
+	}
+	return false
+}
+
+// Decode the given value according to the given relation type, returning the
+// value unchanged unless the type is a value type.
+func decodeValue(t any, v any) (any, error) {
+	vt, ok := t.(ValueType)
+	if !ok {
+		return v, nil
+	}
+	vals, ok := v.([]any)
+	if !ok || len(vals) != len(vt) {
+		return nil, errors.Errorf("value '%v' does not match value type %s", v, vt.String())
+	}
+	n := valueTypeNameLen(vt)
+	name := strings.Join(asStrings(vt[:n]), ":")
+	typ, ok := lookupValueType(name)
+	if !ok {
+		return nil, errors.Errorf("value type '%s' is not registered", name)
+	}
+	st := typ
+	if st.Kind() == reflect.Pointer {
+		st = st.Elem()
+	}
+	var fields []int
+	for i := 0; i < st.NumField(); i++ {
+		if st.Field(i).IsExported() {
+			fields = append(fields, i)
+		}
+	}
+	if len(fields) != len(vt)-n {
+		return nil, errors.Errorf(
+			"value type '%s' has %d fields, but %s has %d",
+			name, len(vt)-n, st.String(), len(fields))
+	}
+	result := reflect.New(st).Elem()
+	for i, fnum := range fields {
+		fv, err := decodeValue(vt[n+i], vals[n+i])
+		if err != nil {
+			return nil, err
+		}
+		if !setField(result.Field(fnum), fv) {
+			return nil, errors.Errorf(
+				"cannot decode '%v' into field %s.%s of type %s",
+				fv, st.String(), st.Field(fnum).Name, st.Field(fnum).Type.String())
+		}
+	}
+	if typ.Kind() == reflect.Pointer {
+		return result.Addr().Interface(), nil
+	}
+	return result.Interface(), nil
+}
+
+func asStrings(items []any) []string {
+	result := make([]string, len(items))
+	for i, item := range items {
+		result[i] = item.(string)
+	}
+	return result
+}
+
+// Returns the given row of the relation with all value type instances decoded
+// into their registered Go types.
+func decodeValueTypes(r Relation, rnum int) ([]any, error) {
+	row := r.Row(rnum)
+	for cnum, t := range r.Signature() {
+		v, err := decodeValue(t, row[cnum])
+		if err != nil {
+			return nil, err
+		}
+		row[cnum] = v
+	}
+	return row, nil
+}
+
+func (r *baseRelation) DecodeValueTypes(rnum int) ([]any, error) {
+	return decodeValueTypes(r, rnum)
+}
+
+func (r derivedRelation) DecodeValueTypes(rnum int) ([]any, error) {
+	return decodeValueTypes(r, rnum)
+}